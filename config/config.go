@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"fmt"
 	"os"
+	"runtime/debug"
 	"strings"
 )
 
@@ -13,6 +14,12 @@ var version string
 //go:embed name
 var name string
 
+// set at build time with -ldflags "-X x-ui/config.commit=... -X x-ui/config.buildTime=..."
+var (
+	commit    string
+	buildTime string
+)
+
 type LogLevel string
 
 const (
@@ -30,6 +37,35 @@ func GetName() string {
 	return strings.TrimSpace(name)
 }
 
+// GetCommit returns the git commit the panel was built from, falling back to the
+// vcs information stamped by the go tool.
+func GetCommit() string {
+	if commit != "" {
+		return commit
+	}
+	return getBuildSetting("vcs.revision")
+}
+
+func GetBuildTime() string {
+	if buildTime != "" {
+		return buildTime
+	}
+	return getBuildSetting("vcs.time")
+}
+
+func getBuildSetting(key string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == key {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
 func GetLogLevel() LogLevel {
 	if IsDebug() {
 		return Debug
@@ -61,6 +97,14 @@ func GetDBFolderPath() string {
 	return dbFolderPath
 }
 
+func GetLogFolderPath() string {
+	logFolderPath := os.Getenv("XUI_LOG_FOLDER")
+	if logFolderPath == "" {
+		logFolderPath = "/var/log"
+	}
+	return logFolderPath
+}
+
 func GetDBPath() string {
 	return fmt.Sprintf("%s/%s.db", GetDBFolderPath(), GetName())
 }
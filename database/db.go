@@ -50,6 +50,18 @@ func initClientTraffic() error {
 	return db.AutoMigrate(&xray.ClientTraffic{})
 }
 
+func initLoginAttempt() error {
+	return db.AutoMigrate(&model.LoginAttempt{})
+}
+
+func initTrafficBucket() error {
+	return db.AutoMigrate(&model.TrafficBucket{})
+}
+
+func initSubGroup() error {
+	return db.AutoMigrate(&model.SubGroup{})
+}
+
 func InitDB(dbPath string) error {
 	dir := path.Dir(dbPath)
 	err := os.MkdirAll(dir, fs.ModeDir)
@@ -91,6 +103,20 @@ func InitDB(dbPath string) error {
 		return err
 	}
 
+	err = initLoginAttempt()
+	if err != nil {
+		return err
+	}
+
+	err = initTrafficBucket()
+	if err != nil {
+		return err
+	}
+	err = initSubGroup()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -120,3 +146,27 @@ func Checkpoint() error {
 	}
 	return nil
 }
+
+type TableStat struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// GetTableStats returns the row count of every table in the database
+func GetTableStats() ([]TableStat, error) {
+	var tables []string
+	err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").Scan(&tables).Error
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]TableStat, 0, len(tables))
+	for _, table := range tables {
+		var rows int64
+		err = db.Table(table).Count(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, TableStat{Name: table, Rows: rows})
+	}
+	return stats, nil
+}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"x-ui/util/json_util"
 	"x-ui/xray"
@@ -24,6 +26,33 @@ type User struct {
 	Password string `json:"password"`
 }
 
+type LoginAttempt struct {
+	Id       int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Time     int64  `json:"time" gorm:"index"`
+	IP       string `json:"ip"`
+	Username string `json:"username"`
+	Success  bool   `json:"success"`
+}
+
+// TrafficBucket is the traffic of an inbound, or of one of its clients when Email is set,
+// during the 15 minutes starting at Time (unix milliseconds)
+type TrafficBucket struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Time      int64  `json:"time" gorm:"index"`
+	InboundId int    `json:"inboundId" gorm:"index"`
+	Email     string `json:"email" gorm:"index"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+}
+
+// SubGroup serves the clients whose group is Name as one subscription, SubId is the secret
+// of its subscription url
+type SubGroup struct {
+	Id    int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name  string `json:"name" gorm:"unique"`
+	SubId string `json:"subId" gorm:"unique"`
+}
+
 type Inbound struct {
 	Id          int                  `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`
 	UserId      int                  `json:"-"`
@@ -43,6 +72,30 @@ type Inbound struct {
 	StreamSettings string   `json:"streamSettings" form:"streamSettings"`
 	Tag            string   `json:"tag" form:"tag" gorm:"unique"`
 	Sniffing       string   `json:"sniffing" form:"sniffing"`
+	PortRange      string   `json:"portRange" form:"portRange"`
+	Allocate       string   `json:"allocate" form:"allocate"`
+	ConnIdle       int      `json:"connIdle" form:"connIdle"`
+	MaxClients     int      `json:"maxClients" form:"maxClients"`
+}
+
+// GetPortRange returns the first and last port the inbound listens on
+func (i *Inbound) GetPortRange() (int, int, error) {
+	if i.PortRange == "" {
+		return i.Port, i.Port, nil
+	}
+	parts := strings.Split(i.PortRange, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid port range: %v", i.PortRange)
+	}
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range: %v", i.PortRange)
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range: %v", i.PortRange)
+	}
+	return from, to, nil
 }
 
 func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
@@ -50,14 +103,19 @@ func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
 	if listen != "" {
 		listen = fmt.Sprintf("\"%v\"", listen)
 	}
+	port := strconv.Itoa(i.Port)
+	if i.PortRange != "" {
+		port = fmt.Sprintf("\"%v\"", i.PortRange)
+	}
 	return &xray.InboundConfig{
 		Listen:         json_util.RawMessage(listen),
-		Port:           i.Port,
+		Port:           json_util.RawMessage(port),
 		Protocol:       string(i.Protocol),
 		Settings:       json_util.RawMessage(i.Settings),
 		StreamSettings: json_util.RawMessage(i.StreamSettings),
 		Tag:            i.Tag,
 		Sniffing:       json_util.RawMessage(i.Sniffing),
+		Allocate:       json_util.RawMessage(i.Allocate),
 	}
 }
 
@@ -72,10 +130,20 @@ type Client struct {
 	Password   string `json:"password"`
 	Flow       string `json:"flow"`
 	Email      string `json:"email"`
+	LimitIP    int    `json:"limitIp" form:"limitIp"`
 	TotalGB    int64  `json:"totalGB" form:"totalGB"`
 	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`
 	Enable     bool   `json:"enable" form:"enable"`
 	TgID       string `json:"tgId" form:"tgId"`
 	SubID      string `json:"subId" form:"subId"`
 	Reset      int    `json:"reset" form:"reset"`
+	Outbound   string `json:"outbound" form:"outbound"`
+	Group      string `json:"group" form:"group"`
+	ResetDay   int    `json:"resetDay" form:"resetDay"`
+	// percent of the traffic limit that triggers an alert, 0 uses the global one
+	TrafficAlert int `json:"trafficAlert" form:"trafficAlert"`
+	// percent of the traffic limit usable beyond it before the client is disabled, 0 uses the global one
+	TrafficGrace int `json:"trafficGrace" form:"trafficGrace"`
+	// created by CreateTrialClient, only set when the client is added
+	Trial bool `json:"trial,omitempty" form:"trial"`
 }
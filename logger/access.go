@@ -0,0 +1,156 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessLog writes the panel access log to a file, which is rotated to
+// <path>.<date> at the first write of a new day
+type accessLog struct {
+	lock      sync.Mutex
+	path      string
+	retention int
+	file      *os.File
+	day       string
+}
+
+var access *accessLog
+
+// InitAccessLog enables the access log at path, keeping the rotated files of the last
+// retention days (0 = keep all). An empty path disables it.
+func InitAccessLog(path string, retention int) error {
+	if access != nil {
+		access.close()
+		access = nil
+	}
+	if path == "" {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	a := &accessLog{path: path, retention: retention}
+	err = a.open()
+	if err != nil {
+		return err
+	}
+	access = a
+	return nil
+}
+
+func IsAccessLogEnabled() bool {
+	return access != nil
+}
+
+// Access writes one line to the access log if it is enabled
+func Access(format string, args ...interface{}) {
+	if access == nil {
+		return
+	}
+	access.write(time.Now(), fmt.Sprintf(format, args...))
+}
+
+// GetAccessLogs returns the last c lines of the current access log file, newest first
+func GetAccessLogs(c int) []string {
+	if access == nil {
+		return []string{"Access log is disabled"}
+	}
+	if c <= 0 {
+		return []string{}
+	}
+	access.lock.Lock()
+	defer access.lock.Unlock()
+
+	file, err := os.Open(access.path)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	defer file.Close()
+
+	lines := make([]string, 0, c)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(lines) >= c {
+			lines = lines[1:]
+		}
+		lines = append(lines, scanner.Text())
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+func (a *accessLog) open() error {
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return err
+	}
+	a.file = file
+	a.day = time.Now().Format("2006-01-02")
+	if info, err := file.Stat(); err == nil {
+		a.day = info.ModTime().Format("2006-01-02")
+	}
+	return nil
+}
+
+func (a *accessLog) close() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+}
+
+func (a *accessLog) write(t time.Time, line string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.file == nil {
+		return
+	}
+	if day := t.Format("2006-01-02"); day != a.day {
+		a.rotate()
+	}
+	fmt.Fprintf(a.file, "%s %s\n", t.Format("2006/01/02 15:04:05"), line)
+}
+
+func (a *accessLog) rotate() {
+	a.file.Close()
+	a.file = nil
+	err := os.Rename(a.path, a.path+"."+a.day)
+	if err != nil && !os.IsNotExist(err) {
+		Warning("rotate access log failed:", err)
+	}
+	if err := a.open(); err != nil {
+		Warning("open access log failed:", err)
+		return
+	}
+	a.day = time.Now().Format("2006-01-02")
+	a.removeExpired()
+}
+
+// removeExpired deletes the rotated files older than the retention
+func (a *accessLog) removeExpired() {
+	if a.retention <= 0 {
+		return
+	}
+	files, err := filepath.Glob(a.path + ".*")
+	if err != nil {
+		return
+	}
+	oldest := time.Now().AddDate(0, 0, -a.retention).Format("2006-01-02")
+	for _, file := range files {
+		day := strings.TrimPrefix(file, a.path+".")
+		if _, err := time.Parse("2006-01-02", day); err == nil && day < oldest {
+			os.Remove(file)
+		}
+	}
+}
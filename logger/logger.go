@@ -3,6 +3,7 @@ package logger
 import (
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/op/go-logging"
@@ -15,8 +16,16 @@ var (
 		level logging.Level
 		log   string
 	}
+
+	subscribersLock sync.Mutex
+	subscribers     = map[*subscriber]struct{}{}
 )
 
+type subscriber struct {
+	match func(log string) bool
+	lines chan string
+}
+
 func init() {
 	InitLogger(logging.INFO)
 }
@@ -103,6 +112,33 @@ func addToBuffer(level string, newLog string) {
 		level: logLevel,
 		log:   newLog,
 	})
+
+	subscribersLock.Lock()
+	defer subscribersLock.Unlock()
+	for sub := range subscribers {
+		if !sub.match(newLog) {
+			continue
+		}
+		// a subscriber which does not keep up loses lines instead of blocking the logger
+		select {
+		case sub.lines <- fmt.Sprintf("%s %s - %s", t.Format("2006/01/02 15:04:05"), logLevel, newLog):
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the logs which match from now on, formatted like GetLogs.
+// The returned function ends the subscription and must be called once the channel is not read anymore.
+func Subscribe(match func(log string) bool, size int) (<-chan string, func()) {
+	sub := &subscriber{match: match, lines: make(chan string, size)}
+	subscribersLock.Lock()
+	subscribers[sub] = struct{}{}
+	subscribersLock.Unlock()
+	return sub.lines, func() {
+		subscribersLock.Lock()
+		delete(subscribers, sub)
+		subscribersLock.Unlock()
+	}
 }
 
 func GetLogs(c int, level string) []string {
@@ -116,3 +152,37 @@ func GetLogs(c int, level string) []string {
 	}
 	return output
 }
+
+// GetLogsMatching returns the last c logs of level which match, newest first,
+// each with up to context logs of the same level around it
+func GetLogsMatching(c int, level string, match func(log string) bool, context int) []string {
+	logLevel, _ := logging.LogLevel(level)
+
+	var indexes []int
+	for i := range logBuffer {
+		if logBuffer[i].level <= logLevel {
+			indexes = append(indexes, i)
+		}
+	}
+
+	included := make([]bool, len(indexes))
+	matches := 0
+	for i := len(indexes) - 1; i >= 0 && matches < c; i-- {
+		if !match(logBuffer[indexes[i]].log) {
+			continue
+		}
+		matches++
+		for j := max(i-context, 0); j <= i+context && j < len(indexes); j++ {
+			included[j] = true
+		}
+	}
+
+	var output []string
+	for i := len(indexes) - 1; i >= 0; i-- {
+		if included[i] {
+			entry := logBuffer[indexes[i]]
+			output = append(output, fmt.Sprintf("%s %s - %s", entry.time, entry.level, entry.log))
+		}
+	}
+	return output
+}
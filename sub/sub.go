@@ -102,11 +102,22 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		SubJsonRules = ""
 	}
 
+	SubSingboxTemplate, err := s.settingService.GetSubSingboxTemplate()
+	if err != nil {
+		SubSingboxTemplate = s.settingService.GetDefaultSubSingboxTemplate()
+	}
+
+	SubHeaders, err := s.settingService.GetSubHeaders()
+	if err != nil {
+		logger.Warning("invalid sub headers:", err)
+		SubHeaders = nil
+	}
+
 	g := engine.Group("/")
 
 	s.sub = NewSUBController(
 		g, LinksPath, JsonPath, Encrypt, ShowInfo, RemarkModel, SubUpdates,
-		SubJsonFragment, SubJsonMux, SubJsonRules)
+		SubJsonFragment, SubJsonMux, SubJsonRules, SubSingboxTemplate, SubHeaders)
 
 	return engine, nil
 }
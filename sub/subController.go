@@ -3,6 +3,12 @@ package sub
 import (
 	"encoding/base64"
 	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"x-ui/web/middleware"
+	"x-ui/web/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,9 +18,18 @@ type SUBController struct {
 	subJsonPath    string
 	subEncrypt     bool
 	updateInterval string
+	headers        map[string]string
+
+	subService        *SubService
+	subJsonService    *SubJsonService
+	subSingboxService *SubSingboxService
+	inboundService    service.InboundService
+}
 
-	subService     *SubService
-	subJsonService *SubJsonService
+// SubInfo is the usage and the links of a subscription for self-service portals
+type SubInfo struct {
+	*service.ClientStatus
+	Links []string `json:"links"`
 }
 
 func NewSUBController(
@@ -28,6 +43,8 @@ func NewSUBController(
 	jsonFragment string,
 	jsonMux string,
 	jsonRules string,
+	singboxTemplate string,
+	headers map[string]string,
 ) *SUBController {
 	sub := NewSubService(showInfo, rModel)
 	a := &SUBController{
@@ -35,9 +52,11 @@ func NewSUBController(
 		subJsonPath:    jsonPath,
 		subEncrypt:     encrypt,
 		updateInterval: update,
+		headers:        headers,
 
-		subService:     sub,
-		subJsonService: NewSubJsonService(jsonFragment, jsonMux, jsonRules, sub),
+		subService:        sub,
+		subJsonService:    NewSubJsonService(jsonFragment, jsonMux, jsonRules, sub),
+		subSingboxService: NewSubSingboxService(singboxTemplate, sub),
 	}
 	a.initRouter(g)
 	return a
@@ -48,11 +67,21 @@ func (a *SUBController) initRouter(g *gin.RouterGroup) {
 	gJson := g.Group(a.subJsonPath)
 
 	gLink.GET(":subid", a.subs)
+	gLink.GET("group/:subid", a.groupSubs)
+	// the subscription ID is the secret, limit guessing it
+	gLink.GET("info/:subid", middleware.RateLimitMiddleware(30, time.Minute), a.subInfo)
 
 	gJson.GET(":subid", a.subJsons)
 }
 
+func (a *SUBController) setCustomHeaders(c *gin.Context) {
+	for name, value := range a.headers {
+		c.Writer.Header().Set(name, value)
+	}
+}
+
 func (a *SUBController) subs(c *gin.Context) {
+	a.setCustomHeaders(c)
 	subId := c.Param("subid")
 	host, _, _ := net.SplitHostPort(c.Request.Host)
 	subs, header, err := a.subService.GetSubs(subId, host)
@@ -77,10 +106,62 @@ func (a *SUBController) subs(c *gin.Context) {
 	}
 }
 
+func (a *SUBController) groupSubs(c *gin.Context) {
+	a.setCustomHeaders(c)
+	subId := c.Param("subid")
+	host, _, _ := net.SplitHostPort(c.Request.Host)
+	subs, header, err := a.subService.GetGroupSubs(subId, host)
+	if err != nil || len(subs) == 0 {
+		c.String(400, "Error!")
+		return
+	}
+	result := strings.Join(subs, "\n") + "\n"
+	c.Writer.Header().Set("Subscription-Userinfo", header)
+	c.Writer.Header().Set("Profile-Update-Interval", a.updateInterval)
+	c.Writer.Header().Set("Profile-Title", subId)
+	if a.subEncrypt {
+		c.String(200, base64.StdEncoding.EncodeToString([]byte(result)))
+	} else {
+		c.String(200, result)
+	}
+}
+
+func (a *SUBController) subInfo(c *gin.Context) {
+	a.setCustomHeaders(c)
+	c.Writer.Header().Set("Cache-Control", "no-store")
+	subId := c.Param("subid")
+	status, err := a.inboundService.GetClientStatus(subId)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	host, _, _ := net.SplitHostPort(c.Request.Host)
+	links, _, err := a.subService.GetSubs(subId, host)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if links == nil {
+		links = []string{}
+	}
+	c.JSON(http.StatusOK, SubInfo{ClientStatus: status, Links: links})
+}
+
 func (a *SUBController) subJsons(c *gin.Context) {
+	a.setCustomHeaders(c)
 	subId := c.Param("subid")
 	host, _, _ := net.SplitHostPort(c.Request.Host)
-	jsonSub, header, err := a.subJsonService.GetJson(subId, host)
+	var jsonSub, header string
+	var err error
+	if c.Query("format") == "singbox" {
+		jsonSub, header, err = a.subSingboxService.GetSingbox(subId, host)
+	} else {
+		jsonSub, header, err = a.subJsonService.GetJson(subId, host)
+	}
 	if err != nil || len(jsonSub) == 0 {
 		c.String(400, "Error!")
 	} else {
@@ -0,0 +1,221 @@
+package sub
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/web/service"
+	"x-ui/xray"
+)
+
+var exportNameRegex = regexp.MustCompile(`[^a-zA-Z0-9._@+-]`)
+
+// exportFileName turns email into a safe file name, unique within used
+func exportFileName(email string, used map[string]bool) string {
+	name := exportNameRegex.ReplaceAllString(email, "_")
+	if name == "" || name[0] == '.' {
+		name = "_" + name
+	}
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = name + "-" + strconv.Itoa(i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// ExportClients writes a zip with one file per client of inbound to w as it goes. A file holds
+// the share link of the client, or its client config for protocols without share links.
+// Disabled clients are skipped unless includeDisabled is set.
+func ExportClients(w io.Writer, inbound *model.Inbound, host string, includeDisabled bool) error {
+	subService := newLinkSubService(host)
+
+	clients, err := subService.inboundService.GetClients(inbound)
+	if err != nil {
+		return err
+	}
+	err = database.GetDB().Model(xray.ClientTraffic{}).Where("inbound_id = ?", inbound.Id).Find(&inbound.ClientStats).Error
+	if err != nil {
+		return err
+	}
+	subService.useFallbackMaster(inbound)
+
+	archive := zip.NewWriter(w)
+	used := map[string]bool{}
+	for _, client := range clients {
+		if !includeDisabled {
+			traffic := subService.getClientTraffics(inbound.ClientStats, client.Email)
+			if !client.Enable || (traffic.Email != "" && !traffic.Enable) {
+				continue
+			}
+		}
+		var content []byte
+		name := exportFileName(client.Email, used)
+		if link := subService.getLink(inbound, client.Email); link != "" {
+			name += ".txt"
+			content = []byte(link + "\n")
+		} else {
+			name += ".json"
+			content, err = json.MarshalIndent(client, "", "  ")
+			if err != nil {
+				return err
+			}
+		}
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = file.Write(content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+type ClientLink struct {
+	Email string `json:"email"`
+	Link  string `json:"link"`
+}
+
+// newLinkSubService returns a SubService making links with the subscription settings and host as address
+func newLinkSubService(host string) *SubService {
+	settingService := service.SettingService{}
+	showInfo, _ := settingService.GetSubShowInfo()
+	remarkModel, err := settingService.GetRemarkModel()
+	if err != nil {
+		remarkModel = "-ieo"
+	}
+	subService := NewSubService(showInfo, remarkModel)
+	subService.address = host
+	return subService
+}
+
+// useFallbackMaster points a fallback inbound at the address and security of the inbound it is served by
+func (s *SubService) useFallbackMaster(inbound *model.Inbound) {
+	if len(inbound.Listen) > 0 && inbound.Listen[0] == '@' {
+		listen, port, streamSettings, err := s.getFallbackMaster(inbound.Listen, inbound.StreamSettings)
+		if err == nil {
+			inbound.Listen = listen
+			inbound.Port = port
+			inbound.StreamSettings = streamSettings
+		}
+	}
+}
+
+// ClientLinks returns the share links of the clients of inbound with emails
+func ClientLinks(inbound *model.Inbound, emails []string, host string) []*ClientLink {
+	subService := newLinkSubService(host)
+	subService.useFallbackMaster(inbound)
+
+	links := make([]*ClientLink, 0, len(emails))
+	for _, email := range emails {
+		links = append(links, &ClientLink{Email: email, Link: subService.getLink(inbound, email)})
+	}
+	return links
+}
+
+type TransportLink struct {
+	ClientLink
+	InboundId int    `json:"inboundId"`
+	Transport string `json:"transport"`
+}
+
+func inboundTransport(inbound *model.Inbound) string {
+	stream := struct {
+		Network string `json:"network"`
+	}{}
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	if stream.Network == "" {
+		return "tcp"
+	}
+	return stream.Network
+}
+
+// ClientTransportLink returns the share link of the client with email over transport. An empty
+// transport gives the link of the inbound of the client, otherwise the link is taken from the first
+// inbound with that transport among the inbounds the client shares its subscription ID with.
+func ClientTransportLink(email string, transport string, host string) (*TransportLink, error) {
+	inboundService := service.InboundService{}
+	traffic, err := inboundService.GetClientTrafficByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if traffic == nil {
+		return nil, common.NewError("client not found:", email)
+	}
+	inbound := &model.Inbound{}
+	err = database.GetDB().Model(model.Inbound{}).Preload("ClientStats").Where("id = ?", traffic.InboundId).First(inbound).Error
+	if err != nil {
+		return nil, err
+	}
+	clients, err := inboundService.GetClients(inbound)
+	if err != nil {
+		return nil, err
+	}
+	var subId string
+	for _, client := range clients {
+		if client.Email == email {
+			subId = client.SubID
+			break
+		}
+	}
+
+	type candidate struct {
+		inbound *model.Inbound
+		email   string
+	}
+	candidates := []candidate{{inbound, email}}
+	subService := newLinkSubService(host)
+	if transport != "" && subId != "" {
+		inbounds, err := subService.getInboundsBySubId(subId)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range inbounds {
+			if other.Id == inbound.Id {
+				continue
+			}
+			clients, err := inboundService.GetClients(other)
+			if err != nil {
+				continue
+			}
+			for _, client := range clients {
+				if client.Enable && client.SubID == subId {
+					candidates = append(candidates, candidate{other, client.Email})
+					break
+				}
+			}
+		}
+	}
+
+	available := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		// the transport of a fallback inbound is its own, not the one of its master
+		network := inboundTransport(c.inbound)
+		if transport != "" && network != transport {
+			if !slices.Contains(available, network) {
+				available = append(available, network)
+			}
+			continue
+		}
+		subService.useFallbackMaster(c.inbound)
+		link := subService.getLink(c.inbound, c.email)
+		if link == "" {
+			return nil, common.NewErrorf("%s inbounds have no share links", c.inbound.Protocol)
+		}
+		return &TransportLink{
+			ClientLink: ClientLink{Email: c.email, Link: link},
+			InboundId:  c.inbound.Id,
+			Transport:  network,
+		}, nil
+	}
+	return nil, common.NewErrorf("transport %s is not available for %s, available: %s", transport, email, strings.Join(available, ", "))
+}
@@ -0,0 +1,63 @@
+package sub
+
+import (
+	"strings"
+
+	"x-ui/util/common"
+	"x-ui/web/service"
+)
+
+type SubPreview struct {
+	SubId    string `json:"subId"`
+	Format   string `json:"format"`
+	UserInfo string `json:"userInfo"`
+	Content  string `json:"content"`
+}
+
+// Preview renders the subscription of subId the same way the subscription server does,
+// but without the base64 encoding and headers, so it can be inspected from the panel.
+// format is either "links" (default) or "json".
+func Preview(subId string, format string, host string) (*SubPreview, error) {
+	settingService := service.SettingService{}
+	showInfo, err := settingService.GetSubShowInfo()
+	if err != nil {
+		return nil, err
+	}
+	remarkModel, err := settingService.GetRemarkModel()
+	if err != nil {
+		remarkModel = "-ieo"
+	}
+	subService := NewSubService(showInfo, remarkModel)
+
+	preview := &SubPreview{
+		SubId:  subId,
+		Format: format,
+	}
+	switch format {
+	case "", "links":
+		preview.Format = "links"
+		subs, header, err := subService.GetSubs(subId, host)
+		if err != nil {
+			return nil, err
+		}
+		preview.UserInfo = header
+		preview.Content = strings.Join(subs, "\n")
+	case "json":
+		fragment, _ := settingService.GetSubJsonFragment()
+		mux, _ := settingService.GetSubJsonMux()
+		rules, _ := settingService.GetSubJsonRules()
+		subJsonService := NewSubJsonService(fragment, mux, rules, subService)
+		jsonSub, header, err := subJsonService.GetJson(subId, host)
+		if err != nil {
+			return nil, err
+		}
+		preview.UserInfo = header
+		preview.Content = jsonSub
+	default:
+		return nil, common.NewError("unknown subscription format:", format)
+	}
+	if preview.Content == "" {
+		return nil, common.NewError("no subscription found for id:", subId)
+	}
+	return preview, nil
+}
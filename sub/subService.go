@@ -36,8 +36,6 @@ func NewSubService(showInfo bool, remarkModel string) *SubService {
 func (s *SubService) GetSubs(subId string, host string) ([]string, string, error) {
 	s.address = host
 	var result []string
-	var header string
-	var traffic xray.ClientTraffic
 	var clientTraffics []xray.ClientTraffic
 	inbounds, err := s.getInboundsBySubId(subId)
 	if err != nil {
@@ -70,7 +68,71 @@ func (s *SubService) GetSubs(subId string, host string) ([]string, string, error
 		}
 	}
 
-	// Prepare statistics
+	return result, trafficHeader(clientTraffics), nil
+}
+
+// GetGroupSubs returns the links of the enabled clients of the subscription group with subId,
+// leaving out the clients that are expired or disabled for their traffic
+func (s *SubService) GetGroupSubs(subId string, host string) ([]string, string, error) {
+	s.address = host
+	group, err := s.inboundService.GetSubGroupBySubId(subId)
+	if err != nil {
+		return nil, "", err
+	}
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err = db.Model(model.Inbound{}).Preload("ClientStats").Where(`id in (
+		SELECT DISTINCT inbounds.id
+		FROM inbounds,
+			JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client
+		WHERE
+			protocol in ('vmess','vless','trojan','shadowsocks')
+			AND LOWER(TRIM(JSON_EXTRACT(client.value, '$.group'))) = LOWER(?) AND enable = ?
+	)`, group.Name, true).Find(&inbounds).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	var result []string
+	var clientTraffics []xray.ClientTraffic
+	now := time.Now().UnixMilli()
+	for _, inbound := range inbounds {
+		clients, err := s.inboundService.GetClients(inbound)
+		if err != nil {
+			logger.Error("SubService - GetClients: Unable to get clients from inbound")
+		}
+		if clients == nil {
+			continue
+		}
+		if len(inbound.Listen) > 0 && inbound.Listen[0] == '@' {
+			listen, port, streamSettings, err := s.getFallbackMaster(inbound.Listen, inbound.StreamSettings)
+			if err == nil {
+				inbound.Listen = listen
+				inbound.Port = port
+				inbound.StreamSettings = streamSettings
+			}
+		}
+		for _, client := range clients {
+			if !client.Enable || !strings.EqualFold(strings.TrimSpace(client.Group), group.Name) {
+				continue
+			}
+			traffic := s.getClientTraffics(inbound.ClientStats, client.Email)
+			// a negative expiry starts counting at the first use, the traffic limit is left to
+			// the traffic monitor which disables the client after its grace
+			if traffic.Email != "" && (!traffic.Enable || (traffic.ExpiryTime > 0 && traffic.ExpiryTime <= now)) {
+				continue
+			}
+			result = append(result, s.getLink(inbound, client.Email))
+			clientTraffics = append(clientTraffics, traffic)
+		}
+	}
+	return result, trafficHeader(clientTraffics), nil
+}
+
+// trafficHeader sums the traffic of the clients of a subscription into its userinfo header,
+// the total and the expiry are 0 unless all clients have one
+func trafficHeader(clientTraffics []xray.ClientTraffic) string {
+	var traffic xray.ClientTraffic
 	for index, clientTraffic := range clientTraffics {
 		if index == 0 {
 			traffic.Up = clientTraffic.Up
@@ -92,8 +154,7 @@ func (s *SubService) GetSubs(subId string, host string) ([]string, string, error
 			}
 		}
 	}
-	header = fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", traffic.Up, traffic.Down, traffic.Total, traffic.ExpiryTime/1000)
-	return result, header, nil
+	return fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", traffic.Up, traffic.Down, traffic.Total, traffic.ExpiryTime/1000)
 }
 
 func (s *SubService) getInboundsBySubId(subId string) ([]*model.Inbound, error) {
@@ -0,0 +1,333 @@
+package sub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/random"
+	"x-ui/web/service"
+	"x-ui/xray"
+)
+
+type SubSingboxService struct {
+	template string
+
+	inboundService service.InboundService
+	SubService     *SubService
+}
+
+func NewSubSingboxService(template string, subService *SubService) *SubSingboxService {
+	if err := service.CheckSingboxTemplate(template); err != nil {
+		logger.Warning("invalid sing-box template, using the built-in one:", err)
+		settingService := service.SettingService{}
+		template = settingService.GetDefaultSubSingboxTemplate()
+	}
+	return &SubSingboxService{
+		template:   template,
+		SubService: subService,
+	}
+}
+
+// GetSingbox returns a sing-box profile with the outbounds of the clients of subId filled into the template
+func (s *SubSingboxService) GetSingbox(subId string, host string) (string, string, error) {
+	inbounds, err := s.SubService.getInboundsBySubId(subId)
+	if err != nil || len(inbounds) == 0 {
+		return "", "", err
+	}
+
+	var header string
+	var traffic xray.ClientTraffic
+	var clientTraffics []xray.ClientTraffic
+	var outbounds []interface{}
+	var tags []interface{}
+	usedTags := make(map[string]bool)
+
+	// Prepare Inbounds
+	for _, inbound := range inbounds {
+		clients, err := s.inboundService.GetClients(inbound)
+		if err != nil {
+			logger.Error("SubSingboxService - GetClients: Unable to get clients from inbound")
+		}
+		if clients == nil {
+			continue
+		}
+		if len(inbound.Listen) > 0 && inbound.Listen[0] == '@' {
+			listen, port, streamSettings, err := s.SubService.getFallbackMaster(inbound.Listen, inbound.StreamSettings)
+			if err == nil {
+				inbound.Listen = listen
+				inbound.Port = port
+				inbound.StreamSettings = streamSettings
+			}
+		}
+
+		for _, client := range clients {
+			if client.Enable && client.SubID == subId {
+				clientTraffics = append(clientTraffics, s.SubService.getClientTraffics(inbound.ClientStats, client.Email))
+				for _, outbound := range s.getOutbounds(inbound, client, host) {
+					// sing-box rejects duplicate tags
+					tag := outbound["tag"].(string)
+					for i := 2; usedTags[tag]; i++ {
+						tag = fmt.Sprintf("%s %d", outbound["tag"], i)
+					}
+					usedTags[tag] = true
+					outbound["tag"] = tag
+					outbounds = append(outbounds, outbound)
+					tags = append(tags, tag)
+				}
+			}
+		}
+	}
+
+	if len(outbounds) == 0 {
+		return "", "", nil
+	}
+
+	// Prepare statistics
+	for index, clientTraffic := range clientTraffics {
+		if index == 0 {
+			traffic.Up = clientTraffic.Up
+			traffic.Down = clientTraffic.Down
+			traffic.Total = clientTraffic.Total
+			if clientTraffic.ExpiryTime > 0 {
+				traffic.ExpiryTime = clientTraffic.ExpiryTime
+			}
+		} else {
+			traffic.Up += clientTraffic.Up
+			traffic.Down += clientTraffic.Down
+			if traffic.Total == 0 || clientTraffic.Total == 0 {
+				traffic.Total = 0
+			} else {
+				traffic.Total += clientTraffic.Total
+			}
+			if clientTraffic.ExpiryTime != traffic.ExpiryTime {
+				traffic.ExpiryTime = 0
+			}
+		}
+	}
+
+	var config map[string]interface{}
+	err = json.Unmarshal([]byte(s.template), &config)
+	if err != nil {
+		return "", "", err
+	}
+	config = fillSingboxTemplate(config, outbounds, tags).(map[string]interface{})
+	finalJson, _ := json.MarshalIndent(config, "", "  ")
+
+	header = fmt.Sprintf("upload=%d; download=%d; total=%d; expire=%d", traffic.Up, traffic.Down, traffic.Total, traffic.ExpiryTime/1000)
+	return string(finalJson), header, nil
+}
+
+// fillSingboxTemplate replaces the placeholder elements of all arrays in value
+func fillSingboxTemplate(value interface{}, outbounds []interface{}, tags []interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = fillSingboxTemplate(item, outbounds, tags)
+		}
+		return value
+	case []interface{}:
+		filled := make([]interface{}, 0, len(value))
+		for _, item := range value {
+			switch item {
+			case service.SingboxOutbounds:
+				filled = append(filled, outbounds...)
+			case service.SingboxTags:
+				filled = append(filled, tags...)
+			default:
+				filled = append(filled, fillSingboxTemplate(item, outbounds, tags))
+			}
+		}
+		return filled
+	}
+	return value
+}
+
+func (s *SubSingboxService) getOutbounds(inbound *model.Inbound, client model.Client, host string) []map[string]interface{} {
+	var stream map[string]interface{}
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+
+	transport, ok := singboxTransport(stream)
+	if !ok {
+		logger.Debug("SubSingboxService - transport is not supported by sing-box:", stream["network"])
+		return nil
+	}
+
+	externalProxies, ok := stream["externalProxy"].([]interface{})
+	if !ok || len(externalProxies) == 0 {
+		externalProxies = []interface{}{
+			map[string]interface{}{
+				"forceTls": "same",
+				"dest":     host,
+				"port":     float64(inbound.Port),
+				"remark":   "",
+			},
+		}
+	}
+
+	var outbounds []map[string]interface{}
+	for _, ep := range externalProxies {
+		extPrxy := ep.(map[string]interface{})
+		outbound := map[string]interface{}{
+			"tag":         s.SubService.genRemark(inbound, client.Email, extPrxy["remark"].(string)),
+			"server":      extPrxy["dest"].(string),
+			"server_port": int(extPrxy["port"].(float64)),
+		}
+
+		switch inbound.Protocol {
+		case model.VMess:
+			outbound["type"] = "vmess"
+			outbound["uuid"] = client.ID
+			outbound["security"] = "auto"
+		case model.VLESS:
+			outbound["type"] = "vless"
+			outbound["uuid"] = client.ID
+			if client.Flow != "" {
+				outbound["flow"] = client.Flow
+			}
+		case model.Trojan:
+			outbound["type"] = "trojan"
+			outbound["password"] = client.Password
+		case model.Shadowsocks:
+			var inboundSettings map[string]interface{}
+			json.Unmarshal([]byte(inbound.Settings), &inboundSettings)
+			method, _ := inboundSettings["method"].(string)
+			outbound["type"] = "shadowsocks"
+			outbound["method"] = method
+			outbound["password"] = client.Password
+			// server password in multi-user 2022 protocols
+			if strings.HasPrefix(method, "2022") {
+				if serverPassword, ok := inboundSettings["password"].(string); ok {
+					outbound["password"] = fmt.Sprintf("%s:%s", serverPassword, client.Password)
+				}
+			}
+		default:
+			return nil
+		}
+
+		if transport != nil {
+			outbound["transport"] = transport
+		}
+		security, _ := stream["security"].(string)
+		switch extPrxy["forceTls"].(string) {
+		case "tls":
+			if security != "tls" {
+				security = "tls"
+				stream["tlsSettings"] = map[string]interface{}{}
+			}
+		case "none":
+			security = "none"
+		}
+		if tls := singboxTLS(security, stream); tls != nil {
+			outbound["tls"] = tls
+		}
+		outbounds = append(outbounds, outbound)
+	}
+	return outbounds
+}
+
+// singboxTransport returns the v2ray transport of stream, nil for plain tcp and
+// false when sing-box has no such transport
+func singboxTransport(stream map[string]interface{}) (map[string]interface{}, bool) {
+	network, _ := stream["network"].(string)
+	switch network {
+	case "tcp":
+		tcp, _ := stream["tcpSettings"].(map[string]interface{})
+		header, _ := tcp["header"].(map[string]interface{})
+		if headerType, _ := header["type"].(string); headerType == "http" {
+			request, _ := header["request"].(map[string]interface{})
+			transport := map[string]interface{}{"type": "http"}
+			if paths, ok := request["path"].([]interface{}); ok && len(paths) > 0 {
+				transport["path"] = paths[0]
+			}
+			if host := searchHost(request["headers"]); host != "" {
+				transport["host"] = []string{host}
+			}
+			return transport, true
+		}
+		return nil, true
+	case "ws":
+		ws, _ := stream["wsSettings"].(map[string]interface{})
+		transport := map[string]interface{}{"type": "ws"}
+		transport["path"], _ = ws["path"].(string)
+		host, _ := ws["host"].(string)
+		if host == "" {
+			host = searchHost(ws["headers"])
+		}
+		if host != "" {
+			transport["headers"] = map[string]interface{}{"Host": host}
+		}
+		return transport, true
+	case "http":
+		http, _ := stream["httpSettings"].(map[string]interface{})
+		transport := map[string]interface{}{"type": "http"}
+		transport["path"], _ = http["path"].(string)
+		if host := searchHost(http); host != "" {
+			transport["host"] = []string{host}
+		}
+		return transport, true
+	case "grpc":
+		grpc, _ := stream["grpcSettings"].(map[string]interface{})
+		transport := map[string]interface{}{"type": "grpc"}
+		transport["service_name"], _ = grpc["serviceName"].(string)
+		return transport, true
+	case "httpupgrade":
+		httpupgrade, _ := stream["httpupgradeSettings"].(map[string]interface{})
+		transport := map[string]interface{}{"type": "httpupgrade"}
+		transport["path"], _ = httpupgrade["path"].(string)
+		host, _ := httpupgrade["host"].(string)
+		if host == "" {
+			host = searchHost(httpupgrade["headers"])
+		}
+		if host != "" {
+			transport["host"] = host
+		}
+		return transport, true
+	}
+	return nil, false
+}
+
+func singboxTLS(security string, stream map[string]interface{}) map[string]interface{} {
+	switch security {
+	case "tls":
+		tlsSettings, _ := stream["tlsSettings"].(map[string]interface{})
+		clientSettings, _ := tlsSettings["settings"].(map[string]interface{})
+		tls := map[string]interface{}{"enabled": true}
+		if serverName, _ := tlsSettings["serverName"].(string); serverName != "" {
+			tls["server_name"] = serverName
+		}
+		if alpn, ok := tlsSettings["alpn"].([]interface{}); ok && len(alpn) > 0 {
+			tls["alpn"] = alpn
+		}
+		if allowInsecure, _ := clientSettings["allowInsecure"].(bool); allowInsecure {
+			tls["insecure"] = true
+		}
+		if fingerprint, _ := clientSettings["fingerprint"].(string); fingerprint != "" {
+			tls["utls"] = map[string]interface{}{"enabled": true, "fingerprint": fingerprint}
+		}
+		return tls
+	case "reality":
+		realitySettings, _ := stream["realitySettings"].(map[string]interface{})
+		clientSettings, _ := realitySettings["settings"].(map[string]interface{})
+		tls := map[string]interface{}{"enabled": true}
+		if serverNames, ok := realitySettings["serverNames"].([]interface{}); ok && len(serverNames) > 0 {
+			tls["server_name"] = serverNames[random.Num(len(serverNames))]
+		}
+		// reality needs utls in sing-box
+		fingerprint, _ := clientSettings["fingerprint"].(string)
+		if fingerprint == "" {
+			fingerprint = "chrome"
+		}
+		tls["utls"] = map[string]interface{}{"enabled": true, "fingerprint": fingerprint}
+		reality := map[string]interface{}{"enabled": true}
+		reality["public_key"], _ = clientSettings["publicKey"].(string)
+		if shortIds, ok := realitySettings["shortIds"].([]interface{}); ok && len(shortIds) > 0 {
+			reality["short_id"] = shortIds[random.Num(len(shortIds))]
+		}
+		tls["reality"] = reality
+		return tls
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package common
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var FilenameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-.]+$`)
+
+// FormatFilename fills the {host}, {date} and {time} placeholders of template
+func FormatFilename(template string, now time.Time) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return strings.NewReplacer(
+		"{host}", host,
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+	).Replace(template)
+}
+
+// IsValidFilename reports whether name is a plain file name without path or hidden file parts
+func IsValidFilename(name string) bool {
+	return FilenameRegex.MatchString(name) && !strings.HasPrefix(name, ".")
+}
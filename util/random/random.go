@@ -47,3 +47,13 @@ func Seq(n int) string {
 func Num(n int) int {
 	return rand.Intn(n)
 }
+
+// SeqOf returns n characters picked at random from charset
+func SeqOf(charset string, n int) string {
+	chars := []rune(charset)
+	runes := make([]rune, n)
+	for i := 0; i < n; i++ {
+		runes[i] = chars[rand.Intn(len(chars))]
+	}
+	return string(runes)
+}
@@ -17,6 +17,10 @@ class DBInbound {
         this.streamSettings = "";
         this.tag = "";
         this.sniffing = "";
+        this.portRange = "";
+        this.allocate = "";
+        this.connIdle = 0;
+        this.maxClients = 0;
         this.clientStats = ""
         if (data == null) {
             return;
@@ -3,14 +3,43 @@ class AllSetting {
     constructor(data) {
         this.webListen = "";
         this.webDomain = "";
+        this.trustedProxies = "127.0.0.1,::1";
         this.webPort = 54321;
         this.webCertFile = "";
         this.webKeyFile = "";
+        this.webSelfSigned = false;
         this.webBasePath = "/";
         this.sessionMaxAge = "";
+        this.sessionIdleTimeout = 0;
+        this.rememberMeDays = 30;
         this.pageSize = 0;
+        this.maxUploadSize = 100;
+        this.metricsToken = "";
+        this.metricsClients = true;
+        this.xrayWatchdog = true;
+        this.xrayWatchdogMax = 5;
+        this.backupFilename = "x-ui.db";
+        this.geoUpdateInterval = 0;
+        this.geoUpdateSource = "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download";
+        this.xrayVersionRetries = 3;
+        this.xrayVersionTimeout = 10;
+        this.xrayDownloadConns = 1;
+        this.panelDns = "";
+        this.panelProxy = "";
+        this.inboundBind = "";
+        this.blockedLog = false;
+        this.maxConcurrentReqs = 0;
+        this.loginRetention = 30;
+        this.trafficRetention = 90;
+        this.accessLogEnable = false;
+        this.accessLogRetention = 7;
         this.expireDiff = "";
         this.trafficDiff = "";
+        this.trafficAlert = 0;
+        this.trafficGrace = 0;
+        this.trialTraffic = 1024;
+        this.trialDuration = 24;
+        this.trialPerIp = 0;
         this.remarkModel = "-ieo";
         this.tgBotEnable = false;
         this.tgBotToken = "";
@@ -20,6 +49,14 @@ class AllSetting {
         this.tgBotLoginNotify = false;
         this.tgCpu = "";
         this.tgLang = "";
+        this.emailEnable = false;
+        this.smtpHost = "";
+        this.smtpPort = 587;
+        this.smtpSecurity = "starttls";
+        this.smtpUsername = "";
+        this.smtpPassword = "";
+        this.emailFrom = "";
+        this.emailTo = "";
         this.subEnable = false;
         this.subListen = "";
         this.subPort = "2096";
@@ -36,6 +73,7 @@ class AllSetting {
         this.subJsonFragment = "";
         this.subJsonMux = "";
         this.subJsonRules = "";
+        this.subHeaders = "";
 
         this.timeLocation = "Asia/Tehran";
 
@@ -727,12 +727,20 @@ RealityStreamSettings.Settings = class extends XrayCommonClass {
 };
 
 class SockoptStreamSettings extends XrayCommonClass {
-    constructor(acceptProxyProtocol = false, tcpFastOpen = false, mark = 0, tproxy="off") {
+    constructor(acceptProxyProtocol = false, tcpFastOpen = false, mark = 0, tproxy="off", tcpKeepAliveIdle = 0, tcpKeepAliveInterval = 0,
+                tcpMptcp = false, tcpCongestion = "", tcpMaxSeg = 0, tcpWindowClamp = 0, tcpUserTimeout = 0) {
         super();
         this.acceptProxyProtocol = acceptProxyProtocol;
         this.tcpFastOpen = tcpFastOpen;
         this.mark = mark;
         this.tproxy = tproxy;
+        this.tcpKeepAliveIdle = tcpKeepAliveIdle;
+        this.tcpKeepAliveInterval = tcpKeepAliveInterval;
+        this.tcpMptcp = tcpMptcp;
+        this.tcpCongestion = tcpCongestion;
+        this.tcpMaxSeg = tcpMaxSeg;
+        this.tcpWindowClamp = tcpWindowClamp;
+        this.tcpUserTimeout = tcpUserTimeout;
     }
 
     static fromJson(json = {}) {
@@ -742,6 +750,13 @@ class SockoptStreamSettings extends XrayCommonClass {
             json.tcpFastOpen,
             json.mark,
             json.tproxy,
+            json.tcpKeepAliveIdle,
+            json.tcpKeepAliveInterval,
+            json.tcpMptcp,
+            json.tcpCongestion,
+            json.tcpMaxSeg,
+            json.tcpWindowClamp,
+            json.tcpUserTimeout,
         );
     }
 
@@ -751,6 +766,13 @@ class SockoptStreamSettings extends XrayCommonClass {
             tcpFastOpen: this.tcpFastOpen,
             mark: this.mark,
             tproxy: this.tproxy,
+            tcpKeepAliveIdle: this.tcpKeepAliveIdle,
+            tcpKeepAliveInterval: this.tcpKeepAliveInterval,
+            tcpMptcp: this.tcpMptcp || undefined,
+            tcpCongestion: this.tcpCongestion || undefined,
+            tcpMaxSeg: this.tcpMaxSeg || undefined,
+            tcpWindowClamp: this.tcpWindowClamp || undefined,
+            tcpUserTimeout: this.tcpUserTimeout || undefined,
         };
     }
 }
@@ -1670,7 +1692,7 @@ Inbound.VmessSettings = class extends Inbound.Settings {
     }
 };
 Inbound.VmessSettings.Vmess = class extends XrayCommonClass {
-    constructor(id=RandomUtil.randomUUID(), email=RandomUtil.randomLowerAndNum(9), totalGB=0, expiryTime=0, enable=true, tgId='', subId=RandomUtil.randomLowerAndNum(16), reset=0) {
+    constructor(id=RandomUtil.randomUUID(), email=RandomUtil.randomLowerAndNum(9), totalGB=0, expiryTime=0, enable=true, tgId='', subId=RandomUtil.randomLowerAndNum(16), reset=0, outbound='', limitIp=0, group='', resetDay=0, trafficAlert=0, trafficGrace=0) {
         super();
         this.id = id;
         this.email = email;
@@ -1680,6 +1702,12 @@ Inbound.VmessSettings.Vmess = class extends XrayCommonClass {
         this.tgId = tgId;
         this.subId = subId;
         this.reset = reset;
+        this.trafficAlert = trafficAlert;
+        this.trafficGrace = trafficGrace;
+        this.resetDay = resetDay;
+        this.group = group;
+        this.limitIp = limitIp;
+        this.outbound = outbound;
     }
 
     static fromJson(json={}) {
@@ -1692,6 +1720,12 @@ Inbound.VmessSettings.Vmess = class extends XrayCommonClass {
             json.tgId,
             json.subId,
             json.reset,
+            json.outbound,
+            json.limitIp,
+            json.group,
+            json.resetDay,
+            json.trafficAlert,
+            json.trafficGrace,
         );
     }
     get _expiryTime() {
@@ -1760,7 +1794,7 @@ Inbound.VLESSSettings = class extends Inbound.Settings {
 
 };
 Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
-    constructor(id=RandomUtil.randomUUID(), flow='', email=RandomUtil.randomLowerAndNum(9), totalGB=0, expiryTime=0, enable=true, tgId='', subId=RandomUtil.randomLowerAndNum(16), reset=0) {
+    constructor(id=RandomUtil.randomUUID(), flow='', email=RandomUtil.randomLowerAndNum(9), totalGB=0, expiryTime=0, enable=true, tgId='', subId=RandomUtil.randomLowerAndNum(16), reset=0, outbound='', limitIp=0, group='', resetDay=0, trafficAlert=0, trafficGrace=0) {
         super();
         this.id = id;
         this.flow = flow;
@@ -1771,6 +1805,12 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
         this.tgId = tgId;
         this.subId = subId;
         this.reset = reset;
+        this.trafficAlert = trafficAlert;
+        this.trafficGrace = trafficGrace;
+        this.resetDay = resetDay;
+        this.group = group;
+        this.limitIp = limitIp;
+        this.outbound = outbound;
     }
 
     static fromJson(json={}) {
@@ -1784,6 +1824,12 @@ Inbound.VLESSSettings.VLESS = class extends XrayCommonClass {
             json.tgId,
             json.subId,
             json.reset,
+            json.outbound,
+            json.limitIp,
+            json.group,
+            json.resetDay,
+            json.trafficAlert,
+            json.trafficGrace,
         );
       }
 
@@ -1883,7 +1929,7 @@ Inbound.TrojanSettings = class extends Inbound.Settings {
     }
 };
 Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
-    constructor(password=RandomUtil.randomSeq(10), email=RandomUtil.randomLowerAndNum(9), totalGB=0, expiryTime=0, enable=true, tgId='', subId=RandomUtil.randomLowerAndNum(16), reset=0) {
+    constructor(password=RandomUtil.randomSeq(10), email=RandomUtil.randomLowerAndNum(9), totalGB=0, expiryTime=0, enable=true, tgId='', subId=RandomUtil.randomLowerAndNum(16), reset=0, outbound='', limitIp=0, group='', resetDay=0, trafficAlert=0, trafficGrace=0) {
         super();
         this.password = password;
         this.email = email;
@@ -1893,6 +1939,12 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
         this.tgId = tgId;
         this.subId = subId;
         this.reset = reset;
+        this.trafficAlert = trafficAlert;
+        this.trafficGrace = trafficGrace;
+        this.resetDay = resetDay;
+        this.group = group;
+        this.limitIp = limitIp;
+        this.outbound = outbound;
     }
 
     toJson() {
@@ -1905,6 +1957,12 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
             tgId: this.tgId,
             subId: this.subId,
             reset: this.reset,
+            outbound: this.outbound,
+            limitIp: this.limitIp,
+            group: this.group,
+            resetDay: this.resetDay,
+            trafficAlert: this.trafficAlert,
+            trafficGrace: this.trafficGrace,
         };
     }
 
@@ -1918,6 +1976,12 @@ Inbound.TrojanSettings.Trojan = class extends XrayCommonClass {
             json.tgId,
             json.subId,
             json.reset,
+            json.outbound,
+            json.limitIp,
+            json.group,
+            json.resetDay,
+            json.trafficAlert,
+            json.trafficGrace,
         );
     }
 
@@ -2022,7 +2086,7 @@ Inbound.ShadowsocksSettings = class extends Inbound.Settings {
 };
 
 Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
-    constructor(method='', password=RandomUtil.randomShadowsocksPassword(), email=RandomUtil.randomLowerAndNum(9), totalGB=0, expiryTime=0, enable=true, tgId='', subId=RandomUtil.randomLowerAndNum(16), reset=0) {
+    constructor(method='', password=RandomUtil.randomShadowsocksPassword(), email=RandomUtil.randomLowerAndNum(9), totalGB=0, expiryTime=0, enable=true, tgId='', subId=RandomUtil.randomLowerAndNum(16), reset=0, outbound='', limitIp=0, group='', resetDay=0, trafficAlert=0, trafficGrace=0) {
         super();
         this.method = method;
         this.password = password;
@@ -2033,6 +2097,12 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
         this.tgId = tgId;
         this.subId = subId;
         this.reset = reset;
+        this.trafficAlert = trafficAlert;
+        this.trafficGrace = trafficGrace;
+        this.resetDay = resetDay;
+        this.group = group;
+        this.limitIp = limitIp;
+        this.outbound = outbound;
     }
 
     toJson() {
@@ -2046,6 +2116,12 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
             tgId: this.tgId,
             subId: this.subId,
             reset: this.reset,
+            outbound: this.outbound,
+            limitIp: this.limitIp,
+            group: this.group,
+            resetDay: this.resetDay,
+            trafficAlert: this.trafficAlert,
+            trafficGrace: this.trafficGrace,
         };
     }
 
@@ -2060,6 +2136,12 @@ Inbound.ShadowsocksSettings.Shadowsocks = class extends XrayCommonClass {
             json.tgId,
             json.subId,
             json.reset,
+            json.outbound,
+            json.limitIp,
+            json.group,
+            json.resetDay,
+            json.trafficAlert,
+            json.trafficGrace,
         );
     }
 
@@ -2,17 +2,23 @@ package controller
 
 import (
 	"net/http"
+	"time"
 
 	"x-ui/logger"
 	"x-ui/web/locale"
+	"x-ui/web/service"
 	"x-ui/web/session"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
 )
 
 type BaseController struct{}
 
 func (a *BaseController) checkLogin(c *gin.Context) {
+	settingService := service.SettingService{}
+	idleTimeout, _ := settingService.GetSessionIdleTimeout()
+	session.CheckExpiry(c, time.Duration(idleTimeout)*time.Minute)
 	if !session.IsLogin(c) {
 		if isAjax(c) {
 			pureJsonMsg(c, http.StatusUnauthorized, false, I18nWeb(c, "pages.login.loginAgain"))
@@ -26,6 +32,11 @@ func (a *BaseController) checkLogin(c *gin.Context) {
 }
 
 func I18nWeb(c *gin.Context, name string, params ...string) string {
+	if anyLocalizer, exists := c.Get("localizer"); exists {
+		if localizer, ok := anyLocalizer.(*i18n.Localizer); ok {
+			return locale.Localize(localizer, name, params...)
+		}
+	}
 	anyfunc, funcExists := c.Get("I18n")
 	if !funcExists {
 		logger.Warning("I18n function not exists in gin context!")
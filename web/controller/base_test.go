@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/web/session"
+
+	sessions "github.com/Calidity/gin-sessions"
+	"github.com/Calidity/gin-sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+const testBasePath = "/panel/"
+
+// newTestEngine sets up the session store and base path the way Server.initRouter does
+func newTestEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	err := database.InitDB(filepath.Join(t.TempDir(), "x-ui.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	store := cookie.NewStore([]byte("secret"))
+	store.Options(sessions.Options{
+		Path:     testBasePath,
+		HttpOnly: true,
+	})
+	engine.Use(sessions.Sessions("x-ui", store))
+	engine.Use(func(c *gin.Context) {
+		c.Set("base_path", testBasePath)
+	})
+	return engine
+}
+
+func TestCheckLoginRedirectsToBasePath(t *testing.T) {
+	engine := newTestEngine(t)
+	a := &BaseController{}
+	engine.GET(testBasePath+"xui/", a.checkLogin, func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, testBasePath+"xui/", nil)
+	engine.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTemporaryRedirect)
+	}
+	if location := w.Header().Get("Location"); location != testBasePath {
+		t.Fatalf("Location = %q, want %q", location, testBasePath)
+	}
+}
+
+func TestIndexRedirectsLoggedInToBasePath(t *testing.T) {
+	engine := newTestEngine(t)
+	a := &IndexController{}
+	engine.GET(testBasePath, a.index)
+	engine.GET(testBasePath+"testLogin", func(c *gin.Context) {
+		session.SetLoginUser(c, &model.User{Id: 1, Username: "admin"})
+	})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testBasePath+"testLogin", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("login did not set a session cookie")
+	}
+	if cookies[0].Path != testBasePath {
+		t.Fatalf("cookie path = %q, want %q", cookies[0].Path, testBasePath)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, testBasePath, nil)
+	req.AddCookie(cookies[0])
+	engine.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTemporaryRedirect)
+	}
+	if location := w.Header().Get("Location"); !strings.HasPrefix(location, testBasePath+"xui/") {
+		t.Fatalf("Location = %q, want %q", location, testBasePath+"xui/")
+	}
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"x-ui/web/middleware"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientStatusController serves the usage of a subscription without login,
+// the subscription ID is the secret.
+type ClientStatusController struct {
+	inboundService service.InboundService
+}
+
+func NewClientStatusController(g *gin.RouterGroup) *ClientStatusController {
+	a := &ClientStatusController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *ClientStatusController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/inbound")
+	g.Use(middleware.RateLimitMiddleware(30, time.Minute))
+
+	g.GET("/clientStatus", a.clientStatus)
+}
+
+func (a *ClientStatusController) clientStatus(c *gin.Context) {
+	subId := c.Query("id")
+	if subId == "" {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	status, err := a.inboundService.GetClientStatus(subId)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -2,10 +2,18 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/sub"
+	"x-ui/web/middleware"
 	"x-ui/web/service"
 	"x-ui/web/session"
 
@@ -15,6 +23,7 @@ import (
 type InboundController struct {
 	inboundService service.InboundService
 	xrayService    service.XrayService
+	settingService service.SettingService
 }
 
 func NewInboundController(g *gin.RouterGroup) *InboundController {
@@ -30,15 +39,43 @@ func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g.POST("/add", a.addInbound)
 	g.POST("/del/:id", a.delInbound)
 	g.POST("/update/:id", a.updateInbound)
+	g.POST("/bulkToggle", a.bulkToggleInbounds)
+	g.POST("/validate", a.validateInbound)
 	g.POST("/addClient", a.addInboundClient)
 	g.POST("/:id/delClient/:clientId", a.delInboundClient)
 	g.POST("/updateClient/:clientId", a.updateInboundClient)
 	g.POST("/:id/resetClientTraffic/:email", a.resetClientTraffic)
 	g.POST("/resetAllTraffics", a.resetAllTraffics)
 	g.POST("/resetAllClientTraffics/:id", a.resetAllClientTraffics)
+	g.POST("/resetTraffic/:id", a.resetInboundTraffic)
 	g.POST("/delDepletedClients/:id", a.delDepletedClients)
+	g.POST("/purgeClients", a.purgeClients)
+	g.POST("/rotateSubIds", a.rotateSubIds)
+	g.POST("/extendExpiry", a.extendExpiry)
+	g.POST("/resetClientsTraffic", a.resetClientsTraffic)
+	g.POST("/setClientsEnable", a.setClientsEnable)
+	g.POST("/suspendClient", a.suspendClient)
+	g.POST("/pingClient", middleware.RateLimitMiddleware(10, time.Minute), a.pingClient)
+	g.GET("/clientsByGroup", a.clientsByGroup)
+	g.POST("/setClientsGroup", a.setClientsGroup)
+	g.GET("/subGroups", a.getSubGroups)
+	g.POST("/subGroup/add", a.addSubGroup)
+	g.POST("/subGroup/del/:id", a.delSubGroup)
+	g.GET("/duplicates", a.duplicates)
+	g.POST("/dedupe", a.dedupe)
 	g.POST("/import", a.importInbound)
+	g.POST("/importLink", a.importLink)
+	g.POST("/importClients/:id", a.importClients)
+	g.POST("/createTrial/:id", a.createTrial)
+	g.POST("/renameTag", a.renameTag)
+	g.GET("/exportClients/:id", a.exportClients)
+	g.GET("/clientLink/:email", a.clientLink)
+	g.GET("/:id/clients", a.getClientPage)
 	g.POST("/onlines", a.onlines)
+	g.GET("/topClients", a.topClients)
+	g.GET("/trafficTotal", a.trafficTotal)
+	g.GET("/inactiveClients", a.inactiveClients)
+	g.GET("/protocolStats", a.protocolStats)
 }
 
 func (a *InboundController) getInbounds(c *gin.Context) {
@@ -65,6 +102,34 @@ func (a *InboundController) getInbound(c *gin.Context) {
 	jsonObj(c, inbound, nil)
 }
 
+func (a *InboundController) getClientPage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		jsonMsg(c, "Invalid page", err)
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if err != nil {
+		jsonMsg(c, "Invalid page size", err)
+		return
+	}
+	var fields []string
+	if value := c.Query("fields"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+	clients, err := a.inboundService.GetClientPage(id, page, pageSize, c.Query("search"), fields)
+	jsonObj(c, clients, err)
+}
+
 func (a *InboundController) getClientTraffics(c *gin.Context) {
 	email := c.Param("email")
 	clientTraffics, err := a.inboundService.GetClientTrafficByEmail(email)
@@ -84,10 +149,13 @@ func (a *InboundController) addInbound(c *gin.Context) {
 	}
 	user := session.GetLoginUser(c)
 	inbound.UserId = user.Id
-	if inbound.Listen == "" || inbound.Listen == "0.0.0.0" || inbound.Listen == "::" || inbound.Listen == "::0" {
-		inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
-	} else {
-		inbound.Tag = fmt.Sprintf("inbound-%v:%v", inbound.Listen, inbound.Port)
+	if randomPath, _ := strconv.ParseBool(c.PostForm("randomPath")); randomPath {
+		length, _ := strconv.Atoi(c.PostForm("randomPathLength"))
+		err = a.inboundService.RandomizeTransportPath(inbound, length, c.PostForm("randomPathCharset"))
+		if err != nil {
+			jsonMsg(c, I18nWeb(c, "pages.inbounds.create"), err)
+			return
+		}
 	}
 
 	needRestart := false
@@ -134,6 +202,19 @@ func (a *InboundController) updateInbound(c *gin.Context) {
 	}
 }
 
+// validateInbound returns the conflicts of a new inbound, or of an edited one when the id is given
+func (a *InboundController) validateInbound(c *gin.Context) {
+	inbound := &model.Inbound{}
+	err := c.ShouldBind(inbound)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.update"), err)
+		return
+	}
+	inbound.Listen = strings.TrimSpace(inbound.Listen)
+	conflicts, err := a.inboundService.GetInboundConflicts(inbound, inbound.Id)
+	jsonObj(c, conflicts, err)
+}
+
 func (a *InboundController) addInboundClient(c *gin.Context) {
 	data := &model.Inbound{}
 	err := c.ShouldBind(data)
@@ -149,10 +230,152 @@ func (a *InboundController) addInboundClient(c *gin.Context) {
 		jsonMsg(c, "Something went wrong!", err)
 		return
 	}
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	if withQr, _ := strconv.ParseBool(c.Query("withQr")); withQr {
+		jsonMsgObj(c, "Client(s) added", a.getClientLinks(c, data), nil)
+		return
+	}
 	jsonMsg(c, "Client(s) added", nil)
+}
+
+// getClientLinks returns the share links of the clients in data, to be shown as QR codes
+func (a *InboundController) getClientLinks(c *gin.Context, data *model.Inbound) []*sub.ClientLink {
+	inbound, err := a.inboundService.GetInbound(data.Id)
+	if err != nil {
+		logger.Warning("get share links of added clients failed:", err)
+		return nil
+	}
+	clients, err := a.inboundService.GetClients(data)
+	if err != nil {
+		logger.Warning("get share links of added clients failed:", err)
+		return nil
+	}
+	emails := make([]string, 0, len(clients))
+	for _, client := range clients {
+		emails = append(emails, client.Email)
+	}
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		host = c.Request.Host
+	}
+	return sub.ClientLinks(inbound, emails, host)
+}
+
+// clientLink returns the share link of a client, over another inbound of its subscription
+// when the transport query asks for a transport its own inbound does not use
+func (a *InboundController) clientLink(c *gin.Context) {
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		host = c.Request.Host
+	}
+	link, err := sub.ClientTransportLink(c.Param("email"), c.Query("transport"), host)
+	jsonObj(c, link, err)
+}
+
+// createTrial adds a trial client to the inbound and returns its link, the panel shows the
+// link as a qr code
+func (a *InboundController) createTrial(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.client.submitAdd"), err)
+		return
+	}
+	client, needRestart, err := a.inboundService.CreateTrialClient(id, getRemoteIp(c))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.client.submitAdd"), err)
+		return
+	}
 	if needRestart {
 		a.xrayService.SetToNeedRestart()
 	}
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		host = c.Request.Host
+	}
+	link, err := sub.ClientTransportLink(client.Email, "", host)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.client.submitAdd"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.client.submitAdd"), gin.H{"client": client, "link": link}, nil)
+}
+
+func (a *InboundController) renameTag(c *gin.Context) {
+	rename, err := a.inboundService.RenameInboundTag(c.PostForm("oldTag"), c.PostForm("newTag"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.update"), err)
+		return
+	}
+	// the running inbound still has the old tag, api calls would miss it until xray restarts
+	err = a.xrayService.RestartXray(true)
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.update"), rename, err)
+}
+
+func (a *InboundController) exportClients(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	inbound, err := a.inboundService.GetInbound(id)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		host = c.Request.Host
+	}
+	includeDisabled, _ := strconv.ParseBool(c.Query("includeDisabled"))
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename=inbound-"+strconv.Itoa(id)+"-clients.zip")
+	err = sub.ExportClients(c.Writer, inbound, host, includeDisabled)
+	if err != nil {
+		// the zip is already partially sent, so only log the error
+		logger.Warning("export clients failed:", err)
+	}
+}
+
+func (a *InboundController) importClients(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.update"), err)
+		return
+	}
+	maxErrors := -1
+	if value := c.PostForm("maxErrors"); value != "" {
+		maxErrors, err = strconv.Atoi(value)
+		if err != nil {
+			jsonMsg(c, "Invalid maxErrors", err)
+			return
+		}
+	}
+
+	maxUploadSize, err := a.settingService.GetMaxUploadSize()
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	limitRequestBody(c, maxUploadSize)
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		if isRequestTooLarge(err) {
+			pureJsonMsg(c, http.StatusRequestEntityTooLarge, false, fmt.Sprintf("Error reading csv file: file is larger than %d MB", maxUploadSize))
+			return
+		}
+		jsonMsg(c, "Error reading csv file", err)
+		return
+	}
+	defer file.Close()
+
+	result, needRestart, err := a.inboundService.ImportClients(id, file, maxErrors)
+	jsonMsgObj(c, "Clients imported", result, err)
+	if err == nil && needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
 }
 
 func (a *InboundController) delInboundClient(c *gin.Context) {
@@ -248,6 +471,26 @@ func (a *InboundController) resetAllClientTraffics(c *gin.Context) {
 	jsonMsg(c, "All traffics of client reseted", nil)
 }
 
+func (a *InboundController) resetInboundTraffic(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.update"), err)
+		return
+	}
+	withClients := c.Query("clients") == "true" || c.PostForm("clients") == "true"
+
+	reset, err := a.inboundService.ResetInboundTraffic(id, withClients)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	if reset.Enabled > 0 {
+		// depleted clients were removed from xray and are enabled again
+		a.xrayService.SetToNeedRestart()
+	}
+	jsonMsgObj(c, "Inbound traffic reseted", reset, nil)
+}
+
 func (a *InboundController) delDepletedClients(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -262,6 +505,271 @@ func (a *InboundController) delDepletedClients(c *gin.Context) {
 	jsonMsg(c, "All delpeted clients are deleted", nil)
 }
 
+func (a *InboundController) purgeClients(c *gin.Context) {
+	filter := &service.PurgeClientsFilter{}
+	err := c.ShouldBind(filter)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	if !filter.DryRun && c.PostForm("confirm") != "true" {
+		jsonMsg(c, "Purge clients", errors.New("purging clients must be confirmed with confirm=true"))
+		return
+	}
+	result, err := a.inboundService.PurgeClients(filter)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	if filter.DryRun {
+		jsonObj(c, result, nil)
+		return
+	}
+	jsonMsgObj(c, "Clients purged", result, nil)
+	if result.Count > 0 {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// bulkToggleInbounds enables or disables the comma separated inbound ids with one xray restart
+func (a *InboundController) bulkToggleInbounds(c *gin.Context) {
+	var ids []int
+	for _, value := range strings.Split(c.PostForm("ids"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			jsonMsg(c, "Invalid inbound id", err)
+			return
+		}
+		ids = append(ids, id)
+	}
+	enable, err := strconv.ParseBool(c.PostForm("enable"))
+	if err != nil {
+		jsonMsg(c, "Invalid enable", err)
+		return
+	}
+	results, changed, err := a.inboundService.SetInboundsEnable(ids, enable)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.update"), err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.update"), results, nil)
+	if changed {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// getClientEmails returns the emails of the clients a bulk operation targets, either the comma
+// separated emails or all clients of group.
+func (a *InboundController) getClientEmails(c *gin.Context) ([]string, error) {
+	if group := c.PostForm("group"); group != "" {
+		emails, err := a.inboundService.GetGroupEmails(group)
+		if err == nil && len(emails) == 0 {
+			err = errors.New("no clients in group " + group)
+		}
+		return emails, err
+	}
+	var emails []string
+	for _, email := range strings.Split(c.PostForm("emails"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails, nil
+}
+
+func (a *InboundController) clientsByGroup(c *gin.Context) {
+	clients, err := a.inboundService.GetClientsByGroup(c.Query("group"))
+	jsonObj(c, clients, err)
+}
+
+// setClientsGroup moves the comma separated emails into the group setGroup, an empty one
+// takes them out of their group
+func (a *InboundController) setClientsGroup(c *gin.Context) {
+	emails, err := a.getClientEmails(c)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	changed, err := a.inboundService.SetClientsGroup(emails, c.PostForm("setGroup"))
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.update"), changed, err)
+}
+
+func (a *InboundController) getSubGroups(c *gin.Context) {
+	groups, err := a.inboundService.GetSubGroups()
+	jsonObj(c, groups, err)
+}
+
+func (a *InboundController) addSubGroup(c *gin.Context) {
+	group, err := a.inboundService.AddSubGroup(c.PostForm("name"))
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.create"), group, err)
+}
+
+func (a *InboundController) delSubGroup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "delete"), err)
+		return
+	}
+	err = a.inboundService.DelSubGroup(id)
+	jsonMsgObj(c, I18nWeb(c, "delete"), id, err)
+}
+
+func (a *InboundController) resetClientsTraffic(c *gin.Context) {
+	emails, err := a.getClientEmails(c)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	needRestart, err := a.inboundService.ResetClientsTraffic(emails)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	jsonMsg(c, "Traffic has been reset", nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *InboundController) setClientsEnable(c *gin.Context) {
+	emails, err := a.getClientEmails(c)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	enable, err := strconv.ParseBool(c.PostForm("enable"))
+	if err != nil {
+		jsonMsg(c, "Invalid enable", err)
+		return
+	}
+	changed, err := a.inboundService.SetClientsEnable(emails, enable)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.update"), changed, nil)
+	if len(changed) > 0 {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// suspendClient disables a client for the given minutes, it is enabled again afterwards
+func (a *InboundController) suspendClient(c *gin.Context) {
+	minutes, err := strconv.Atoi(c.PostForm("minutes"))
+	if err != nil {
+		jsonMsg(c, "Invalid minutes", err)
+		return
+	}
+	email := c.PostForm("email")
+	restoreAt, err := a.inboundService.SuspendClient(email, time.Duration(minutes)*time.Minute)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.update"), gin.H{"email": email, "restoreAt": restoreAt}, nil)
+	a.xrayService.SetToNeedRestart()
+}
+
+func (a *InboundController) pingClient(c *gin.Context) {
+	timeout := 3
+	if value := c.PostForm("timeout"); value != "" {
+		var err error
+		timeout, err = strconv.Atoi(value)
+		if err != nil || timeout < 1 || timeout > 10 {
+			jsonMsg(c, "Invalid timeout", errors.New("timeout must be between 1 and 10 seconds"))
+			return
+		}
+	}
+	result, err := a.inboundService.PingClient(c.PostForm("email"), time.Duration(timeout)*time.Second)
+	jsonObj(c, result, err)
+}
+
+// rotateSubIds breaks all existing subscription links of the rotated clients
+func (a *InboundController) rotateSubIds(c *gin.Context) {
+	inboundId := 0
+	if value := c.PostForm("inboundId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			jsonMsg(c, I18nWeb(c, "pages.inbounds.update"), err)
+			return
+		}
+		inboundId = id
+	}
+	emails, err := a.getClientEmails(c)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	rotations, err := a.inboundService.RotateSubIds(inboundId, emails)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	jsonMsgObj(c, "Subscription IDs rotated, old subscription links no longer work", rotations, nil)
+}
+
+func (a *InboundController) duplicates(c *gin.Context) {
+	duplicates, err := a.inboundService.GetClientDuplicates()
+	jsonObj(c, duplicates, err)
+}
+
+// dedupe breaks the existing links of the clients which get a new ID or subscription ID
+func (a *InboundController) dedupe(c *gin.Context) {
+	dedupes, err := a.inboundService.DedupeClients()
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	jsonMsgObj(c, "Duplicate client IDs regenerated", dedupes, nil)
+	if len(dedupes) > 0 {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+func (a *InboundController) extendExpiry(c *gin.Context) {
+	emails, err := a.getClientEmails(c)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+
+	var value int64
+	add := true
+	switch c.PostForm("mode") {
+	case "", "add":
+		days, err := strconv.ParseFloat(c.PostForm("days"), 64)
+		if err != nil {
+			jsonMsg(c, "Invalid days", err)
+			return
+		}
+		value = int64(days * 24 * float64(time.Hour.Milliseconds()))
+	case "set":
+		add = false
+		expiryTime, err := service.ParseClientExpiry(c.PostForm("expiryTime"))
+		if err != nil {
+			jsonMsg(c, "Invalid expiryTime", err)
+			return
+		}
+		value = expiryTime
+	default:
+		jsonMsg(c, "Invalid mode", errors.New("mode must be add or set"))
+		return
+	}
+
+	results, needRestart, err := a.inboundService.ExtendExpiry(emails, add, value)
+	if err != nil {
+		jsonMsg(c, "Something went wrong!", err)
+		return
+	}
+	jsonMsgObj(c, "Client expiry extended", results, nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
 func (a *InboundController) importInbound(c *gin.Context) {
 	inbound := &model.Inbound{}
 	err := json.Unmarshal([]byte(c.PostForm("data")), inbound)
@@ -272,11 +780,6 @@ func (a *InboundController) importInbound(c *gin.Context) {
 	user := session.GetLoginUser(c)
 	inbound.Id = 0
 	inbound.UserId = user.Id
-	if inbound.Listen == "" || inbound.Listen == "0.0.0.0" || inbound.Listen == "::" || inbound.Listen == "::0" {
-		inbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
-	} else {
-		inbound.Tag = fmt.Sprintf("inbound-%v:%v", inbound.Listen, inbound.Port)
-	}
 
 	for index := range inbound.ClientStats {
 		inbound.ClientStats[index].Id = 0
@@ -291,6 +794,80 @@ func (a *InboundController) importInbound(c *gin.Context) {
 	}
 }
 
+func (a *InboundController) importLink(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	result, needRestart, err := a.inboundService.ImportLink(c.PostForm("link"), user.Id)
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.create"), result, err)
+	if err == nil && needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
 func (a *InboundController) onlines(c *gin.Context) {
 	jsonObj(c, a.inboundService.GetOnlineClinets(), nil)
 }
+
+// trafficTotal takes from and to as unix milliseconds or dates like 2006-01-02 in the time location
+// of the panel, to defaults to now
+func (a *InboundController) trafficTotal(c *gin.Context) {
+	if c.Query("from") == "" {
+		jsonMsg(c, "Invalid from", errors.New("from must be unix milliseconds or a date"))
+		return
+	}
+	from, err := service.ParseTrafficTime(c.Query("from"))
+	if err != nil {
+		jsonMsg(c, "Invalid from", err)
+		return
+	}
+	to := time.Now().UnixMilli()
+	if value := c.Query("to"); value != "" {
+		to, err = service.ParseTrafficTime(value)
+		if err != nil {
+			jsonMsg(c, "Invalid to", err)
+			return
+		}
+	}
+	inboundId := 0
+	if value := c.Query("inbound"); value != "" {
+		inboundId, err = strconv.Atoi(value)
+		if err != nil {
+			jsonMsg(c, "Invalid inbound", err)
+			return
+		}
+	}
+	total, err := a.inboundService.GetTrafficTotal(from, to, c.Query("email"), inboundId)
+	jsonObj(c, total, err)
+}
+
+func (a *InboundController) inactiveClients(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil {
+		jsonMsg(c, "Invalid days", err)
+		return
+	}
+	clients, historyFrom, err := a.inboundService.GetInactiveClients(days)
+	if err != nil {
+		jsonMsg(c, "Invalid days", err)
+		return
+	}
+	jsonObj(c, gin.H{"days": days, "historyFrom": historyFrom, "clients": clients}, nil)
+}
+
+func (a *InboundController) topClients(c *gin.Context) {
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil {
+			jsonMsg(c, "Invalid limit", err)
+			return
+		}
+	}
+	clients, err := a.inboundService.GetTopClients(c.Query("by"), limit)
+	jsonObj(c, clients, err)
+}
+
+func (a *InboundController) protocolStats(c *gin.Context) {
+	stats, err := a.inboundService.GetProtocolStats()
+	jsonObj(c, stats, err)
+}
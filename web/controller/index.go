@@ -12,8 +12,9 @@ import (
 )
 
 type LoginForm struct {
-	Username string `json:"username" form:"username"`
-	Password string `json:"password" form:"password"`
+	Username   string `json:"username" form:"username"`
+	Password   string `json:"password" form:"password"`
+	RememberMe bool   `json:"rememberMe" form:"rememberMe"`
 }
 
 type IndexController struct {
@@ -37,8 +38,10 @@ func (a *IndexController) initRouter(g *gin.RouterGroup) {
 }
 
 func (a *IndexController) index(c *gin.Context) {
+	idleTimeout, _ := a.settingService.GetSessionIdleTimeout()
+	session.CheckExpiry(c, time.Duration(idleTimeout)*time.Minute)
 	if session.IsLogin(c) {
-		c.Redirect(http.StatusTemporaryRedirect, "xui/")
+		c.Redirect(http.StatusTemporaryRedirect, c.GetString("base_path")+"xui/")
 		return
 	}
 	html(c, "login.html", "pages.login.title", nil)
@@ -65,11 +68,13 @@ func (a *IndexController) login(c *gin.Context) {
 	if user == nil {
 		logger.Infof("wrong username or password: \"%s\" \"%s\"", form.Username, form.Password)
 		a.tgbot.UserLoginNotify(form.Username, getRemoteIp(c), timeStr, 0)
+		a.userService.AddLoginAttempt(form.Username, getRemoteIp(c), false)
 		pureJsonMsg(c, http.StatusOK, false, I18nWeb(c, "pages.login.toasts.wrongUsernameOrPassword"))
 		return
 	} else {
 		logger.Infof("%s login success ,Ip Address: %s\n", form.Username, getRemoteIp(c))
 		a.tgbot.UserLoginNotify(form.Username, getRemoteIp(c), timeStr, 1)
+		a.userService.AddLoginAttempt(form.Username, getRemoteIp(c), true)
 	}
 
 	sessionMaxAge, err := a.settingService.GetSessionMaxAge()
@@ -77,12 +82,22 @@ func (a *IndexController) login(c *gin.Context) {
 		logger.Infof("Unable to get session's max age from DB")
 	}
 
-	if sessionMaxAge > 0 {
-		err = session.SetMaxAge(c, sessionMaxAge*60)
+	lifetime := time.Duration(sessionMaxAge) * time.Minute
+	rememberMeDays, _ := a.settingService.GetRememberMeDays()
+	remember := form.RememberMe && rememberMeDays > 0
+	if remember {
+		lifetime = time.Duration(rememberMeDays) * 24 * time.Hour
+	}
+	if lifetime > 0 {
+		err = session.SetMaxAge(c, int(lifetime.Seconds()))
 		if err != nil {
 			logger.Infof("Unable to set session's max age")
 		}
 	}
+	err = session.SetLoginExpiry(c, lifetime, remember)
+	if err != nil {
+		logger.Infof("Unable to set session's expiry")
+	}
 
 	err = session.SetLoginUser(c, user)
 	logger.Info("user", user.Id, "login success")
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"x-ui/web/middleware"
+	"x-ui/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsController struct {
+	inboundService service.InboundService
+	settingService service.SettingService
+	xrayService    service.XrayService
+}
+
+func NewMetricsController(g *gin.RouterGroup) *MetricsController {
+	a := &MetricsController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *MetricsController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/metrics")
+	g.Use(middleware.TokenAuthMiddleware(a.settingService.GetMetricsToken))
+
+	g.GET("", a.metrics)
+}
+
+var metricsLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type metricsWriter struct {
+	strings.Builder
+}
+
+func (w *metricsWriter) header(name string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// sample writes one sample, labels are given as name/value pairs
+func (w *metricsWriter) sample(name string, value int64, labels ...string) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.WriteString(",")
+			}
+			fmt.Fprintf(w, `%s="%s"`, labels[i], metricsLabelReplacer.Replace(labels[i+1]))
+		}
+		w.WriteString("}")
+	}
+	fmt.Fprintf(w, " %d\n", value)
+}
+
+func (a *MetricsController) metrics(c *gin.Context) {
+	inbounds, err := a.inboundService.GetAllInbounds()
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	clientMetrics, err := a.settingService.GetMetricsClients()
+	if err != nil {
+		clientMetrics = false
+	}
+
+	w := &metricsWriter{}
+	running := a.xrayService.IsXrayRunning()
+	w.header("x_ui_xray_running", "Whether xray is running.")
+	if running {
+		w.sample("x_ui_xray_running", 1)
+	} else {
+		w.sample("x_ui_xray_running", 0)
+	}
+
+	w.header("x_ui_inbound_traffic_bytes", "Traffic of inbounds in bytes.")
+	for _, inbound := range inbounds {
+		w.sample("x_ui_inbound_traffic_bytes", inbound.Up, "inbound", inbound.Tag, "direction", "up")
+		w.sample("x_ui_inbound_traffic_bytes", inbound.Down, "inbound", inbound.Tag, "direction", "down")
+	}
+
+	if clientMetrics {
+		onlines := map[string]bool{}
+		if running {
+			for _, email := range a.inboundService.GetOnlineClinets() {
+				onlines[email] = true
+			}
+		}
+
+		w.header("x_ui_client_traffic_bytes", "Traffic of clients in bytes.")
+		for _, inbound := range inbounds {
+			for _, traffic := range inbound.ClientStats {
+				w.sample("x_ui_client_traffic_bytes", traffic.Up, "email", traffic.Email, "inbound", inbound.Tag, "direction", "up")
+				w.sample("x_ui_client_traffic_bytes", traffic.Down, "email", traffic.Email, "inbound", inbound.Tag, "direction", "down")
+			}
+		}
+		w.header("x_ui_client_traffic_limit_bytes", "Traffic limit of clients in bytes, 0 means unlimited.")
+		for _, inbound := range inbounds {
+			for _, traffic := range inbound.ClientStats {
+				w.sample("x_ui_client_traffic_limit_bytes", traffic.Total, "email", traffic.Email, "inbound", inbound.Tag)
+			}
+		}
+		w.header("x_ui_client_online", "Whether the client is online.")
+		for _, inbound := range inbounds {
+			for _, traffic := range inbound.ClientStats {
+				online := int64(0)
+				if onlines[traffic.Email] {
+					online = 1
+				}
+				w.sample("x_ui_client_online", online, "email", traffic.Email, "inbound", inbound.Tag)
+			}
+		}
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(w.String()))
+}
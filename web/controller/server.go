@@ -1,31 +1,51 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"regexp"
+	"strconv"
+	"sync"
 	"time"
 
+	"x-ui/logger"
+	"x-ui/util/common"
 	"x-ui/web/global"
 	"x-ui/web/service"
 
 	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
 )
 
-var filenameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-.]+$`)
-
 type ServerController struct {
 	BaseController
 
-	serverService service.ServerService
+	serverService       service.ServerService
+	settingService      service.SettingService
+	xrayInstanceService service.XrayInstanceService
+	xraySettingService  service.XraySettingService
+	xrayService         service.XrayService
+	emailService        service.EmailService
+	userService         service.UserService
+	panelService        service.PanelService
 
 	lastStatus        *service.Status
 	lastGetStatusTime time.Time
 
+	versionsLock        sync.Mutex
 	lastVersions        []string
 	lastGetVersionsTime time.Time
+	// the last failed fetch, which is not retried before xrayVersionsRetry
+	lastVersionsErr      error
+	lastVersionsFailTime time.Time
 }
 
+// xrayVersionsRetry is how long a failed fetch of the xray versions is not retried, as an
+// unreachable GitHub makes every fetch wait for its timeout
+const xrayVersionsRetry = 5 * time.Minute
+
 func NewServerController(g *gin.RouterGroup) *ServerController {
 	a := &ServerController{
 		lastGetStatusTime: time.Now(),
@@ -38,17 +58,63 @@ func NewServerController(g *gin.RouterGroup) *ServerController {
 func (a *ServerController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/server")
 
+	g.GET("/ready", a.ready)
+
 	g.Use(a.checkLogin)
 	g.POST("/status", a.status)
+	g.GET("/summary", a.summary)
+	g.GET("/panelInfo", a.panelInfo)
+	g.GET("/clientIp", a.clientIp)
+	g.GET("/loginAttempts", a.loginAttempts)
 	g.POST("/getXrayVersion", a.getXrayVersion)
+	g.GET("/xrayUpdateAvailable", a.xrayUpdateAvailable)
 	g.POST("/stopXrayService", a.stopXrayService)
 	g.POST("/restartXrayService", a.restartXrayService)
+	g.GET("/xrayStartups", a.xrayStartups)
+	g.POST("/scheduleRestart", a.scheduleRestart)
+	g.DELETE("/scheduleRestart", a.cancelScheduledRestart)
 	g.POST("/installXray/:version", a.installXray)
+	g.GET("/installProgress", a.installProgress)
 	g.POST("/logs/:count", a.getLogs)
 	g.POST("/getConfigJson", a.getConfigJson)
+	g.GET("/configLint", a.configLint)
+	g.POST("/resyncTraffic", a.resyncTraffic)
+	g.GET("/inboundDrift", a.inboundDrift)
+	g.POST("/inboundDrift/reconcile", a.reconcileInbounds)
+	g.GET("/blockedConnections", a.blockedConnections)
+	g.POST("/flushTraffic", a.flushTraffic)
+	g.POST("/benchmark", a.benchmark)
+	g.POST("/probeDest", a.probeDest)
+	g.GET("/geoFiles", a.getGeoFiles)
+	g.GET("/certificates", a.getCertificates)
+	g.GET("/cronJobs", a.getCronJobs)
+	g.GET("/probePort/:port", a.probePort)
+	g.POST("/updateGeoFiles", a.updateGeoFiles)
+	g.GET("/exportTgConfig", a.exportTgConfig)
+	g.POST("/importTgConfig", a.importTgConfig)
+	g.POST("/statsService", a.statsService)
+	g.POST("/routingTest", a.routingTest)
+	g.GET("/routing", a.getRouting)
+	g.GET("/outbounds", a.getOutbounds)
+	g.POST("/routing", a.updateRouting)
+	g.POST("/reloadConfig", a.reloadConfig)
+	g.POST("/clientLogs", a.getClientLogs)
+	g.GET("/clientLogStream", a.clientLogStream)
+	g.POST("/parseLink", a.parseLink)
+	g.POST("/testEmail", a.testEmail)
 	g.GET("/getDb", a.getDb)
+	g.GET("/dbStats", a.getDBStats)
 	g.POST("/importDB", a.importDB)
 	g.POST("/getNewX25519Cert", a.getNewX25519Cert)
+	g.POST("/verifyX25519", a.verifyX25519)
+
+	g.POST("/instances/list", a.getInstances)
+	g.POST("/instances/save", a.saveInstance)
+	g.POST("/instances/del/:name", a.delInstance)
+	g.POST("/instances/:name/status", a.instanceStatus)
+	g.POST("/instances/:name/start", a.startInstance)
+	g.POST("/instances/:name/stop", a.stopInstance)
+	g.POST("/instances/:name/restart", a.restartInstance)
 }
 
 func (a *ServerController) refreshStatus() {
@@ -58,13 +124,13 @@ func (a *ServerController) refreshStatus() {
 func (a *ServerController) startTask() {
 	webServer := global.GetWebServer()
 	c := webServer.GetCron()
-	c.AddFunc("@every 2s", func() {
+	service.AddCronJob(c, "status refresh", "@every 2s", cron.FuncJob(func() {
 		now := time.Now()
 		if now.Sub(a.lastGetStatusTime) > time.Minute*3 {
 			return
 		}
 		a.refreshStatus()
-	})
+	}))
 }
 
 func (a *ServerController) status(c *gin.Context) {
@@ -73,23 +139,115 @@ func (a *ServerController) status(c *gin.Context) {
 	jsonObj(c, a.lastStatus, nil)
 }
 
-func (a *ServerController) getXrayVersion(c *gin.Context) {
+func (a *ServerController) summary(c *gin.Context) {
+	a.lastGetStatusTime = time.Now()
+	if a.lastStatus == nil {
+		a.refreshStatus()
+	}
+	versions, _, err := a.getCachedXrayVersions()
+	if err != nil {
+		logger.Warning("get xray versions failed:", err)
+	}
+	summary, err := a.serverService.GetSummary(a.lastStatus, versions)
+	jsonObj(c, summary, err)
+}
+
+func (a *ServerController) ready(c *gin.Context) {
+	if !global.IsReady() {
+		pureJsonMsg(c, http.StatusServiceUnavailable, false, "panel is starting")
+		return
+	}
+	pureJsonMsg(c, http.StatusOK, true, "panel is ready")
+}
+
+// getCachedXrayVersions returns the last fetched versions, stale when fetching them again failed
+func (a *ServerController) getCachedXrayVersions() ([]string, bool, error) {
+	a.versionsLock.Lock()
+	defer a.versionsLock.Unlock()
 	now := time.Now()
 	if now.Sub(a.lastGetVersionsTime) <= time.Minute {
-		jsonObj(c, a.lastVersions, nil)
-		return
+		return a.lastVersions, false, nil
+	}
+	if now.Sub(a.lastVersionsFailTime) <= xrayVersionsRetry {
+		if a.lastVersions != nil {
+			return a.lastVersions, true, nil
+		}
+		return nil, false, a.lastVersionsErr
 	}
 
 	versions, err := a.serverService.GetXrayVersions()
 	if err != nil {
-		jsonMsg(c, I18nWeb(c, "getVersion"), err)
-		return
+		a.lastVersionsErr = err
+		a.lastVersionsFailTime = time.Now()
+		if a.lastVersions != nil {
+			logger.Warning("get xray versions failed, using the list of", a.lastGetVersionsTime.Format(time.DateTime), err)
+			return a.lastVersions, true, nil
+		}
+		return nil, false, err
 	}
 
 	a.lastVersions = versions
 	a.lastGetVersionsTime = time.Now()
+	return versions, false, nil
+}
+
+func (a *ServerController) loginAttempts(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if err != nil || pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+	onlyFailed, _ := strconv.ParseBool(c.Query("failed"))
+	attempts, total, err := a.userService.GetLoginAttempts(page, pageSize, onlyFailed)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	jsonObj(c, gin.H{"total": total, "page": page, "pageSize": pageSize, "attempts": attempts}, nil)
+}
 
-	jsonObj(c, versions, nil)
+// clientIp shows how the client IP was detected, to debug the trusted proxies setting
+func (a *ServerController) clientIp(c *gin.Context) {
+	trustedProxies, err := a.settingService.GetTrustedProxies()
+	jsonObj(c, gin.H{
+		"clientIp":       getRemoteIp(c),
+		"remoteIp":       c.RemoteIP(),
+		"xForwardedFor":  c.GetHeader("X-Forwarded-For"),
+		"xRealIp":        c.GetHeader("X-Real-IP"),
+		"trustedProxies": trustedProxies,
+	}, err)
+}
+
+func (a *ServerController) configLint(c *gin.Context) {
+	result, err := a.serverService.LintConfig()
+	jsonObj(c, result, err)
+}
+
+func (a *ServerController) panelInfo(c *gin.Context) {
+	jsonObj(c, a.serverService.GetPanelInfo(), nil)
+}
+
+func (a *ServerController) getXrayVersion(c *gin.Context) {
+	versions, stale, err := a.getCachedXrayVersions()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "getVersion"), err)
+		return
+	}
+	jsonObj(c, gin.H{"versions": versions, "stale": stale}, nil)
+}
+
+func (a *ServerController) xrayUpdateAvailable(c *gin.Context) {
+	versions, stale, err := a.getCachedXrayVersions()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "getVersion"), err)
+		return
+	}
+	info := a.serverService.GetXrayUpdateInfo(versions)
+	info.Stale = stale
+	jsonObj(c, info, nil)
 }
 
 func (a *ServerController) installXray(c *gin.Context) {
@@ -98,6 +256,10 @@ func (a *ServerController) installXray(c *gin.Context) {
 	jsonMsg(c, I18nWeb(c, "install")+" xray", err)
 }
 
+func (a *ServerController) installProgress(c *gin.Context) {
+	jsonObj(c, a.serverService.GetInstallProgress(), nil)
+}
+
 func (a *ServerController) stopXrayService(c *gin.Context) {
 	a.lastGetStatusTime = time.Now()
 	err := a.serverService.StopXrayService()
@@ -117,14 +279,95 @@ func (a *ServerController) restartXrayService(c *gin.Context) {
 	jsonMsg(c, "Xray restarted", err)
 }
 
+func (a *ServerController) xrayStartups(c *gin.Context) {
+	jsonObj(c, service.GetXrayStartups(), nil)
+}
+
+// scheduleRestart takes either an RFC3339 time or a delay like "30m"
+func (a *ServerController) scheduleRestart(c *gin.Context) {
+	var at time.Time
+	if value := c.PostForm("time"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			jsonMsg(c, "Invalid time", err)
+			return
+		}
+		at = t
+	} else {
+		delay, err := time.ParseDuration(c.PostForm("delay"))
+		if err != nil {
+			jsonMsg(c, "Invalid delay", err)
+			return
+		}
+		at = time.Now().Add(delay)
+	}
+	err := a.serverService.ScheduleXrayRestart(at)
+	if err != nil {
+		jsonMsg(c, "", err)
+		return
+	}
+	jsonMsgObj(c, "Xray restart scheduled", gin.H{"scheduledRestart": at.Unix()}, nil)
+}
+
+func (a *ServerController) cancelScheduledRestart(c *gin.Context) {
+	if !a.serverService.CancelScheduledXrayRestart() {
+		jsonMsg(c, "", errors.New("no restart is scheduled"))
+		return
+	}
+	jsonMsg(c, "Scheduled xray restart canceled", nil)
+}
+
 func (a *ServerController) getLogs(c *gin.Context) {
 	count := c.Param("count")
 	level := c.PostForm("level")
 	syslog := c.PostForm("syslog")
 	logs := a.serverService.GetLogs(count, level, syslog)
+	if c.Query("parsed") == "true" {
+		jsonObj(c, service.ParseLogs(logs), nil)
+		return
+	}
 	jsonObj(c, logs, nil)
 }
 
+func (a *ServerController) getClientLogs(c *gin.Context) {
+	count, _ := strconv.Atoi(c.PostForm("count"))
+	context, _ := strconv.Atoi(c.PostForm("context"))
+	level := c.PostForm("level")
+	if level == "" {
+		level = "debug"
+	}
+	logs, err := a.serverService.GetClientLogs(c.PostForm("email"), count, level, context)
+	jsonObj(c, logs, err)
+}
+
+// clientLogStream sends the xray log lines of a client as server-sent events until the request is closed
+func (a *ServerController) clientLogStream(c *gin.Context) {
+	match, err := a.serverService.ClientLogMatcher(c.Query("email"))
+	if err != nil {
+		jsonMsg(c, "client log stream", err)
+		return
+	}
+	lines, unsubscribe := logger.Subscribe(match, 256)
+	defer unsubscribe()
+
+	c.Header("Cache-Control", "no-cache")
+	// keeps nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case line := <-lines:
+			c.SSEvent("log", line)
+		case <-ping.C:
+			c.SSEvent("ping", time.Now().Unix())
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
+
 func (a *ServerController) getConfigJson(c *gin.Context) {
 	configJson, err := a.serverService.GetConfigJson()
 	if err != nil {
@@ -134,6 +377,189 @@ func (a *ServerController) getConfigJson(c *gin.Context) {
 	jsonObj(c, configJson, nil)
 }
 
+func (a *ServerController) resyncTraffic(c *gin.Context) {
+	resync, err := a.serverService.ResyncTraffic()
+	if err != nil {
+		jsonMsg(c, "resync traffic", err)
+		return
+	}
+	jsonObj(c, resync, nil)
+}
+
+func (a *ServerController) inboundDrift(c *gin.Context) {
+	report, err := a.xrayService.GetInboundDrift()
+	if err != nil {
+		jsonMsg(c, "inbound drift", err)
+		return
+	}
+	jsonObj(c, report, nil)
+}
+
+func (a *ServerController) reconcileInbounds(c *gin.Context) {
+	report, err := a.xrayService.ReconcileInbounds()
+	if err != nil {
+		jsonMsg(c, "reconcile inbounds", err)
+		return
+	}
+	jsonMsgObj(c, "Xray restarted", report, nil)
+}
+
+func (a *ServerController) blockedConnections(c *gin.Context) {
+	count, _ := strconv.Atoi(c.Query("count"))
+	report, err := a.xrayService.GetBlockedConnections(count)
+	jsonObj(c, report, err)
+}
+
+func (a *ServerController) flushTraffic(c *gin.Context) {
+	count, err := a.serverService.FlushTraffic()
+	if err != nil {
+		jsonMsg(c, "flush traffic", err)
+		return
+	}
+	jsonObj(c, gin.H{"clients": count}, nil)
+}
+
+// benchmark takes the upload duration in seconds and the data cap in MB
+func (a *ServerController) benchmark(c *gin.Context) {
+	seconds, err := strconv.Atoi(c.DefaultPostForm("duration", "5"))
+	if err != nil {
+		jsonMsg(c, "benchmark", err)
+		return
+	}
+	megabytes, err := strconv.ParseInt(c.DefaultPostForm("maxMB", "256"), 10, 64)
+	if err != nil {
+		jsonMsg(c, "benchmark", err)
+		return
+	}
+	result, err := a.serverService.Benchmark(time.Duration(seconds)*time.Second, megabytes<<20)
+	jsonObj(c, result, err)
+}
+
+func (a *ServerController) probeDest(c *gin.Context) {
+	result, err := a.serverService.ProbeDest(c.PostForm("dest"))
+	jsonObj(c, result, err)
+}
+
+func (a *ServerController) getCertificates(c *gin.Context) {
+	certs, err := a.serverService.GetCertificates()
+	jsonObj(c, certs, err)
+}
+
+func (a *ServerController) getGeoFiles(c *gin.Context) {
+	jsonObj(c, a.serverService.GetGeoFiles(), nil)
+}
+
+func (a *ServerController) updateGeoFiles(c *gin.Context) {
+	updated, err := a.serverService.UpdateGeoFiles()
+	jsonObj(c, updated, err)
+}
+
+func (a *ServerController) exportTgConfig(c *gin.Context) {
+	config, err := a.settingService.GetTgConfig(c.Query("redact") == "true")
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, config, nil)
+}
+
+// importTgConfig saves the telegram bot settings of another panel and restarts the panel to restart the bot
+func (a *ServerController) importTgConfig(c *gin.Context) {
+	config := &service.TgConfig{}
+	err := json.Unmarshal([]byte(c.PostForm("config")), config)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err = a.settingService.SetTgConfig(config)
+	if err == nil {
+		err = a.panelService.RestartPanel(time.Second * 3)
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+func (a *ServerController) getCronJobs(c *gin.Context) {
+	jsonObj(c, a.serverService.GetCronJobs(), nil)
+}
+
+func (a *ServerController) probePort(c *gin.Context) {
+	port, err := strconv.Atoi(c.Param("port"))
+	if err != nil {
+		jsonMsg(c, "probe port", err)
+		return
+	}
+	probe, err := a.serverService.ProbePort(c.DefaultQuery("network", "tcp"), c.Query("listen"), port)
+	jsonObj(c, probe, err)
+}
+
+func (a *ServerController) statsService(c *gin.Context) {
+	enable, err := strconv.ParseBool(c.PostForm("enable"))
+	if err != nil {
+		jsonMsg(c, "xray stats service", err)
+		return
+	}
+	a.lastGetStatusTime = time.Now()
+	err = a.serverService.SetStatsService(enable)
+	jsonMsg(c, "xray stats service", err)
+}
+
+func (a *ServerController) reloadConfig(c *gin.Context) {
+	hotReload, err := a.serverService.ReloadConfig()
+	a.lastGetStatusTime = time.Now()
+	jsonObj(c, gin.H{"hotReload": hotReload}, err)
+}
+
+func (a *ServerController) testEmail(c *gin.Context) {
+	err := a.emailService.SendTestEmail()
+	jsonMsg(c, I18nWeb(c, "pages.settings.testEmail"), err)
+}
+
+func (a *ServerController) parseLink(c *gin.Context) {
+	link, err := a.serverService.ParseLink(c.PostForm("link"))
+	jsonObj(c, link, err)
+}
+
+func (a *ServerController) routingTest(c *gin.Context) {
+	req := &service.RoutingTestRequest{}
+	err := c.ShouldBind(req)
+	if err != nil {
+		jsonMsg(c, "routing test", err)
+		return
+	}
+	result, err := a.xraySettingService.TestRouting(req)
+	jsonObj(c, result, err)
+}
+
+func (a *ServerController) getOutbounds(c *gin.Context) {
+	outbounds, err := a.xrayService.GetOutboundsHealth()
+	jsonObj(c, outbounds, err)
+}
+
+func (a *ServerController) getRouting(c *gin.Context) {
+	rules, err := a.xraySettingService.GetRoutingRules()
+	jsonObj(c, rules, err)
+}
+
+// updateRouting replaces the routing rules with the json array in the rules form field
+func (a *ServerController) updateRouting(c *gin.Context) {
+	rules := make([]map[string]interface{}, 0)
+	err := json.Unmarshal([]byte(c.PostForm("rules")), &rules)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err = a.xraySettingService.SaveRoutingRules(rules)
+	if err == nil {
+		err = a.serverService.RestartXrayService()
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+func (a *ServerController) getDBStats(c *gin.Context) {
+	stats, err := a.serverService.GetDBStats()
+	jsonObj(c, stats, err)
+}
+
 func (a *ServerController) getDb(c *gin.Context) {
 	db, err := a.serverService.GetDb()
 	if err != nil {
@@ -141,9 +567,9 @@ func (a *ServerController) getDb(c *gin.Context) {
 		return
 	}
 
-	filename := "x-ui.db"
+	filename := a.settingService.GetBackupFilename()
 
-	if !filenameRegex.MatchString(filename) {
+	if !common.IsValidFilename(filename) {
 		c.AbortWithError(http.StatusBadRequest, fmt.Errorf("invalid filename"))
 		return
 	}
@@ -157,9 +583,19 @@ func (a *ServerController) getDb(c *gin.Context) {
 }
 
 func (a *ServerController) importDB(c *gin.Context) {
+	maxUploadSize, err := a.settingService.GetMaxUploadSize()
+	if err != nil {
+		jsonMsg(c, "Error reading db file", err)
+		return
+	}
+	limitRequestBody(c, maxUploadSize)
 	// Get the file from the request body
 	file, _, err := c.Request.FormFile("db")
 	if err != nil {
+		if isRequestTooLarge(err) {
+			pureJsonMsg(c, http.StatusRequestEntityTooLarge, false, fmt.Sprintf("Error reading db file: file is larger than %d MB", maxUploadSize))
+			return
+		}
 		jsonMsg(c, "Error reading db file", err)
 		return
 	}
@@ -186,3 +622,58 @@ func (a *ServerController) getNewX25519Cert(c *gin.Context) {
 	}
 	jsonObj(c, cert, nil)
 }
+
+func (a *ServerController) verifyX25519(c *gin.Context) {
+	privateKey := c.PostForm("privateKey")
+	publicKey := c.PostForm("publicKey")
+	match, err := a.serverService.VerifyX25519(privateKey, publicKey)
+	if err != nil {
+		jsonMsg(c, "verify x25519 key pair", err)
+		return
+	}
+	jsonObj(c, match, nil)
+}
+
+func (a *ServerController) getInstances(c *gin.Context) {
+	instances, err := a.xrayInstanceService.GetInstances()
+	if err != nil {
+		jsonMsg(c, "get xray instances", err)
+		return
+	}
+	jsonObj(c, instances, nil)
+}
+
+func (a *ServerController) saveInstance(c *gin.Context) {
+	instance := &service.XrayInstance{}
+	err := c.ShouldBind(instance)
+	if err != nil {
+		jsonMsg(c, "save xray instance", err)
+		return
+	}
+	err = a.xrayInstanceService.SaveInstance(instance)
+	jsonMsg(c, "save xray instance", err)
+}
+
+func (a *ServerController) delInstance(c *gin.Context) {
+	err := a.xrayInstanceService.DelInstance(c.Param("name"))
+	jsonMsg(c, "delete xray instance", err)
+}
+
+func (a *ServerController) instanceStatus(c *gin.Context) {
+	jsonObj(c, a.xrayInstanceService.GetInstanceStatus(c.Param("name")), nil)
+}
+
+func (a *ServerController) startInstance(c *gin.Context) {
+	err := a.xrayInstanceService.StartInstance(c.Param("name"))
+	jsonMsg(c, "start xray instance", err)
+}
+
+func (a *ServerController) stopInstance(c *gin.Context) {
+	err := a.xrayInstanceService.StopInstance(c.Param("name"))
+	jsonMsg(c, "stop xray instance", err)
+}
+
+func (a *ServerController) restartInstance(c *gin.Context) {
+	err := a.xrayInstanceService.RestartInstance(c.Param("name"))
+	jsonMsg(c, "restart xray instance", err)
+}
@@ -39,6 +39,10 @@ func (a *SettingController) initRouter(g *gin.RouterGroup) {
 	g.POST("/updateUser", a.updateUser)
 	g.POST("/restartPanel", a.restartPanel)
 	g.GET("/getDefaultJsonConfig", a.getDefaultXrayConfig)
+	g.GET("/singboxTemplate", a.getSingboxTemplate)
+	g.POST("/singboxTemplate", a.updateSingboxTemplate)
+	g.GET("/inboundDefaults", a.getInboundDefaults)
+	g.POST("/inboundDefaults", a.updateInboundDefaults)
 }
 
 func (a *SettingController) getAllSetting(c *gin.Context) {
@@ -108,3 +112,32 @@ func (a *SettingController) getDefaultXrayConfig(c *gin.Context) {
 	}
 	jsonObj(c, defaultJsonConfig, nil)
 }
+
+func (a *SettingController) getSingboxTemplate(c *gin.Context) {
+	template, err := a.settingService.GetSubSingboxTemplate()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, gin.H{
+		"template":        template,
+		"defaultTemplate": a.settingService.GetDefaultSubSingboxTemplate(),
+	}, nil)
+}
+
+func (a *SettingController) getInboundDefaults(c *gin.Context) {
+	defaults, err := a.settingService.GetInboundDefaults()
+	jsonObj(c, defaults, err)
+}
+
+// updateInboundDefaults takes the defaults as json in the form field defaults, an empty value removes them
+func (a *SettingController) updateInboundDefaults(c *gin.Context) {
+	err := a.settingService.SaveInboundDefaults(c.PostForm("defaults"))
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+// updateSingboxTemplate applies after the panel restarts, an empty template restores the built-in one
+func (a *SettingController) updateSingboxTemplate(c *gin.Context) {
+	err := a.settingService.SaveSubSingboxTemplate(c.PostForm("template"))
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"net"
+
+	"x-ui/sub"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubController struct{}
+
+func NewSubController(g *gin.RouterGroup) *SubController {
+	a := &SubController{}
+	a.initRouter(g)
+	return a
+}
+
+func (a *SubController) initRouter(g *gin.RouterGroup) {
+	g = g.Group("/sub")
+
+	g.GET("/preview", a.preview)
+}
+
+func (a *SubController) preview(c *gin.Context) {
+	host, _, err := net.SplitHostPort(c.Request.Host)
+	if err != nil {
+		host = c.Request.Host
+	}
+	preview, err := sub.Preview(c.Query("id"), c.Query("format"), host)
+	jsonObj(c, preview, err)
+}
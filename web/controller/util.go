@@ -1,9 +1,9 @@
 package controller
 
 import (
+	"errors"
 	"net"
 	"net/http"
-	"strings"
 
 	"x-ui/config"
 	"x-ui/logger"
@@ -12,18 +12,24 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// getRemoteIp returns the client IP, taken from the forwarded headers only when the request
+// comes from a trusted proxy
 func getRemoteIp(c *gin.Context) string {
-	value := c.GetHeader("X-Forwarded-For")
-	if value != "" {
-		ips := strings.Split(value, ",")
-		return ips[0]
-	} else {
-		addr := c.Request.RemoteAddr
-		ip, _, _ := net.SplitHostPort(addr)
-		return ip
+	return c.ClientIP()
+}
+
+// limitRequestBody caps the request body to maxSize megabytes (0 = unlimited)
+func limitRequestBody(c *gin.Context, maxSize int) {
+	if maxSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxSize)<<20)
 	}
 }
 
+func isRequestTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
 func jsonMsg(c *gin.Context, msg string, err error) {
 	jsonMsgObj(c, msg, nil, err)
 }
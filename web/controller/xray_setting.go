@@ -1,6 +1,10 @@
 package controller
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
 	"x-ui/web/service"
 
 	"github.com/gin-gonic/gin"
@@ -27,6 +31,19 @@ func (a *XraySettingController) initRouter(g *gin.RouterGroup) {
 	g.GET("/getXrayResult", a.getXrayResult)
 	g.GET("/getDefaultJsonConfig", a.getDefaultXrayConfig)
 	g.POST("/warp/:action", a.warp)
+	g.GET("/dns", a.getDNSSetting)
+	g.POST("/dns", a.updateDNSSetting)
+	g.GET("/routingStrategy", a.getRoutingStrategy)
+	g.POST("/routingStrategy", a.updateRoutingStrategy)
+	g.GET("/balancers", a.getBalancerSetting)
+	g.POST("/balancers", a.updateBalancerSetting)
+	g.POST("/proxyOutbound", a.saveProxyOutbound)
+	g.POST("/proxyOutbound/del/:tag", a.delProxyOutbound)
+	g.GET("/memTuning", a.getMemTuning)
+	g.GET("/handlers", a.getRuntimeHandlers)
+	g.POST("/handlers/:kind", a.addRuntimeHandler)
+	g.POST("/handlers/:kind/del/:tag", a.delRuntimeHandler)
+	g.POST("/memTuning", a.updateMemTuning)
 }
 
 func (a *XraySettingController) getXraySetting(c *gin.Context) {
@@ -45,8 +62,155 @@ func (a *XraySettingController) getXraySetting(c *gin.Context) {
 }
 
 func (a *XraySettingController) updateSetting(c *gin.Context) {
+	maxUploadSize, err := a.SettingService.GetMaxUploadSize()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	limitRequestBody(c, maxUploadSize)
+	err = c.Request.ParseMultipartForm(32 << 20)
+	if err != nil && err != http.ErrNotMultipart {
+		if isRequestTooLarge(err) {
+			pureJsonMsg(c, http.StatusRequestEntityTooLarge, false, fmt.Sprintf("xray config is larger than %d MB", maxUploadSize))
+			return
+		}
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
 	xraySetting := c.PostForm("xraySetting")
-	err := a.XraySettingService.SaveXraySetting(xraySetting)
+	err = a.XraySettingService.SaveXraySetting(xraySetting)
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+func (a *XraySettingController) getMemTuning(c *gin.Context) {
+	memTuning, err := a.SettingService.GetXrayMemTuning()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, memTuning, nil)
+}
+
+// updateMemTuning saves GOGC and GOMEMLIMIT and restarts xray to apply them
+func (a *XraySettingController) updateMemTuning(c *gin.Context) {
+	memTuning := &service.XrayMemTuning{}
+	err := c.ShouldBind(memTuning)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err = a.SettingService.SaveXrayMemTuning(memTuning)
+	if err == nil {
+		err = a.XrayService.RestartXray(true)
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+func (a *XraySettingController) getDNSSetting(c *gin.Context) {
+	dnsSetting, err := a.XraySettingService.GetDNSSetting()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, dnsSetting, nil)
+}
+
+func (a *XraySettingController) updateDNSSetting(c *gin.Context) {
+	dnsSetting := &service.DNSSetting{}
+	err := json.Unmarshal([]byte(c.PostForm("dns")), dnsSetting)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err = a.XraySettingService.SaveDNSSetting(dnsSetting)
+	if err == nil {
+		err = a.XrayService.RestartXray(false)
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+func (a *XraySettingController) getRoutingStrategy(c *gin.Context) {
+	strategy, err := a.XraySettingService.GetRoutingStrategy()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, strategy, nil)
+}
+
+func (a *XraySettingController) updateRoutingStrategy(c *gin.Context) {
+	strategy := &service.RoutingStrategy{}
+	err := c.ShouldBind(strategy)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err = a.XraySettingService.SaveRoutingStrategy(strategy)
+	if err == nil {
+		err = a.XrayService.RestartXray(false)
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+func (a *XraySettingController) getBalancerSetting(c *gin.Context) {
+	balancerSetting, err := a.XraySettingService.GetBalancerSetting()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, balancerSetting, nil)
+}
+
+func (a *XraySettingController) updateBalancerSetting(c *gin.Context) {
+	balancerSetting := &service.BalancerSetting{}
+	err := json.Unmarshal([]byte(c.PostForm("balancers")), balancerSetting)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	err = a.XraySettingService.SaveBalancerSetting(balancerSetting)
+	if err == nil {
+		err = a.XrayService.RestartXray(false)
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+func (a *XraySettingController) getRuntimeHandlers(c *gin.Context) {
+	jsonObj(c, a.XrayService.GetRuntimeHandlerChanges(), nil)
+}
+
+// addRuntimeHandler adds an inbound or outbound to the running xray only, it is gone after a restart
+func (a *XraySettingController) addRuntimeHandler(c *gin.Context) {
+	err := a.XrayService.ChangeRuntimeHandler(c.Param("kind"), "add", "", c.PostForm("config"))
+	jsonMsg(c, "add "+c.Param("kind")+" (not saved)", err)
+}
+
+func (a *XraySettingController) delRuntimeHandler(c *gin.Context) {
+	err := a.XrayService.ChangeRuntimeHandler(c.Param("kind"), "remove", c.Param("tag"), "")
+	jsonMsg(c, "remove "+c.Param("kind")+" (not saved)", err)
+}
+
+func (a *XraySettingController) saveProxyOutbound(c *gin.Context) {
+	outbound := &service.ProxyOutbound{}
+	err := json.Unmarshal([]byte(c.PostForm("outbound")), outbound)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	verify := c.PostForm("verify") == "true"
+	update := c.PostForm("update") == "true"
+	err = a.XraySettingService.SaveProxyOutbound(outbound, verify, update)
+	if err == nil {
+		a.XrayService.SetToNeedRestart()
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+func (a *XraySettingController) delProxyOutbound(c *gin.Context) {
+	err := a.XraySettingService.DelProxyOutbound(c.Param("tag"))
+	if err == nil {
+		a.XrayService.SetToNeedRestart()
+	}
 	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
 }
 
@@ -10,6 +10,7 @@ type XUIController struct {
 	inboundController     *InboundController
 	settingController     *SettingController
 	xraySettingController *XraySettingController
+	subController         *SubController
 }
 
 func NewXUIController(g *gin.RouterGroup) *XUIController {
@@ -30,6 +31,7 @@ func (a *XUIController) initRouter(g *gin.RouterGroup) {
 	a.inboundController = NewInboundController(g)
 	a.settingController = NewSettingController(g)
 	a.xraySettingController = NewXraySettingController(g)
+	a.subController = NewSubController(g)
 }
 
 func (a *XUIController) index(c *gin.Context) {
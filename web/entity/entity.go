@@ -2,7 +2,10 @@ package entity
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"net"
+	"net/mail"
+	"net/url"
 	"strings"
 	"time"
 
@@ -16,42 +19,115 @@ type Msg struct {
 }
 
 type AllSetting struct {
-	WebListen        string `json:"webListen" form:"webListen"`
-	WebDomain        string `json:"webDomain" form:"webDomain"`
-	WebPort          int    `json:"webPort" form:"webPort"`
-	WebCertFile      string `json:"webCertFile" form:"webCertFile"`
-	WebKeyFile       string `json:"webKeyFile" form:"webKeyFile"`
-	WebBasePath      string `json:"webBasePath" form:"webBasePath"`
-	SessionMaxAge    int    `json:"sessionMaxAge" form:"sessionMaxAge"`
-	PageSize         int    `json:"pageSize" form:"pageSize"`
-	ExpireDiff       int    `json:"expireDiff" form:"expireDiff"`
-	TrafficDiff      int    `json:"trafficDiff" form:"trafficDiff"`
-	RemarkModel      string `json:"remarkModel" form:"remarkModel"`
-	TgBotEnable      bool   `json:"tgBotEnable" form:"tgBotEnable"`
-	TgBotToken       string `json:"tgBotToken" form:"tgBotToken"`
-	TgBotChatId      string `json:"tgBotChatId" form:"tgBotChatId"`
-	TgRunTime        string `json:"tgRunTime" form:"tgRunTime"`
-	TgBotBackup      bool   `json:"tgBotBackup" form:"tgBotBackup"`
-	TgBotLoginNotify bool   `json:"tgBotLoginNotify" form:"tgBotLoginNotify"`
-	TgCpu            int    `json:"tgCpu" form:"tgCpu"`
-	TgLang           string `json:"tgLang" form:"tgLang"`
-	TimeLocation     string `json:"timeLocation" form:"timeLocation"`
-	SubEnable        bool   `json:"subEnable" form:"subEnable"`
-	SubListen        string `json:"subListen" form:"subListen"`
-	SubPort          int    `json:"subPort" form:"subPort"`
-	SubPath          string `json:"subPath" form:"subPath"`
-	SubDomain        string `json:"subDomain" form:"subDomain"`
-	SubCertFile      string `json:"subCertFile" form:"subCertFile"`
-	SubKeyFile       string `json:"subKeyFile" form:"subKeyFile"`
-	SubUpdates       int    `json:"subUpdates" form:"subUpdates"`
-	SubEncrypt       bool   `json:"subEncrypt" form:"subEncrypt"`
-	SubShowInfo      bool   `json:"subShowInfo" form:"subShowInfo"`
-	SubURI           string `json:"subURI" form:"subURI"`
-	SubJsonPath      string `json:"subJsonPath" form:"subJsonPath"`
-	SubJsonURI       string `json:"subJsonURI" form:"subJsonURI"`
-	SubJsonFragment  string `json:"subJsonFragment" form:"subJsonFragment"`
-	SubJsonMux       string `json:"subJsonMux" form:"subJsonMux"`
-	SubJsonRules     string `json:"subJsonRules" form:"subJsonRules"`
+	WebListen          string `json:"webListen" form:"webListen"`
+	WebDomain          string `json:"webDomain" form:"webDomain"`
+	TrustedProxies     string `json:"trustedProxies" form:"trustedProxies"`
+	WebPort            int    `json:"webPort" form:"webPort"`
+	WebCertFile        string `json:"webCertFile" form:"webCertFile"`
+	WebKeyFile         string `json:"webKeyFile" form:"webKeyFile"`
+	WebSelfSigned      bool   `json:"webSelfSigned" form:"webSelfSigned"`
+	WebBasePath        string `json:"webBasePath" form:"webBasePath"`
+	SessionMaxAge      int    `json:"sessionMaxAge" form:"sessionMaxAge"`
+	SessionIdleTimeout int    `json:"sessionIdleTimeout" form:"sessionIdleTimeout"`
+	RememberMeDays     int    `json:"rememberMeDays" form:"rememberMeDays"`
+	PageSize           int    `json:"pageSize" form:"pageSize"`
+	MaxUploadSize      int    `json:"maxUploadSize" form:"maxUploadSize"`
+	MetricsToken       string `json:"metricsToken" form:"metricsToken"`
+	MetricsClients     bool   `json:"metricsClients" form:"metricsClients"`
+	XrayWatchdog       bool   `json:"xrayWatchdog" form:"xrayWatchdog"`
+	XrayWatchdogMax    int    `json:"xrayWatchdogMax" form:"xrayWatchdogMax"`
+	BackupFilename     string `json:"backupFilename" form:"backupFilename"`
+	GeoUpdateInterval  int    `json:"geoUpdateInterval" form:"geoUpdateInterval"`
+	GeoUpdateSource    string `json:"geoUpdateSource" form:"geoUpdateSource"`
+	XrayVersionRetries int    `json:"xrayVersionRetries" form:"xrayVersionRetries"`
+	XrayVersionTimeout int    `json:"xrayVersionTimeout" form:"xrayVersionTimeout"`
+	XrayDownloadConns  int    `json:"xrayDownloadConns" form:"xrayDownloadConns"`
+	PanelDNS           string `json:"panelDns" form:"panelDns"`
+	PanelProxy         string `json:"panelProxy" form:"panelProxy"`
+	InboundBind        string `json:"inboundBind" form:"inboundBind"`
+	BlockedLog         bool   `json:"blockedLog" form:"blockedLog"`
+	MaxConcurrentReqs  int    `json:"maxConcurrentReqs" form:"maxConcurrentReqs"`
+	LoginRetention     int    `json:"loginRetention" form:"loginRetention"`
+	TrafficRetention   int    `json:"trafficRetention" form:"trafficRetention"`
+	AccessLogEnable    bool   `json:"accessLogEnable" form:"accessLogEnable"`
+	AccessLogRetention int    `json:"accessLogRetention" form:"accessLogRetention"`
+	ExpireDiff         int    `json:"expireDiff" form:"expireDiff"`
+	TrafficDiff        int    `json:"trafficDiff" form:"trafficDiff"`
+	TrafficAlert       int    `json:"trafficAlert" form:"trafficAlert"`
+	TrafficGrace       int    `json:"trafficGrace" form:"trafficGrace"`
+	TrialTraffic       int    `json:"trialTraffic" form:"trialTraffic"`
+	TrialDuration      int    `json:"trialDuration" form:"trialDuration"`
+	TrialPerIp         int    `json:"trialPerIp" form:"trialPerIp"`
+	RemarkModel        string `json:"remarkModel" form:"remarkModel"`
+	TgBotEnable        bool   `json:"tgBotEnable" form:"tgBotEnable"`
+	TgBotToken         string `json:"tgBotToken" form:"tgBotToken"`
+	TgBotChatId        string `json:"tgBotChatId" form:"tgBotChatId"`
+	TgRunTime          string `json:"tgRunTime" form:"tgRunTime"`
+	TgBotBackup        bool   `json:"tgBotBackup" form:"tgBotBackup"`
+	TgBotLoginNotify   bool   `json:"tgBotLoginNotify" form:"tgBotLoginNotify"`
+	TgCpu              int    `json:"tgCpu" form:"tgCpu"`
+	TgLang             string `json:"tgLang" form:"tgLang"`
+	EmailEnable        bool   `json:"emailEnable" form:"emailEnable"`
+	SmtpHost           string `json:"smtpHost" form:"smtpHost"`
+	SmtpPort           int    `json:"smtpPort" form:"smtpPort"`
+	SmtpSecurity       string `json:"smtpSecurity" form:"smtpSecurity"`
+	SmtpUsername       string `json:"smtpUsername" form:"smtpUsername"`
+	SmtpPassword       string `json:"smtpPassword" form:"smtpPassword"`
+	EmailFrom          string `json:"emailFrom" form:"emailFrom"`
+	EmailTo            string `json:"emailTo" form:"emailTo"`
+	TimeLocation       string `json:"timeLocation" form:"timeLocation"`
+	SubEnable          bool   `json:"subEnable" form:"subEnable"`
+	SubListen          string `json:"subListen" form:"subListen"`
+	SubPort            int    `json:"subPort" form:"subPort"`
+	SubPath            string `json:"subPath" form:"subPath"`
+	SubDomain          string `json:"subDomain" form:"subDomain"`
+	SubCertFile        string `json:"subCertFile" form:"subCertFile"`
+	SubKeyFile         string `json:"subKeyFile" form:"subKeyFile"`
+	SubUpdates         int    `json:"subUpdates" form:"subUpdates"`
+	SubEncrypt         bool   `json:"subEncrypt" form:"subEncrypt"`
+	SubShowInfo        bool   `json:"subShowInfo" form:"subShowInfo"`
+	SubURI             string `json:"subURI" form:"subURI"`
+	SubJsonPath        string `json:"subJsonPath" form:"subJsonPath"`
+	SubJsonURI         string `json:"subJsonURI" form:"subJsonURI"`
+	SubJsonFragment    string `json:"subJsonFragment" form:"subJsonFragment"`
+	SubJsonMux         string `json:"subJsonMux" form:"subJsonMux"`
+	SubJsonRules       string `json:"subJsonRules" form:"subJsonRules"`
+	SubHeaders         string `json:"subHeaders" form:"subHeaders"`
+}
+
+// ReservedSubHeaders are set by the subscription service itself and can not be overridden
+var ReservedSubHeaders = []string{
+	"Content-Length",
+	"Content-Type",
+	"Content-Encoding",
+	"Transfer-Encoding",
+	"Connection",
+	"Subscription-Userinfo",
+	"Profile-Update-Interval",
+	"Profile-Title",
+}
+
+// ParseSubHeaders parses the custom subscription headers, a JSON object of header names to values
+func ParseSubHeaders(headers string) (map[string]string, error) {
+	result := map[string]string{}
+	if strings.TrimSpace(headers) == "" {
+		return result, nil
+	}
+	err := json.Unmarshal([]byte(headers), &result)
+	if err != nil {
+		return nil, common.NewError("sub headers is not a valid JSON object:", err)
+	}
+	for name, value := range result {
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			return nil, common.NewError("sub header is not valid:", name)
+		}
+		for _, reserved := range ReservedSubHeaders {
+			if strings.EqualFold(name, reserved) {
+				return nil, common.NewError("sub header is reserved:", name)
+			}
+		}
+	}
+	return result, nil
 }
 
 func (s *AllSetting) CheckValid() error {
@@ -69,6 +145,16 @@ func (s *AllSetting) CheckValid() error {
 		}
 	}
 
+	for _, proxy := range strings.Split(s.TrustedProxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" || net.ParseIP(proxy) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(proxy); err != nil {
+			return common.NewError("trusted proxy is not a valid ip or cidr:", proxy)
+		}
+	}
+
 	if s.WebPort <= 0 || s.WebPort > 65535 {
 		return common.NewError("web port is not a valid port:", s.WebPort)
 	}
@@ -77,6 +163,114 @@ func (s *AllSetting) CheckValid() error {
 		return common.NewError("Sub port is not a valid port:", s.SubPort)
 	}
 
+	if s.AccessLogRetention < 0 {
+		return common.NewError("access log retention is not valid:", s.AccessLogRetention)
+	}
+
+	if s.LoginRetention < 0 {
+		return common.NewError("login attempts retention is not valid:", s.LoginRetention)
+	}
+	if s.TrafficRetention < 0 {
+		return common.NewError("traffic history retention is not valid:", s.TrafficRetention)
+	}
+
+	if s.MaxConcurrentReqs < 0 {
+		return common.NewError("max concurrent requests is not valid:", s.MaxConcurrentReqs)
+	}
+
+	switch s.InboundBind {
+	case "", "ipv4", "dual":
+	default:
+		return common.NewError("inbound bind is not valid:", s.InboundBind)
+	}
+
+	if s.XrayWatchdogMax < 0 {
+		return common.NewError("xray watchdog max attempts is not valid:", s.XrayWatchdogMax)
+	}
+
+	if s.BackupFilename != "" && !common.IsValidFilename(common.FormatFilename(s.BackupFilename, time.Now())) {
+		return common.NewError("backup file name template gives an invalid file name:", s.BackupFilename)
+	}
+
+	if s.TrafficAlert < 0 || s.TrafficAlert > 100 {
+		return common.NewError("traffic alert percent is not valid:", s.TrafficAlert)
+	}
+	if s.TrafficGrace < 0 || s.TrafficGrace > 100 {
+		return common.NewError("traffic grace percent is not valid:", s.TrafficGrace)
+	}
+	if s.TrialTraffic < 1 {
+		return common.NewError("trial traffic must be at least 1 MB:", s.TrialTraffic)
+	}
+	if s.TrialDuration < 1 || s.TrialDuration > 720 {
+		return common.NewError("trial duration must be between 1 and 720 hours:", s.TrialDuration)
+	}
+	if s.TrialPerIp < 0 {
+		return common.NewError("trials per ip is not valid:", s.TrialPerIp)
+	}
+
+	if s.GeoUpdateInterval < 0 {
+		return common.NewError("geo files update interval is not valid:", s.GeoUpdateInterval)
+	}
+	if !strings.HasPrefix(s.GeoUpdateSource, "https://") {
+		return common.NewError("geo files source must be an https url:", s.GeoUpdateSource)
+	}
+
+	if s.XrayVersionRetries < 0 || s.XrayVersionRetries > 10 {
+		return common.NewError("xray versions retries must be between 0 and 10:", s.XrayVersionRetries)
+	}
+	if s.XrayVersionTimeout < 1 || s.XrayVersionTimeout > 120 {
+		return common.NewError("xray versions timeout must be between 1 and 120 seconds:", s.XrayVersionTimeout)
+	}
+	if s.XrayDownloadConns < 1 || s.XrayDownloadConns > 16 {
+		return common.NewError("xray download connections must be between 1 and 16:", s.XrayDownloadConns)
+	}
+	if s.PanelDNS != "" {
+		u, err := url.Parse(s.PanelDNS)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "tls") || u.Hostname() == "" {
+			return common.NewError("panel dns server must be an https:// or tls:// url:", s.PanelDNS)
+		}
+	}
+	if s.PanelProxy != "" {
+		u, err := url.Parse(s.PanelProxy)
+		if err != nil || (u.Scheme != "socks5" && u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.Port() == "" {
+			return common.NewError("panel proxy must be a socks5, http or https url with a port:", s.PanelProxy)
+		}
+	}
+
+	if s.SessionMaxAge < 0 {
+		return common.NewError("session duration is not valid:", s.SessionMaxAge)
+	}
+	if s.SessionIdleTimeout < 0 {
+		return common.NewError("session idle timeout is not valid:", s.SessionIdleTimeout)
+	}
+	if s.RememberMeDays < 0 || s.RememberMeDays > 365 {
+		return common.NewError("remember me days must be between 0 and 365:", s.RememberMeDays)
+	}
+	if s.MaxUploadSize < 0 {
+		return common.NewError("max upload size is not valid:", s.MaxUploadSize)
+	}
+
+	switch s.SmtpSecurity {
+	case "none", "starttls", "tls":
+	default:
+		return common.NewError("smtp security is not valid:", s.SmtpSecurity)
+	}
+
+	if s.EmailEnable {
+		if s.SmtpHost == "" {
+			return common.NewError("smtp host is empty")
+		}
+		if s.SmtpPort <= 0 || s.SmtpPort > 65535 {
+			return common.NewError("smtp port is not a valid port:", s.SmtpPort)
+		}
+		if _, err := mail.ParseAddress(s.EmailFrom); err != nil {
+			return common.NewError("email sender is not valid:", s.EmailFrom)
+		}
+		if _, err := mail.ParseAddressList(s.EmailTo); err != nil {
+			return common.NewError("email recipients are not valid:", s.EmailTo)
+		}
+	}
+
 	if s.SubPort == s.WebPort {
 		return common.NewError("Sub and Web could not use same port:", s.SubPort)
 	}
@@ -116,6 +310,10 @@ func (s *AllSetting) CheckValid() error {
 		s.SubJsonPath += "/"
 	}
 
+	if _, err := ParseSubHeaders(s.SubHeaders); err != nil {
+		return err
+	}
+
 	_, err := time.LoadLocation(s.TimeLocation)
 	if err != nil {
 		return common.NewError("time location not exist:", s.TimeLocation)
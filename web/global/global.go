@@ -5,11 +5,13 @@ import (
 	_ "unsafe"
 
 	"github.com/robfig/cron/v3"
+	"go.uber.org/atomic"
 )
 
 var (
 	webServer WebServer
 	subServer SubServer
+	isReady   atomic.Bool
 )
 
 type WebServer interface {
@@ -36,3 +38,12 @@ func SetSubServer(s SubServer) {
 func GetSubServer() SubServer {
 	return subServer
 }
+
+// SetReady marks whether the panel has finished its startup sequence
+func SetReady(ready bool) {
+	isReady.Store(ready)
+}
+
+func IsReady() bool {
+	return isReady.Load()
+}
@@ -0,0 +1,28 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type CheckOutboundsJob struct {
+	xrayService service.XrayService
+}
+
+func NewCheckOutboundsJob() *CheckOutboundsJob {
+	return new(CheckOutboundsJob)
+}
+
+func (j *CheckOutboundsJob) Run() {
+	err := j.RunErr()
+	if err != nil {
+		logger.Warning("probe outbounds failed:", err)
+	}
+}
+
+func (j *CheckOutboundsJob) RunErr() error {
+	if !j.xrayService.IsXrayRunning() {
+		return nil
+	}
+	return j.xrayService.ProbeOutbounds()
+}
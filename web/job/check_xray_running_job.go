@@ -3,9 +3,7 @@ package job
 import "x-ui/web/service"
 
 type CheckXrayRunningJob struct {
-	xrayService service.XrayService
-
-	checkTime int
+	serverService service.ServerService
 }
 
 func NewCheckXrayRunningJob() *CheckXrayRunningJob {
@@ -13,13 +11,5 @@ func NewCheckXrayRunningJob() *CheckXrayRunningJob {
 }
 
 func (j *CheckXrayRunningJob) Run() {
-	if j.xrayService.IsXrayRunning() {
-		j.checkTime = 0
-		return
-	}
-	j.checkTime++
-	if j.checkTime < 2 {
-		return
-	}
-	j.xrayService.SetToNeedRestart()
+	j.serverService.RunXrayWatchdog()
 }
@@ -0,0 +1,40 @@
+package job
+
+import (
+	"time"
+
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type ClearLoginAttemptsJob struct {
+	settingService service.SettingService
+	userService    service.UserService
+}
+
+func NewClearLoginAttemptsJob() *ClearLoginAttemptsJob {
+	return new(ClearLoginAttemptsJob)
+}
+
+func (j *ClearLoginAttemptsJob) Run() {
+	err := j.RunErr()
+	if err != nil {
+		logger.Warning("clear login attempts failed:", err)
+	}
+}
+
+func (j *ClearLoginAttemptsJob) RunErr() error {
+	days, err := j.settingService.GetLoginAttemptsRetention()
+	if err != nil || days <= 0 {
+		return nil
+	}
+	before := time.Now().AddDate(0, 0, -days).Unix()
+	count, err := j.userService.DelLoginAttemptsBefore(before)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Debugf("%v old login attempts cleared", count)
+	}
+	return nil
+}
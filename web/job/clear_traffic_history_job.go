@@ -0,0 +1,40 @@
+package job
+
+import (
+	"time"
+
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type ClearTrafficHistoryJob struct {
+	settingService service.SettingService
+	inboundService service.InboundService
+}
+
+func NewClearTrafficHistoryJob() *ClearTrafficHistoryJob {
+	return new(ClearTrafficHistoryJob)
+}
+
+func (j *ClearTrafficHistoryJob) Run() {
+	err := j.RunErr()
+	if err != nil {
+		logger.Warning("clear traffic history failed:", err)
+	}
+}
+
+func (j *ClearTrafficHistoryJob) RunErr() error {
+	days, err := j.settingService.GetTrafficHistoryRetention()
+	if err != nil || days <= 0 {
+		return nil
+	}
+	before := time.Now().AddDate(0, 0, -days).UnixMilli()
+	count, err := j.inboundService.DelTrafficHistoryBefore(before)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		logger.Debugf("%v old traffic history buckets cleared", count)
+	}
+	return nil
+}
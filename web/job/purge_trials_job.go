@@ -0,0 +1,34 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type PurgeTrialsJob struct {
+	inboundService service.InboundService
+	xrayService    service.XrayService
+}
+
+func NewPurgeTrialsJob() *PurgeTrialsJob {
+	return new(PurgeTrialsJob)
+}
+
+func (j *PurgeTrialsJob) Run() {
+	err := j.RunErr()
+	if err != nil {
+		logger.Warning("purge expired trials failed:", err)
+	}
+}
+
+func (j *PurgeTrialsJob) RunErr() error {
+	result, err := j.inboundService.PurgeExpiredTrials()
+	if err != nil {
+		return err
+	}
+	if result.Count > 0 {
+		logger.Infof("%v expired trial clients purged", result.Count)
+		j.xrayService.SetToNeedRestart()
+	}
+	return nil
+}
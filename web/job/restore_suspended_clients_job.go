@@ -0,0 +1,30 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type RestoreSuspendedClientsJob struct {
+	xrayService    service.XrayService
+	inboundService service.InboundService
+}
+
+func NewRestoreSuspendedClientsJob() *RestoreSuspendedClientsJob {
+	return new(RestoreSuspendedClientsJob)
+}
+
+func (j *RestoreSuspendedClientsJob) Run() {
+	err := j.RunErr()
+	if err != nil {
+		logger.Warning("restore suspended clients failed:", err)
+	}
+}
+
+func (j *RestoreSuspendedClientsJob) RunErr() error {
+	restored, err := j.inboundService.RestoreSuspendedClients()
+	if len(restored) > 0 {
+		j.xrayService.SetToNeedRestart()
+	}
+	return err
+}
@@ -12,8 +12,10 @@ const (
 )
 
 type StatsNotifyJob struct {
-	xrayService  service.XrayService
-	tgbotService service.Tgbot
+	xrayService    service.XrayService
+	tgbotService   service.Tgbot
+	settingService service.SettingService
+	emailService   service.EmailService
 }
 
 func NewStatsNotifyJob() *StatsNotifyJob {
@@ -25,5 +27,9 @@ func (j *StatsNotifyJob) Run() {
 	if !j.xrayService.IsXrayRunning() {
 		return
 	}
-	j.tgbotService.SendReport()
+	isTgbotenabled, err := j.settingService.GetTgbotenabled()
+	if err == nil && isTgbotenabled {
+		j.tgbotService.SendReport()
+	}
+	j.emailService.SendReport()
 }
@@ -0,0 +1,25 @@
+package job
+
+import (
+	"x-ui/logger"
+	"x-ui/web/service"
+)
+
+type TrafficAlertJob struct {
+	inboundService service.InboundService
+}
+
+func NewTrafficAlertJob() *TrafficAlertJob {
+	return new(TrafficAlertJob)
+}
+
+func (j *TrafficAlertJob) Run() {
+	err := j.RunErr()
+	if err != nil {
+		logger.Warning("check traffic alerts failed:", err)
+	}
+}
+
+func (j *TrafficAlertJob) RunErr() error {
+	return j.inboundService.CheckTrafficAlerts()
+}
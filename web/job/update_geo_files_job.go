@@ -0,0 +1,23 @@
+package job
+
+import (
+	"x-ui/web/service"
+)
+
+type UpdateGeoFilesJob struct {
+	serverService service.ServerService
+}
+
+func NewUpdateGeoFilesJob() *UpdateGeoFilesJob {
+	return new(UpdateGeoFilesJob)
+}
+
+func (j *UpdateGeoFilesJob) Run() {
+	// failures are logged and notified by the update itself
+	j.RunErr()
+}
+
+func (j *UpdateGeoFilesJob) RunErr() error {
+	_, err := j.serverService.UpdateGeoFiles()
+	return err
+}
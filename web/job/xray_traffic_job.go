@@ -6,8 +6,7 @@ import (
 )
 
 type XrayTrafficJob struct {
-	xrayService    service.XrayService
-	inboundService service.InboundService
+	xrayService service.XrayService
 }
 
 func NewXrayTrafficJob() *XrayTrafficJob {
@@ -15,20 +14,17 @@ func NewXrayTrafficJob() *XrayTrafficJob {
 }
 
 func (j *XrayTrafficJob) Run() {
-	if !j.xrayService.IsXrayRunning() {
-		return
-	}
-
-	traffics, clientTraffics, err := j.xrayService.GetXrayTraffic()
-	if err != nil {
-		logger.Warning("get xray traffic failed:", err)
-		return
-	}
-	err, needRestart := j.inboundService.AddTraffic(traffics, clientTraffics)
+	err := j.RunErr()
 	if err != nil {
-		logger.Warning("add traffic failed:", err)
+		logger.Warning("xray traffic job failed:", err)
 	}
-	if needRestart {
-		j.xrayService.SetToNeedRestart()
+}
+
+func (j *XrayTrafficJob) RunErr() error {
+	if !j.xrayService.IsXrayRunning() {
+		return nil
 	}
+
+	_, _, err := j.xrayService.SyncTraffic()
+	return err
 }
@@ -76,6 +76,11 @@ func I18n(i18nType I18nType, key string, params ...string) string {
 		return ""
 	}
 
+	return Localize(localizer, key, params...)
+}
+
+// Localize translates the key using the given localizer
+func Localize(localizer *i18n.Localizer, key string, params ...string) string {
 	templateData := createTemplateData(params)
 
 	msg, err := localizer.Localize(&i18n.LocalizeConfig{
@@ -104,15 +109,19 @@ func LocalizerMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var lang string
 
-		if cookie, err := c.Request.Cookie("lang"); err == nil {
+		// The lang query parameter lets API consumers force a language per request
+		if queryLang := c.Query("lang"); queryLang != "" {
+			lang = queryLang
+		} else if cookie, err := c.Request.Cookie("lang"); err == nil {
 			lang = cookie.Value
 		} else {
 			lang = c.GetHeader("Accept-Language")
 		}
 
-		LocalizerWeb = i18n.NewLocalizer(i18nBundle, lang)
+		localizer := i18n.NewLocalizer(i18nBundle, lang)
+		LocalizerWeb = localizer
 
-		c.Set("localizer", LocalizerWeb)
+		c.Set("localizer", localizer)
 		c.Set("I18n", I18n)
 		c.Next()
 	}
@@ -143,3 +152,17 @@ func parseTranslationFiles(i18nFS embed.FS, i18nBundle *i18n.Bundle) error {
 
 	return nil
 }
+
+// IsSupported reports whether a translation file was loaded for lang
+func IsSupported(lang string) bool {
+	tag, err := language.Parse(lang)
+	if err != nil || i18nBundle == nil {
+		return false
+	}
+	for _, t := range i18nBundle.LanguageTags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"time"
+
+	"x-ui/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLogMiddleware writes every request to the panel access log when it is enabled
+func AccessLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !logger.IsAccessLogEnabled() {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		c.Next()
+		logger.Access("%s %s %s %d %v", c.ClientIP(), c.Request.Method, c.Request.URL.Path, c.Writer.Status(), time.Since(start).Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/atomic"
+)
+
+// the limit is read again at most this often, so changing it needs no restart
+const concurrencyLimitRefresh = 10 * time.Second
+
+// ConcurrencyLimitMiddleware rejects requests with 429 while the number of requests in flight
+// is at the limit returned by getLimit (0 = unlimited). Requests for which skip returns true
+// are neither limited nor counted.
+func ConcurrencyLimitMiddleware(getLimit func() (int, error), skip func(c *gin.Context) bool) gin.HandlerFunc {
+	var (
+		inFlight    atomic.Int64
+		limit       atomic.Int64
+		lock        sync.Mutex
+		lastRefresh time.Time
+	)
+	refreshLimit := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if time.Since(lastRefresh) < concurrencyLimitRefresh {
+			return
+		}
+		lastRefresh = time.Now()
+		if value, err := getLimit(); err == nil {
+			limit.Store(int64(value))
+		}
+	}
+
+	return func(c *gin.Context) {
+		if skip != nil && skip(c) {
+			c.Next()
+			return
+		}
+		refreshLimit()
+
+		current := inFlight.Inc()
+		defer inFlight.Dec()
+		if max := limit.Load(); max > 0 && current > max {
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+
+		c.Next()
+	}
+}
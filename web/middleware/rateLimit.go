@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware rejects requests with 429 once a client ip made limit requests
+// in the current window.
+func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
+	var (
+		lock        sync.Mutex
+		counts      = make(map[string]int)
+		windowStart = time.Now()
+	)
+
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+
+		lock.Lock()
+		if time.Since(windowStart) >= window {
+			counts = make(map[string]int)
+			windowStart = time.Now()
+		}
+		counts[ip]++
+		count := counts[ip]
+		retryAfter := window - time.Since(windowStart)
+		lock.Unlock()
+
+		if count > limit {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			c.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenAuthMiddleware only lets requests carrying the token returned by getToken through,
+// either as a bearer token or as the token query parameter. An empty token disables the route.
+func TokenAuthMiddleware(getToken func() (string, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := getToken()
+		if err != nil || token == "" {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		reqToken := c.Query("token")
+		if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			reqToken = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(reqToken), []byte(token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+
+	"x-ui/util/json_util"
+	"x-ui/xray"
+)
+
+// BlockedSource is a source address with the number of its connections routed to a blackhole
+type BlockedSource struct {
+	IP    string `json:"ip"`
+	Count int    `json:"count"`
+	Last  string `json:"last"`
+}
+
+type BlockedReport struct {
+	Enabled bool `json:"enabled"`
+	// the access log file of the template, nothing is captured while xray writes to it
+	AccessFile string           `json:"accessFile,omitempty"`
+	Tags       []string         `json:"tags"`
+	Total      int              `json:"total"`
+	Sources    []*BlockedSource `json:"sources"`
+	Entries    []*LogEntry      `json:"entries"`
+}
+
+// logAccess returns the access log of a log config, "" being stdout
+func logAccess(logConfig json_util.RawMessage) string {
+	log := struct {
+		Access string `json:"access"`
+	}{}
+	if len(logConfig) > 0 {
+		json.Unmarshal(logConfig, &log)
+	}
+	return log.Access
+}
+
+// enableAccessLog makes xray write its access log to stdout, where the log writer captures
+// the blocked connections. Only an access log turned off with "none" is changed, a file set
+// in the template is kept.
+func (s *XrayService) enableAccessLog(logConfig json_util.RawMessage) (json_util.RawMessage, error) {
+	if logAccess(logConfig) != "none" {
+		return logConfig, nil
+	}
+	log := map[string]interface{}{}
+	err := json.Unmarshal(logConfig, &log)
+	if err != nil {
+		return nil, err
+	}
+	log["access"] = ""
+	return json.MarshalIndent(log, "", "  ")
+}
+
+// blackholeTags returns the tags of the blackhole outbounds of xrayConfig
+func blackholeTags(xrayConfig *xray.Config) []string {
+	outbounds := make([]map[string]interface{}, 0)
+	json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds)
+	tags := make([]string, 0)
+	for _, outbound := range outbounds {
+		if protocol, _ := outbound["protocol"].(string); protocol != "blackhole" {
+			continue
+		}
+		if tag, _ := outbound["tag"].(string); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// captureBlockedLog sets up the log writer for the config xray is started with. The other
+// access log lines are kept out of the panel log when the access log is only on for this.
+func (s *XrayService) captureBlockedLog(xrayConfig *xray.Config) {
+	enabled, err := s.settingService.GetBlockedLog()
+	if err != nil || !enabled || logAccess(xrayConfig.LogConfig) != "" {
+		xray.SetBlockedLog(nil, false)
+		return
+	}
+	quiet := false
+	if template, err := s.settingService.GetXrayConfigTemplate(); err == nil {
+		templateConfig := &xray.Config{}
+		if json.Unmarshal([]byte(template), templateConfig) == nil {
+			quiet = logAccess(templateConfig.LogConfig) == "none"
+		}
+	}
+	xray.SetBlockedLog(blackholeTags(xrayConfig), quiet)
+}
+
+// GetBlockedConnections returns the last count access log lines routed to a blackhole outbound,
+// with their sources ordered by count. The lines are kept apart from the panel log, the last
+// thousand of them since xray started.
+func (s *XrayService) GetBlockedConnections(count int) (*BlockedReport, error) {
+	enabled, err := s.settingService.GetBlockedLog()
+	if err != nil {
+		return nil, err
+	}
+	xrayConfig, err := s.GetXrayConfig()
+	if err != nil {
+		return nil, err
+	}
+	report := &BlockedReport{
+		Enabled: enabled,
+		Tags:    blackholeTags(xrayConfig),
+		Sources: make([]*BlockedSource, 0),
+		Entries: make([]*LogEntry, 0),
+	}
+	if access := logAccess(xrayConfig.LogConfig); access != "" && access != "none" {
+		report.AccessFile = access
+	}
+	if count <= 0 {
+		count = 1000
+	}
+
+	sources := map[string]*BlockedSource{}
+	// the lines come newest first
+	for _, line := range xray.GetBlockedLines(count) {
+		entry := &LogEntry{Raw: line, Message: line, Parsed: true}
+		parseXrayAccess(entry, line)
+		if entry.Source == "" {
+			continue
+		}
+		// the source may carry the network, "tcp:1.2.3.4:5678"
+		ip := strings.TrimPrefix(strings.TrimPrefix(entry.Source, "tcp:"), "udp:")
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		source, ok := sources[ip]
+		if !ok {
+			source = &BlockedSource{IP: ip, Last: entry.Time}
+			sources[ip] = source
+			report.Sources = append(report.Sources, source)
+		}
+		source.Count++
+		report.Total++
+		report.Entries = append(report.Entries, entry)
+	}
+	sort.SliceStable(report.Sources, func(i, j int) bool {
+		return report.Sources[i].Count > report.Sources[j].Count
+	})
+	return report, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"strings"
+	"time"
+)
+
+const certExpiringDays = 30
+
+// CertificateInfo describes one configured certificate, Source is panel, subscription or inbound.
+// Error is set instead of the certificate fields when the certificate could not be read.
+type CertificateInfo struct {
+	Source    string   `json:"source"`
+	InboundId int      `json:"inboundId,omitempty"`
+	Remark    string   `json:"remark,omitempty"`
+	File      string   `json:"file,omitempty"`
+	Subject   string   `json:"subject,omitempty"`
+	SANs      []string `json:"sans,omitempty"`
+	Issuer    string   `json:"issuer,omitempty"`
+	NotBefore int64    `json:"notBefore,omitempty"`
+	NotAfter  int64    `json:"notAfter,omitempty"`
+	DaysLeft  int      `json:"daysLeft"`
+	Expiring  bool     `json:"expiring"`
+	Expired   bool     `json:"expired"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// fill sets the fields of info from the first certificate in certPEM, which is the leaf
+func (info *CertificateInfo) fill(certPEM []byte, now time.Time) {
+	var block *pem.Block
+	for {
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil || block.Type == "CERTIFICATE" {
+			break
+		}
+	}
+	if block == nil {
+		info.Error = "no certificate found"
+		return
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		info.Error = err.Error()
+		return
+	}
+	info.Subject = cert.Subject.String()
+	info.Issuer = cert.Issuer.String()
+	info.SANs = append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	info.NotBefore = cert.NotBefore.UnixMilli()
+	info.NotAfter = cert.NotAfter.UnixMilli()
+	info.DaysLeft = int(cert.NotAfter.Sub(now).Hours() / 24)
+	info.Expired = now.After(cert.NotAfter)
+	info.Expiring = !info.Expired && info.DaysLeft < certExpiringDays
+}
+
+func certificateFromFile(info *CertificateInfo, file string, now time.Time) *CertificateInfo {
+	info.File = file
+	certPEM, err := os.ReadFile(file)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	info.fill(certPEM, now)
+	return info
+}
+
+// GetCertificates returns the certificates of the panel, the subscription server and the tls inbounds
+func (s *ServerService) GetCertificates() ([]*CertificateInfo, error) {
+	now := time.Now()
+	certs := make([]*CertificateInfo, 0)
+	settingService := SettingService{}
+
+	if certFile, err := settingService.GetCertFile(); err == nil && certFile != "" {
+		certs = append(certs, certificateFromFile(&CertificateInfo{Source: "panel"}, certFile, now))
+	} else if selfSigned, _ := settingService.GetWebSelfSigned(); selfSigned {
+		// only the stored certificate, the panel generates it when it starts serving it
+		if certPEM, err := settingService.getString("webSelfSignedCert"); err == nil && certPEM != "" {
+			info := &CertificateInfo{Source: "panel"}
+			info.fill([]byte(certPEM), now)
+			certs = append(certs, info)
+		}
+	}
+	if subEnable, _ := settingService.GetSubEnable(); subEnable {
+		if certFile, err := settingService.GetSubCertFile(); err == nil && certFile != "" {
+			certs = append(certs, certificateFromFile(&CertificateInfo{Source: "subscription"}, certFile, now))
+		}
+	}
+
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	for _, inbound := range inbounds {
+		stream := struct {
+			Security    string `json:"security"`
+			TLSSettings struct {
+				Certificates []struct {
+					CertificateFile string   `json:"certificateFile"`
+					Certificate     []string `json:"certificate"`
+				} `json:"certificates"`
+			} `json:"tlsSettings"`
+		}{}
+		if json.Unmarshal([]byte(inbound.StreamSettings), &stream) != nil || stream.Security != "tls" {
+			continue
+		}
+		for _, cert := range stream.TLSSettings.Certificates {
+			info := &CertificateInfo{Source: "inbound", InboundId: inbound.Id, Remark: inbound.Remark}
+			if cert.CertificateFile != "" {
+				certs = append(certs, certificateFromFile(info, cert.CertificateFile, now))
+			} else if len(cert.Certificate) > 0 {
+				info.fill([]byte(strings.Join(cert.Certificate, "\n")), now)
+				certs = append(certs, info)
+			}
+		}
+	}
+	return certs, nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"encoding/json"
+	"sort"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/random"
+
+	"github.com/xtls/xray-core/common/uuid"
+)
+
+type DuplicateClient struct {
+	InboundId  int    `json:"inboundId"`
+	InboundTag string `json:"inboundTag"`
+	Email      string `json:"email"`
+}
+
+type ClientDuplicate struct {
+	Field   string             `json:"field"`
+	Value   string             `json:"value"`
+	Clients []*DuplicateClient `json:"clients"`
+}
+
+type ClientDedupe struct {
+	InboundTag string `json:"inboundTag"`
+	Email      string `json:"email"`
+	Field      string `json:"field"`
+}
+
+// credentialField is the client field authenticating the users of an inbound
+func credentialField(protocol model.Protocol) string {
+	switch protocol {
+	case model.Trojan, model.Shadowsocks:
+		return "password"
+	case model.VMess, model.VLESS:
+		return "id"
+	}
+	return ""
+}
+
+// duplicateKey returns the key under which a client field is compared, subscription IDs
+// are only duplicates inside one inbound as sharing them across inbounds is how a
+// subscription gets the links of several inbounds.
+func duplicateKey(inbound *model.Inbound, field string, value string) string {
+	if field == "subId" {
+		return field + "\x00" + inbound.Tag + "\x00" + value
+	}
+	return field + "\x00" + value
+}
+
+func getInboundClientMaps(inbound *model.Inbound) (map[string]interface{}, []interface{}, error) {
+	var settings map[string]interface{}
+	err := json.Unmarshal([]byte(inbound.Settings), &settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	clients, _ := settings["clients"].([]interface{})
+	return settings, clients, nil
+}
+
+// GetClientDuplicates reports client IDs, passwords and emails used more than once
+// across all inbounds, and subscription IDs used more than once in an inbound.
+func (s *InboundService) GetClientDuplicates() ([]*ClientDuplicate, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Order("id asc").Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]*ClientDuplicate)
+	for _, inbound := range inbounds {
+		_, clients, err := getInboundClientMaps(inbound)
+		if err != nil {
+			return nil, err
+		}
+		fields := []string{"email", "subId"}
+		if field := credentialField(inbound.Protocol); field != "" {
+			fields = append(fields, field)
+		}
+		for _, client := range clients {
+			c, ok := client.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			email, _ := c["email"].(string)
+			for _, field := range fields {
+				value, _ := c[field].(string)
+				if value == "" {
+					continue
+				}
+				key := duplicateKey(inbound, field, value)
+				duplicate, ok := seen[key]
+				if !ok {
+					duplicate = &ClientDuplicate{Field: field, Value: value}
+					seen[key] = duplicate
+				}
+				duplicate.Clients = append(duplicate.Clients, &DuplicateClient{
+					InboundId:  inbound.Id,
+					InboundTag: inbound.Tag,
+					Email:      email,
+				})
+			}
+		}
+	}
+
+	duplicates := make([]*ClientDuplicate, 0)
+	for _, duplicate := range seen {
+		if len(duplicate.Clients) > 1 {
+			duplicates = append(duplicates, duplicate)
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].Field != duplicates[j].Field {
+			return duplicates[i].Field < duplicates[j].Field
+		}
+		return duplicates[i].Value < duplicates[j].Value
+	})
+	return duplicates, nil
+}
+
+// DedupeClients gives new IDs, passwords and subscription IDs to the clients holding a
+// duplicate one, the first client in inbound order keeps its value. Duplicate emails are
+// not changed, they key the traffic stats of the clients and have to be renamed by hand.
+func (s *InboundService) DedupeClients() (dedupes []*ClientDedupe, err error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err = db.Model(model.Inbound{}).Order("id asc").Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	seen := make(map[string]bool)
+	dedupes = make([]*ClientDedupe, 0)
+	for _, inbound := range inbounds {
+		settings, clients, err := getInboundClientMaps(inbound)
+		if err != nil {
+			return nil, err
+		}
+		method, _ := settings["method"].(string)
+		fields := []string{"subId"}
+		if field := credentialField(inbound.Protocol); field != "" {
+			fields = append(fields, field)
+		}
+		changed := false
+		for _, client := range clients {
+			c, ok := client.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			email, _ := c["email"].(string)
+			for _, field := range fields {
+				value, _ := c[field].(string)
+				if value == "" {
+					continue
+				}
+				key := duplicateKey(inbound, field, value)
+				if !seen[key] {
+					seen[key] = true
+					continue
+				}
+				switch {
+				case field == "subId":
+					value = random.Seq(16)
+				case inbound.Protocol == model.Shadowsocks:
+					value = randomShadowsocksPassword(method)
+				case inbound.Protocol == model.Trojan:
+					value = random.Seq(10)
+				default:
+					newUUID := uuid.New()
+					value = newUUID.String()
+				}
+				c[field] = value
+				seen[duplicateKey(inbound, field, value)] = true
+				dedupes = append(dedupes, &ClientDedupe{InboundTag: inbound.Tag, Email: email, Field: field})
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		newSettings, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		inbound.Settings = string(newSettings)
+		err = tx.Save(inbound).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dedupes, nil
+}
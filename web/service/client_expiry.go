@@ -0,0 +1,135 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+type ExtendExpiryResult struct {
+	Email      string `json:"email"`
+	ExpiryTime int64  `json:"expiryTime"`
+	Enabled    bool   `json:"enabled"`
+	Error      string `json:"error,omitempty"`
+}
+
+func extendedExpiry(current int64, add bool, value int64, now int64) (int64, error) {
+	if !add {
+		if value <= now {
+			return 0, common.NewError("expiry time is in the past")
+		}
+		return value, nil
+	}
+	switch {
+	case current == 0:
+		return 0, common.NewError("client never expires")
+	case current < 0:
+		// delayed start, the duration is stored negated
+		return current - value, nil
+	case current < now:
+		return now + value, nil
+	default:
+		return current + value, nil
+	}
+}
+
+// ExtendExpiry changes the expiry of the clients with emails, either adding duration milliseconds
+// to the current expiry (add) or setting it to the absolute time value. Clients disabled for
+// being expired are enabled again when they have traffic left.
+func (s *InboundService) ExtendExpiry(emails []string, add bool, value int64) (results []*ExtendExpiryResult, needRestart bool, err error) {
+	if len(emails) == 0 {
+		return nil, false, common.NewError("no clients given")
+	}
+	if value <= 0 {
+		return nil, false, common.NewError("invalid expiry value:", value)
+	}
+
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UnixMilli()
+	results = make([]*ExtendExpiryResult, 0, len(emails))
+	inbounds := map[int]*model.Inbound{}
+	inboundSettings := map[int]map[string]interface{}{}
+	for _, email := range emails {
+		result := &ExtendExpiryResult{Email: email}
+		results = append(results, result)
+
+		traffic := &xray.ClientTraffic{}
+		err = tx.Model(xray.ClientTraffic{}).Where("email = ?", email).First(traffic).Error
+		if err != nil {
+			if database.IsNotFound(err) {
+				err = nil
+				result.Error = "client not found"
+				continue
+			}
+			return nil, false, err
+		}
+
+		settings, ok := inboundSettings[traffic.InboundId]
+		if !ok {
+			inbound, err := s.GetInbound(traffic.InboundId)
+			if err != nil {
+				return nil, false, err
+			}
+			settings = map[string]interface{}{}
+			err = json.Unmarshal([]byte(inbound.Settings), &settings)
+			if err != nil {
+				return nil, false, err
+			}
+			inbounds[inbound.Id] = inbound
+			inboundSettings[inbound.Id] = settings
+		}
+
+		newExpiry, expiryErr := extendedExpiry(traffic.ExpiryTime, add, value, now)
+		if expiryErr != nil {
+			result.Error = expiryErr.Error()
+			continue
+		}
+		clients, _ := settings["clients"].([]interface{})
+		for _, client := range clients {
+			if c, ok := client.(map[string]interface{}); ok && c["email"] == email {
+				c["expiryTime"] = newExpiry
+			}
+		}
+
+		enable := traffic.Enable
+		if !enable && (traffic.Total <= 0 || traffic.Up+traffic.Down < traffic.Total) {
+			enable = true
+			needRestart = true
+		}
+		err = tx.Model(xray.ClientTraffic{}).Where("email = ?", email).Updates(map[string]interface{}{
+			"expiry_time": newExpiry,
+			"enable":      enable,
+		}).Error
+		if err != nil {
+			return nil, false, err
+		}
+		result.ExpiryTime = newExpiry
+		result.Enabled = enable
+	}
+
+	for id, inbound := range inbounds {
+		newSettings, err := json.MarshalIndent(inboundSettings[id], "", "  ")
+		if err != nil {
+			return nil, false, err
+		}
+		inbound.Settings = string(newSettings)
+		err = tx.Save(inbound).Error
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return results, needRestart, nil
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+type GroupClient struct {
+	InboundId int          `json:"inboundId"`
+	Remark    string       `json:"remark"`
+	Client    model.Client `json:"client"`
+}
+
+func sameGroup(a string, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// endTransaction commits tx when *err is nil and rolls it back otherwise. Deferred by
+// functions with a named error result, a failed commit becomes their error.
+func endTransaction(tx *gorm.DB, err *error) {
+	if *err != nil {
+		tx.Rollback()
+		return
+	}
+	*err = tx.Commit().Error
+}
+
+// GetClientsByGroup returns the clients of all inbounds whose group matches group, ignoring case.
+func (s *InboundService) GetClientsByGroup(group string) ([]*GroupClient, error) {
+	if strings.TrimSpace(group) == "" {
+		return nil, common.NewError("group is empty")
+	}
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*GroupClient, 0)
+	for _, inbound := range inbounds {
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			return nil, err
+		}
+		for _, client := range clients {
+			if sameGroup(client.Group, group) {
+				result = append(result, &GroupClient{
+					InboundId: inbound.Id,
+					Remark:    inbound.Remark,
+					Client:    client,
+				})
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *InboundService) GetGroupEmails(group string) ([]string, error) {
+	clients, err := s.GetClientsByGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]string, 0, len(clients))
+	for _, client := range clients {
+		emails = append(emails, client.Client.Email)
+	}
+	return emails, nil
+}
+
+// ResetClientsTraffic resets the traffic of the clients with emails in one transaction, skipping
+// unknown emails. Like ResetClientTraffic it enables the clients again, which takes a restart
+// when one of them was disabled, and leaves a suspended client to the end of its suspension.
+func (s *InboundService) ResetClientsTraffic(emails []string) (needRestart bool, err error) {
+	if len(emails) == 0 {
+		return false, common.NewError("no clients given")
+	}
+
+	db := database.GetDB()
+	tx := db.Begin()
+	defer endTransaction(tx, &err)
+
+	var disabled int64
+	err = tx.Model(xray.ClientTraffic{}).Where("email IN ? AND enable = ? AND suspended_until = 0", emails, false).Count(&disabled).Error
+	if err != nil {
+		return false, err
+	}
+	err = tx.Model(xray.ClientTraffic{}).Where("email IN ?", emails).
+		Updates(map[string]interface{}{
+			"up":     0,
+			"down":   0,
+			"enable": gorm.Expr("CASE WHEN suspended_until > 0 THEN enable ELSE ? END", true),
+		}).Error
+	if err != nil {
+		return false, err
+	}
+	return disabled > 0, nil
+}
+
+// SetClientsEnable enables or disables the clients with emails and returns the emails that changed.
+func (s *InboundService) SetClientsEnable(emails []string, enable bool) (changed []string, err error) {
+	if len(emails) == 0 {
+		return nil, common.NewError("no clients given")
+	}
+
+	db := database.GetDB()
+	tx := db.Begin()
+	defer endTransaction(tx, &err)
+
+	inbounds := map[int]*model.Inbound{}
+	inboundSettings := map[int]map[string]interface{}{}
+	changed = make([]string, 0, len(emails))
+	for _, email := range emails {
+		traffic := &xray.ClientTraffic{}
+		err = tx.Model(xray.ClientTraffic{}).Where("email = ?", email).First(traffic).Error
+		if err != nil {
+			if database.IsNotFound(err) {
+				err = nil
+				continue
+			}
+			return nil, err
+		}
+
+		settings, ok := inboundSettings[traffic.InboundId]
+		if !ok {
+			inbound, err := s.GetInbound(traffic.InboundId)
+			if err != nil {
+				return nil, err
+			}
+			settings = map[string]interface{}{}
+			err = json.Unmarshal([]byte(inbound.Settings), &settings)
+			if err != nil {
+				return nil, err
+			}
+			inbounds[inbound.Id] = inbound
+			inboundSettings[inbound.Id] = settings
+		}
+
+		updated := traffic.Enable != enable
+		clients, _ := settings["clients"].([]interface{})
+		for _, client := range clients {
+			if c, ok := client.(map[string]interface{}); ok && c["email"] == email {
+				if current, _ := c["enable"].(bool); current != enable {
+					c["enable"] = enable
+					updated = true
+				}
+			}
+		}
+		if !updated {
+			continue
+		}
+		// enabling or disabling by hand cancels a suspension
+		err = tx.Model(xray.ClientTraffic{}).Where("email = ?", email).
+			Updates(map[string]interface{}{"enable": enable, "suspended_until": 0}).Error
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, email)
+	}
+
+	for id, inbound := range inbounds {
+		newSettings, err := json.MarshalIndent(inboundSettings[id], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		inbound.Settings = string(newSettings)
+		err = tx.Save(inbound).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+
+	"github.com/xtls/xray-core/common/uuid"
+)
+
+type ImportClientsRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ImportClientsResult struct {
+	Imported int                     `json:"imported"`
+	Errors   []ImportClientsRowError `json:"errors"`
+}
+
+func randomShadowsocksPassword(method string) string {
+	size := 32
+	if strings.Contains(method, "aes-128") {
+		size = 16
+	}
+	key := make([]byte, size)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// ParseClientExpiry accepts an empty value, unix milliseconds or a date like 2006-01-02
+func ParseClientExpiry(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if expiry, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return expiry, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expiry: %v", value)
+	}
+	return date.UnixMilli(), nil
+}
+
+func (s *InboundService) parseClientRow(inbound *model.Inbound, method string, record []string) (map[string]interface{}, error) {
+	field := func(index int) string {
+		if index < len(record) {
+			return strings.TrimSpace(record[index])
+		}
+		return ""
+	}
+
+	email := field(0)
+	if email == "" {
+		return nil, fmt.Errorf("empty email")
+	}
+	client := map[string]interface{}{
+		"email":  email,
+		"enable": true,
+		"tgId":   "",
+		"subId":  random.Seq(16),
+		"reset":  0,
+	}
+
+	id := field(1)
+	switch inbound.Protocol {
+	case model.Trojan:
+		if id == "" {
+			id = random.Seq(10)
+		}
+		client["password"] = id
+	case model.Shadowsocks:
+		if id == "" {
+			id = randomShadowsocksPassword(method)
+		}
+		client["password"] = id
+		client["method"] = ""
+	default:
+		if id == "" {
+			newUUID := uuid.New()
+			id = newUUID.String()
+		} else if _, err := uuid.ParseString(id); err != nil {
+			return nil, fmt.Errorf("invalid uuid: %v", id)
+		}
+		client["id"] = id
+		if inbound.Protocol == model.VLESS {
+			client["flow"] = ""
+		}
+	}
+
+	var totalGB int64
+	if value := field(2); value != "" {
+		gb, err := strconv.ParseFloat(value, 64)
+		if err != nil || gb < 0 {
+			return nil, fmt.Errorf("invalid traffic limit: %v", value)
+		}
+		totalGB = int64(gb * 1024 * 1024 * 1024)
+	}
+	client["totalGB"] = totalGB
+
+	expiryTime, err := ParseClientExpiry(field(3))
+	if err != nil {
+		return nil, err
+	}
+	client["expiryTime"] = expiryTime
+
+	limitIp := 0
+	if value := field(4); value != "" {
+		limitIp, err = strconv.Atoi(value)
+		if err != nil || limitIp < 0 {
+			return nil, fmt.Errorf("invalid ip limit: %v", value)
+		}
+	}
+	client["limitIp"] = limitIp
+
+	return client, nil
+}
+
+// ImportClients bulk creates clients of an inbound from CSV rows of
+// email, uuid/password, traffic limit (GB), expiry and ip limit.
+// Invalid rows are reported and skipped, unless there are more than maxErrors of them.
+func (s *InboundService) ImportClients(inboundId int, reader io.Reader, maxErrors int) (*ImportClientsResult, bool, error) {
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return nil, false, err
+	}
+	switch inbound.Protocol {
+	case model.VMess, model.VLESS, model.Trojan, model.Shadowsocks:
+	default:
+		return nil, false, common.NewError("inbound protocol does not support clients:", inbound.Protocol)
+	}
+
+	var settings map[string]interface{}
+	err = json.Unmarshal([]byte(inbound.Settings), &settings)
+	if err != nil {
+		return nil, false, err
+	}
+	method, _ := settings["method"].(string)
+
+	allEmails, err := s.getAllEmails()
+	if err != nil {
+		return nil, false, err
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	result := &ImportClientsResult{
+		Errors: make([]ImportClientsRowError, 0),
+	}
+	clients := make([]interface{}, 0)
+	row := 0
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			result.Errors = append(result.Errors, ImportClientsRowError{Row: row, Error: err.Error()})
+			continue
+		}
+		// skip blank lines and the optional header line
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+		if row == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "email") {
+			continue
+		}
+
+		client, err := s.parseClientRow(inbound, method, record)
+		if err != nil {
+			result.Errors = append(result.Errors, ImportClientsRowError{Row: row, Error: err.Error()})
+			continue
+		}
+		email := client["email"].(string)
+		if s.contains(allEmails, email) {
+			result.Errors = append(result.Errors, ImportClientsRowError{Row: row, Error: "duplicate email: " + email})
+			continue
+		}
+		allEmails = append(allEmails, email)
+		clients = append(clients, client)
+	}
+
+	if maxErrors >= 0 && len(result.Errors) > maxErrors {
+		return result, false, common.NewErrorf("%v invalid rows, import is rolled back", len(result.Errors))
+	}
+	if len(clients) == 0 {
+		return result, false, nil
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"clients": clients,
+	})
+	if err != nil {
+		return result, false, err
+	}
+	needRestart, err := s.AddInboundClient(&model.Inbound{
+		Id:       inboundId,
+		Settings: string(data),
+	})
+	if err != nil {
+		return result, false, err
+	}
+	result.Imported = len(clients)
+	return result, needRestart, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+const maxClientPageSize = 1000
+
+// ClientPage is a page of the clients of an inbound with the traffics of those clients,
+// each client holds only the requested fields when a projection was given.
+type ClientPage struct {
+	Total       int                      `json:"total"`
+	Page        int                      `json:"page"`
+	PageSize    int                      `json:"pageSize"`
+	Clients     []map[string]interface{} `json:"clients"`
+	ClientStats []xray.ClientTraffic     `json:"clientStats"`
+}
+
+// GetClientPage returns the clients of inbound id whose email contains search, ignoring case,
+// page counting from 1. The whole list stays available through the inbound itself and the export.
+func (s *InboundService) GetClientPage(id int, page int, pageSize int, search string, fields []string) (*ClientPage, error) {
+	if page < 1 {
+		return nil, common.NewError("page is not valid:", page)
+	}
+	if pageSize < 1 || pageSize > maxClientPageSize {
+		return nil, common.NewErrorf("page size must be between 1 and %d: %d", maxClientPageSize, pageSize)
+	}
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return nil, err
+	}
+
+	search = strings.ToLower(strings.TrimSpace(search))
+	matched := make([]model.Client, 0, len(clients))
+	for _, client := range clients {
+		if search == "" || strings.Contains(strings.ToLower(client.Email), search) {
+			matched = append(matched, client)
+		}
+	}
+
+	result := &ClientPage{
+		Total:       len(matched),
+		Page:        page,
+		PageSize:    pageSize,
+		Clients:     make([]map[string]interface{}, 0),
+		ClientStats: make([]xray.ClientTraffic, 0),
+	}
+	start := (page - 1) * pageSize
+	if start >= len(matched) {
+		return result, nil
+	}
+	end := min(start+pageSize, len(matched))
+
+	emails := make([]string, 0, end-start)
+	for _, client := range matched[start:end] {
+		// a round trip through json gives the client with its json field names
+		var item map[string]interface{}
+		data, err := json.Marshal(client)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		if email, ok := item["email"].(string); ok {
+			emails = append(emails, email)
+		}
+		if len(fields) > 0 {
+			projected := make(map[string]interface{}, len(fields))
+			for _, field := range fields {
+				value, ok := item[field]
+				if !ok {
+					return nil, common.NewError("unknown client field:", field)
+				}
+				projected[field] = value
+			}
+			item = projected
+		}
+		result.Clients = append(result.Clients, item)
+	}
+
+	err = database.GetDB().Model(xray.ClientTraffic{}).
+		Where("inbound_id = ? AND email IN ?", id, emails).
+		Find(&result.ClientStats).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"x-ui/util/common"
+)
+
+// ClientPing is the latency to the last address a client connected from, Ip is empty
+// when the log has no connection of the client.
+type ClientPing struct {
+	Email     string  `json:"email"`
+	Ip        string  `json:"ip"`
+	SeenAt    string  `json:"seenAt,omitempty"`
+	Method    string  `json:"method,omitempty"`
+	Reachable bool    `json:"reachable"`
+	Latency   float64 `json:"latency"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// the port tried when icmp is not possible, a refused connection still answers from the client
+const clientPingTCPPort = "443"
+
+var pingTimeRegex = regexp.MustCompile(`time[=<]([\d.]+) ?ms`)
+
+// clientLastIp returns the source address of the last access log line of email in the panel log
+func clientLastIp(email string) (string, string, error) {
+	lines, err := (&ServerService{}).GetClientLogs(email, 1, "debug", 0)
+	if err != nil {
+		return "", "", err
+	}
+	for _, entry := range ParseLogs(lines) {
+		if entry.Source == "" {
+			continue
+		}
+		source := entry.Source
+		if network, address, ok := strings.Cut(source, ":"); ok && (network == "tcp" || network == "udp") {
+			source = address
+		}
+		host, _, err := net.SplitHostPort(source)
+		if err != nil {
+			host = source
+		}
+		if net.ParseIP(host) != nil {
+			return host, entry.Time, nil
+		}
+	}
+	return "", "", nil
+}
+
+func pingICMP(ip string, timeout time.Duration) (float64, bool, error) {
+	path, err := exec.LookPath("ping")
+	if err != nil {
+		return 0, false, err
+	}
+	seconds := strconv.Itoa(max(int(timeout.Seconds()), 1))
+	output, err := exec.Command(path, "-c", "1", "-W", seconds, ip).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// no reply within the timeout
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, common.NewError("ping:", strings.TrimSpace(string(output)))
+	}
+	matches := pingTimeRegex.FindStringSubmatch(string(output))
+	if matches == nil {
+		return 0, false, common.NewError("ping: no time in output")
+	}
+	latency, _ := strconv.ParseFloat(matches[1], 64)
+	return latency, true, nil
+}
+
+func pingTCP(ip string, timeout time.Duration) (float64, bool) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, clientPingTCPPort), timeout)
+	latency := float64(time.Since(start).Microseconds()) / 1000
+	if err == nil {
+		conn.Close()
+		return latency, true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return latency, true
+	}
+	return 0, false
+}
+
+// PingClient measures the round trip to the address the client with email last connected from,
+// over icmp when the ping command works and over a tcp handshake otherwise
+func (s *InboundService) PingClient(email string, timeout time.Duration) (*ClientPing, error) {
+	if email == "" {
+		return nil, common.NewError("email can not be empty")
+	}
+	traffic, err := s.GetClientTrafficByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if traffic == nil {
+		return nil, common.NewError("client not found:", email)
+	}
+
+	result := &ClientPing{Email: email}
+	result.Ip, result.SeenAt, err = clientLastIp(email)
+	if err != nil {
+		return nil, err
+	}
+	if result.Ip == "" {
+		result.Error = "no connection of the client in the log"
+		return result, nil
+	}
+
+	result.Method = "icmp"
+	result.Latency, result.Reachable, err = pingICMP(result.Ip, timeout)
+	if err != nil {
+		result.Method = "tcp"
+		result.Latency, result.Reachable = pingTCP(result.Ip, timeout)
+	}
+	return result, nil
+}
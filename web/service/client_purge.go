@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"x-ui/database"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+// PurgeClientsFilter selects the clients to purge, a client matching any of the enabled filters is purged
+type PurgeClientsFilter struct {
+	ExpiredBefore int64 `json:"expiredBefore" form:"expiredBefore"`
+	Depleted      bool  `json:"depleted" form:"depleted"`
+	Disabled      bool  `json:"disabled" form:"disabled"`
+	DryRun        bool  `json:"dryRun" form:"dryRun"`
+
+	// limits the purge to the trial clients
+	TrialOnly bool `json:"trialOnly" form:"trialOnly"`
+}
+
+type PurgedClient struct {
+	InboundId int    `json:"inboundId"`
+	Email     string `json:"email"`
+}
+
+type PurgeClientsResult struct {
+	Count   int            `json:"count"`
+	Clients []PurgedClient `json:"clients"`
+}
+
+func (s *InboundService) findPurgeClients(db *gorm.DB, filter *PurgeClientsFilter) ([]*xray.ClientTraffic, error) {
+	conditions := db.Where("1 = 0")
+	if filter.ExpiredBefore > 0 {
+		conditions = conditions.Or("expiry_time > 0 and expiry_time < ?", filter.ExpiredBefore)
+	}
+	if filter.Depleted {
+		// depleted like the traffic job disables them, after the grace
+		grace, err := s.settingService.GetTrafficGrace()
+		if err != nil {
+			return nil, err
+		}
+		conditions = conditions.Or(trafficExceeded, grace)
+	}
+	if filter.Disabled {
+		conditions = conditions.Or("enable = ?", false)
+	}
+	query := db.Model(xray.ClientTraffic{}).Where(conditions)
+	if filter.TrialOnly {
+		query = query.Where("trial = ?", true)
+	}
+	var traffics []*xray.ClientTraffic
+	err := query.Find(&traffics).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return traffics, nil
+}
+
+// PurgeClients deletes the clients matching filter across all inbounds.
+// In dry run mode the matching clients are only listed.
+func (s *InboundService) PurgeClients(filter *PurgeClientsFilter) (result *PurgeClientsResult, err error) {
+	if filter.ExpiredBefore <= 0 && !filter.Depleted && !filter.Disabled {
+		return nil, common.NewError("no purge filter is set")
+	}
+	if filter.ExpiredBefore > time.Now().UnixMilli() {
+		return nil, common.NewError("expiredBefore can not be in the future")
+	}
+
+	db := database.GetDB()
+	traffics, err := s.findPurgeClients(db, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &PurgeClientsResult{
+		Clients: make([]PurgedClient, 0, len(traffics)),
+	}
+	emailsByInbound := make(map[int]map[string]bool)
+	for _, traffic := range traffics {
+		result.Clients = append(result.Clients, PurgedClient{InboundId: traffic.InboundId, Email: traffic.Email})
+		if emailsByInbound[traffic.InboundId] == nil {
+			emailsByInbound[traffic.InboundId] = make(map[string]bool)
+		}
+		emailsByInbound[traffic.InboundId][traffic.Email] = true
+	}
+	result.Count = len(result.Clients)
+	if filter.DryRun || result.Count == 0 {
+		return result, nil
+	}
+
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	for inboundId, emails := range emailsByInbound {
+		inbound, err := s.GetInbound(inboundId)
+		if err != nil {
+			return nil, err
+		}
+		var settings map[string]interface{}
+		err = json.Unmarshal([]byte(inbound.Settings), &settings)
+		if err != nil {
+			return nil, err
+		}
+		oldClients, _ := settings["clients"].([]interface{})
+		newClients := make([]interface{}, 0, len(oldClients))
+		for _, client := range oldClients {
+			c, _ := client.(map[string]interface{})
+			email, _ := c["email"].(string)
+			if !emails[email] {
+				newClients = append(newClients, client)
+			}
+		}
+		settings["clients"] = newClients
+
+		newSettings, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		inbound.Settings = string(newSettings)
+		err = tx.Save(inbound).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for email := range emails {
+			err = s.DelClientStat(tx, email)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return result, nil
+}
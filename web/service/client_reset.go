@@ -0,0 +1,112 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"x-ui/database/model"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+// lastResetTime returns the start of the most recent reset day of the month not after now.
+// Days past the end of a month are clamped to its last day.
+func lastResetTime(resetDay int, now time.Time) time.Time {
+	resetIn := func(year int, month time.Month) time.Time {
+		lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, now.Location()).Day()
+		return time.Date(year, month, min(resetDay, lastDay), 0, 0, 0, 0, now.Location())
+	}
+	reset := resetIn(now.Year(), now.Month())
+	if reset.After(now) {
+		reset = resetIn(now.Year(), now.Month()-1)
+	}
+	return reset
+}
+
+// resetMonthlyClients resets the traffic of clients with a reset day once their reset day
+// of the month is reached, and enables the ones disabled for running out of traffic.
+func (s *InboundService) resetMonthlyClients(tx *gorm.DB) (bool, int64, error) {
+	var traffics []*xray.ClientTraffic
+	err := tx.Model(xray.ClientTraffic{}).Where("reset_day > 0").Find(&traffics).Error
+	if err != nil {
+		return false, 0, err
+	}
+
+	now := time.Now()
+	needRestart := false
+	var resetTraffics []*xray.ClientTraffic
+	for _, traffic := range traffics {
+		if traffic.LastReset == 0 {
+			// the reset day was just set, the cycle starts now
+			err = tx.Model(traffic).Update("last_reset", now.UnixMilli()).Error
+			if err != nil {
+				return false, 0, err
+			}
+			continue
+		}
+		if traffic.LastReset >= lastResetTime(traffic.ResetDay, now).UnixMilli() {
+			continue
+		}
+		traffic.Up = 0
+		traffic.Down = 0
+		traffic.LastReset = now.UnixMilli()
+		if !traffic.Enable && (traffic.ExpiryTime <= 0 || traffic.ExpiryTime > now.UnixMilli()) {
+			traffic.Enable = true
+			needRestart = true
+		}
+		resetTraffics = append(resetTraffics, traffic)
+	}
+	if len(resetTraffics) == 0 {
+		return false, 0, nil
+	}
+	err = tx.Save(resetTraffics).Error
+	if err != nil {
+		return false, 0, err
+	}
+	s.notifyMonthlyReset(tx, resetTraffics)
+	return needRestart, int64(len(resetTraffics)), nil
+}
+
+// notifyMonthlyReset tells the clients with a linked telegram chat that their traffic was reset
+func (s *InboundService) notifyMonthlyReset(tx *gorm.DB, traffics []*xray.ClientTraffic) {
+	tgbot := Tgbot{}
+	if !tgbot.IsRunning() {
+		return
+	}
+	inboundIds := make([]int, 0, len(traffics))
+	resetEmails := make(map[string]*xray.ClientTraffic, len(traffics))
+	for _, traffic := range traffics {
+		inboundIds = append(inboundIds, traffic.InboundId)
+		resetEmails[traffic.Email] = traffic
+	}
+	var inbounds []*model.Inbound
+	err := tx.Model(model.Inbound{}).Where("id IN ?", inboundIds).Find(&inbounds).Error
+	if err != nil {
+		logger.Warning("monthly reset notification failed:", err)
+		return
+	}
+	for _, inbound := range inbounds {
+		settings := map[string][]model.Client{}
+		json.Unmarshal([]byte(inbound.Settings), &settings)
+		for _, client := range settings["clients"] {
+			traffic, ok := resetEmails[client.Email]
+			if !ok || client.TgID == "" {
+				continue
+			}
+			tgId, err := strconv.ParseInt(client.TgID, 10, 64)
+			if err != nil {
+				continue
+			}
+			total := tgbot.I18nBot("tgbot.unlimited")
+			if traffic.Total > 0 {
+				total = common.FormatTraffic(traffic.Total)
+			}
+			msg := tgbot.I18nBot("tgbot.messages.trafficReset", "Email=="+client.Email, "Total=="+total)
+			go tgbot.SendMsgToTgbot(tgId, msg)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+)
+
+// ClientStatus is the usage of all clients sharing a subscription ID, Total and
+// Remaining are 0 and DaysLeft is -1 when unlimited.
+type ClientStatus struct {
+	Enable     bool  `json:"enable"`
+	Up         int64 `json:"up"`
+	Down       int64 `json:"down"`
+	Total      int64 `json:"total"`
+	Remaining  int64 `json:"remaining"`
+	ExpiryTime int64 `json:"expiryTime"`
+	DaysLeft   int   `json:"daysLeft"`
+}
+
+// GetClientStatus returns nil if no client has the subscription ID subId
+func (s *InboundService) GetClientStatus(subId string) (*ClientStatus, error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	err := db.Model(model.Inbound{}).Preload("ClientStats").Where(`id in (
+		SELECT DISTINCT inbounds.id
+		FROM inbounds,
+			JSON_EACH(JSON_EXTRACT(inbounds.settings, '$.clients')) AS client
+		WHERE JSON_EXTRACT(client.value, '$.subId') = ?
+	)`, subId).Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var status *ClientStatus
+	for _, inbound := range inbounds {
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			return nil, err
+		}
+		for _, client := range clients {
+			if client.SubID != subId {
+				continue
+			}
+			for _, traffic := range inbound.ClientStats {
+				if traffic.Email != client.Email {
+					continue
+				}
+				enable := inbound.Enable && client.Enable && traffic.Enable
+				if status == nil {
+					status = &ClientStatus{
+						Enable:     enable,
+						Up:         traffic.Up,
+						Down:       traffic.Down,
+						Total:      traffic.Total,
+						ExpiryTime: traffic.ExpiryTime,
+					}
+					continue
+				}
+				// same rules as the subscription-userinfo header
+				status.Enable = status.Enable || enable
+				status.Up += traffic.Up
+				status.Down += traffic.Down
+				if status.Total == 0 || traffic.Total == 0 {
+					status.Total = 0
+				} else {
+					status.Total += traffic.Total
+				}
+				if status.ExpiryTime != traffic.ExpiryTime {
+					status.ExpiryTime = 0
+				}
+			}
+		}
+	}
+	if status == nil {
+		return nil, nil
+	}
+
+	if status.Total > 0 {
+		status.Remaining = max(status.Total-status.Up-status.Down, 0)
+	}
+	switch {
+	case status.ExpiryTime > 0:
+		status.DaysLeft = max(int(time.Until(time.UnixMilli(status.ExpiryTime)).Hours()/24), 0)
+	case status.ExpiryTime < 0:
+		// the expiry starts counting on first use
+		status.DaysLeft = int(-status.ExpiryTime / 86400000)
+	default:
+		status.DaysLeft = -1
+	}
+	return status, nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/json"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/random"
+)
+
+type SubIdRotation struct {
+	OldSubId string   `json:"oldSubId"`
+	NewSubId string   `json:"newSubId"`
+	Emails   []string `json:"emails"`
+}
+
+// RotateSubIds gives new subscription IDs to the clients of inboundId (all inbounds if inboundId <= 0),
+// optionally only to the clients in emails. Clients sharing a subscription ID keep sharing the new one.
+// All existing subscription links of the rotated clients stop working.
+func (s *InboundService) RotateSubIds(inboundId int, emails []string) (rotations []*SubIdRotation, err error) {
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	query := db.Model(model.Inbound{})
+	if inboundId > 0 {
+		query = query.Where("id = ?", inboundId)
+	}
+	err = query.Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	emailFilter := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		emailFilter[email] = true
+	}
+
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	rotationBySubId := make(map[string]*SubIdRotation)
+	rotations = make([]*SubIdRotation, 0)
+	for _, inbound := range inbounds {
+		var settings map[string]interface{}
+		err = json.Unmarshal([]byte(inbound.Settings), &settings)
+		if err != nil {
+			return nil, err
+		}
+		clients, ok := settings["clients"].([]interface{})
+		if !ok {
+			continue
+		}
+		changed := false
+		for _, client := range clients {
+			c, ok := client.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			subId, _ := c["subId"].(string)
+			email, _ := c["email"].(string)
+			if subId == "" || (len(emailFilter) > 0 && !emailFilter[email]) {
+				continue
+			}
+			rotation, ok := rotationBySubId[subId]
+			if !ok {
+				rotation = &SubIdRotation{
+					OldSubId: subId,
+					NewSubId: random.Seq(16),
+				}
+				rotationBySubId[subId] = rotation
+				rotations = append(rotations, rotation)
+			}
+			rotation.Emails = append(rotation.Emails, email)
+			c["subId"] = rotation.NewSubId
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+
+		newSettings, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		inbound.Settings = string(newSettings)
+		err = tx.Save(inbound).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rotations, nil
+}
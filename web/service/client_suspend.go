@@ -0,0 +1,66 @@
+package service
+
+import (
+	"time"
+
+	"x-ui/database"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+const maxSuspendDuration = 30 * 24 * time.Hour
+
+// SuspendClient disables the client with email for duration and returns the unix milliseconds
+// at which the suspension job enables it again. Enabling, disabling or editing the client by
+// hand in the meantime cancels the restore. A suspended client can be suspended again to
+// change the restore time.
+func (s *InboundService) SuspendClient(email string, duration time.Duration) (int64, error) {
+	if duration < time.Minute || duration > maxSuspendDuration {
+		return 0, common.NewErrorf("suspend duration must be between 1 minute and %v: %v", maxSuspendDuration, duration)
+	}
+	traffic, err := s.GetClientTrafficByEmail(email)
+	if err != nil {
+		return 0, err
+	}
+	if traffic == nil {
+		return 0, common.NewError("client not found:", email)
+	}
+	// restoring a client disabled for another reason would enable it
+	if !traffic.Enable && traffic.SuspendedUntil == 0 {
+		return 0, common.NewError("client is already disabled:", email)
+	}
+
+	if traffic.Enable {
+		_, err = s.SetClientsEnable([]string{email}, false)
+		if err != nil {
+			return 0, err
+		}
+	}
+	restoreAt := time.Now().Add(duration).UnixMilli()
+	err = database.GetDB().Model(xray.ClientTraffic{}).Where("email = ?", email).Update("suspended_until", restoreAt).Error
+	if err != nil {
+		return 0, err
+	}
+	logger.Infof("client %s suspended until %s", email, time.UnixMilli(restoreAt).Format(time.RFC3339))
+	return restoreAt, nil
+}
+
+// RestoreSuspendedClients enables the suspended clients whose suspension is over
+func (s *InboundService) RestoreSuspendedClients() ([]string, error) {
+	var emails []string
+	err := database.GetDB().Model(xray.ClientTraffic{}).
+		Where("suspended_until > 0 AND suspended_until <= ?", time.Now().UnixMilli()).
+		Pluck("email", &emails).Error
+	if err != nil || len(emails) == 0 {
+		return nil, err
+	}
+	restored, err := s.SetClientsEnable(emails, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, email := range restored {
+		logger.Info("suspension of client", email, "is over, enabled it again")
+	}
+	return restored, nil
+}
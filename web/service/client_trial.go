@@ -0,0 +1,142 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+
+	"github.com/xtls/xray-core/common/uuid"
+)
+
+// prefix of the random emails of trial clients, which are marked by their trial flag
+const trialEmailPrefix = "trial-"
+
+var (
+	trialLock sync.Mutex
+	// times of the trials created per requesting ip during the last day
+	trialRequests = map[string][]time.Time{}
+)
+
+// pruneTrialRequests forgets the trials older than a day, trialLock must be held
+func pruneTrialRequests() {
+	since := time.Now().Add(-24 * time.Hour)
+	for key, times := range trialRequests {
+		recent := times[:0]
+		for _, t := range times {
+			if t.After(since) {
+				recent = append(recent, t)
+			}
+		}
+		if len(recent) == 0 {
+			delete(trialRequests, key)
+		} else {
+			trialRequests[key] = recent
+		}
+	}
+}
+
+// checkTrialQuota fails when ip had limit trials during the last day, zero being no limit
+func checkTrialQuota(ip string, limit int) error {
+	if limit <= 0 {
+		return nil
+	}
+	trialLock.Lock()
+	defer trialLock.Unlock()
+	pruneTrialRequests()
+	if len(trialRequests[ip]) >= limit {
+		return common.NewErrorf("%s already created %d trials today", ip, limit)
+	}
+	return nil
+}
+
+// takeTrialQuota counts a trial created by ip
+func takeTrialQuota(ip string) {
+	trialLock.Lock()
+	defer trialLock.Unlock()
+	pruneTrialRequests()
+	trialRequests[ip] = append(trialRequests[ip], time.Now())
+}
+
+// CreateTrialClient adds a client with the traffic and the duration of the trial settings to
+// the inbound with inboundId. A trial is purged by the trial purge job once it expired.
+func (s *InboundService) CreateTrialClient(inboundId int, ip string) (*model.Client, bool, error) {
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return nil, false, err
+	}
+	switch inbound.Protocol {
+	case model.VMess, model.VLESS, model.Trojan, model.Shadowsocks:
+	default:
+		return nil, false, common.NewError("inbound protocol does not support clients:", inbound.Protocol)
+	}
+	traffic, err := s.settingService.GetTrialTraffic()
+	if err != nil {
+		return nil, false, err
+	}
+	duration, err := s.settingService.GetTrialDuration()
+	if err != nil {
+		return nil, false, err
+	}
+	perIp, err := s.settingService.GetTrialPerIp()
+	if err != nil {
+		return nil, false, err
+	}
+	err = checkTrialQuota(ip, perIp)
+	if err != nil {
+		return nil, false, err
+	}
+
+	client := model.Client{
+		Email:      trialEmailPrefix + random.SeqOf("abcdefghijklmnopqrstuvwxyz0123456789", 8),
+		TotalGB:    int64(traffic) * 1024 * 1024,
+		ExpiryTime: time.Now().Add(time.Duration(duration) * time.Hour).UnixMilli(),
+		Enable:     true,
+		SubID:      random.Seq(16),
+		LimitIP:    1,
+		Trial:      true,
+	}
+	switch inbound.Protocol {
+	case model.Trojan:
+		client.Password = random.Seq(10)
+	case model.Shadowsocks:
+		var settings map[string]interface{}
+		err = json.Unmarshal([]byte(inbound.Settings), &settings)
+		if err != nil {
+			return nil, false, err
+		}
+		method, _ := settings["method"].(string)
+		client.Password = randomShadowsocksPassword(method)
+	default:
+		newUUID := uuid.New()
+		client.ID = newUUID.String()
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"clients": []model.Client{client},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	needRestart, err := s.AddInboundClient(&model.Inbound{
+		Id:       inboundId,
+		Settings: string(data),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	// only a created trial counts against the quota
+	takeTrialQuota(ip)
+	return &client, needRestart, nil
+}
+
+// PurgeExpiredTrials deletes the trial clients whose expiry passed
+func (s *InboundService) PurgeExpiredTrials() (*PurgeClientsResult, error) {
+	return s.PurgeClients(&PurgeClientsFilter{
+		ExpiredBefore: time.Now().UnixMilli(),
+		TrialOnly:     true,
+	})
+}
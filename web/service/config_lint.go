@@ -0,0 +1,211 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"x-ui/xray"
+)
+
+type LintIssue struct {
+	Category string `json:"category"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+type ConfigLintResult struct {
+	CoreVersion string       `json:"coreVersion"`
+	TestOutput  string       `json:"testOutput"`
+	Errors      []*LintIssue `json:"errors"`
+	Warnings    []*LintIssue `json:"warnings"`
+}
+
+func (r *ConfigLintResult) addError(category string, path string, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, &LintIssue{Category: category, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ConfigLintResult) addWarning(category string, path string, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, &LintIssue{Category: category, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// LintConfig checks the effective xray config with the -test flag of the core and a set of
+// panel rules for settings that are removed, deprecated or insecure.
+func (s *ServerService) LintConfig() (*ConfigLintResult, error) {
+	xrayConfig, err := s.xrayService.GetXrayConfig()
+	if err != nil {
+		return nil, err
+	}
+	result := &ConfigLintResult{
+		CoreVersion: s.xrayService.GetXrayVersion(),
+		Errors:      []*LintIssue{},
+		Warnings:    []*LintIssue{},
+	}
+
+	output, err := xray.TestConfig(xrayConfig)
+	result.TestOutput = output
+	if err != nil {
+		result.addError("test", "", "xray -test failed: %v", err)
+	}
+
+	data, err := json.Marshal(xrayConfig)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	if transport, ok := config["transport"].(map[string]interface{}); ok && len(transport) > 0 {
+		result.addWarning("deprecated", "transport", "the global transport config is deprecated, set the transport per inbound/outbound")
+	}
+	inbounds, _ := config["inbounds"].([]interface{})
+	for i, inbound := range inbounds {
+		if inbound, ok := inbound.(map[string]interface{}); ok {
+			lintProxy(result, proxyPath("inbounds", i, inbound), inbound, true)
+		}
+	}
+	outbounds, _ := config["outbounds"].([]interface{})
+	for i, outbound := range outbounds {
+		if outbound, ok := outbound.(map[string]interface{}); ok {
+			lintProxy(result, proxyPath("outbounds", i, outbound), outbound, false)
+		}
+	}
+	return result, nil
+}
+
+func proxyPath(kind string, index int, proxy map[string]interface{}) string {
+	if tag, ok := proxy["tag"].(string); ok && tag != "" {
+		return fmt.Sprintf("%s[%s]", kind, tag)
+	}
+	return fmt.Sprintf("%s[%d]", kind, index)
+}
+
+func lintProxy(result *ConfigLintResult, path string, proxy map[string]interface{}, isInbound bool) {
+	protocol, _ := proxy["protocol"].(string)
+	settings, _ := proxy["settings"].(map[string]interface{})
+	stream, _ := proxy["streamSettings"].(map[string]interface{})
+
+	if isInbound && proxy["tag"] == "api" {
+		listen, _ := proxy["listen"].(string)
+		if ip := net.ParseIP(listen); ip == nil || !ip.IsLoopback() {
+			result.addWarning("insecure", path+".listen", "the api inbound listens on %q, it should only listen on 127.0.0.1", listen)
+		}
+	}
+
+	// clients of inbounds, users of outbound servers
+	var users []interface{}
+	if clients, ok := settings["clients"].([]interface{}); ok {
+		users = clients
+	}
+	for _, key := range []string{"vnext", "servers"} {
+		servers, _ := settings[key].([]interface{})
+		for _, server := range servers {
+			if server, ok := server.(map[string]interface{}); ok {
+				serverUsers, _ := server["users"].([]interface{})
+				users = append(users, serverUsers...)
+			}
+		}
+	}
+	for i, user := range users {
+		user, ok := user.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		userPath := fmt.Sprintf("%s.settings.clients[%d]", path, i)
+		if email, ok := user["email"].(string); ok && email != "" {
+			userPath = fmt.Sprintf("%s.settings.clients[%s]", path, email)
+		}
+		if flow, ok := user["flow"].(string); ok && strings.HasPrefix(flow, "xtls-rprx-") && !strings.HasPrefix(flow, "xtls-rprx-vision") {
+			result.addError("removed", userPath+".flow", "flow %q was removed from xray, use xtls-rprx-vision", flow)
+		}
+		if alterId, ok := user["alterId"].(float64); ok && alterId > 0 {
+			result.addWarning("deprecated", userPath+".alterId", "vmess alterId is ignored, only AEAD is supported")
+		}
+	}
+
+	if protocol == "shadowsocks" {
+		if method, _ := settings["method"].(string); method == "none" || method == "plain" {
+			result.addWarning("insecure", path+".settings.method", "shadowsocks method %q does not encrypt traffic", method)
+		}
+	}
+
+	if stream == nil {
+		return
+	}
+	security, _ := stream["security"].(string)
+	if security == "xtls" {
+		result.addError("removed", path+".streamSettings.security", "xtls security was removed from xray, use tls or reality with xtls-rprx-vision")
+	}
+	if _, ok := stream["xtlsSettings"]; ok {
+		result.addError("removed", path+".streamSettings.xtlsSettings", "xtlsSettings was removed from xray")
+	}
+	switch network, _ := stream["network"].(string); network {
+	case "ds", "domainsocket":
+		result.addWarning("deprecated", path+".streamSettings.network", "domainsocket is deprecated, listen on a unix socket path instead")
+	case "quic":
+		result.addWarning("deprecated", path+".streamSettings.network", "the quic transport is deprecated and removed in newer cores")
+	}
+	if sockopt, ok := stream["sockopt"].(map[string]interface{}); ok {
+		lintSockopt(result, path+".streamSettings.sockopt", sockopt)
+	}
+	if tlsSettings, ok := stream["tlsSettings"].(map[string]interface{}); ok {
+		if allowInsecure, _ := tlsSettings["allowInsecure"].(bool); allowInsecure {
+			result.addWarning("insecure", path+".streamSettings.tlsSettings.allowInsecure", "allowInsecure disables certificate verification")
+		}
+		if settings, ok := tlsSettings["settings"].(map[string]interface{}); ok {
+			if allowInsecure, _ := settings["allowInsecure"].(bool); allowInsecure {
+				result.addWarning("insecure", path+".streamSettings.tlsSettings.settings.allowInsecure", "allowInsecure is advertised to clients and disables their certificate verification")
+			}
+		}
+		if minVersion, _ := tlsSettings["minVersion"].(string); minVersion == "1.0" || minVersion == "1.1" {
+			result.addWarning("insecure", path+".streamSettings.tlsSettings.minVersion", "TLS %s is outdated, use 1.2 or newer", minVersion)
+		}
+	}
+}
+
+func readProcSys(name string) string {
+	data, err := os.ReadFile("/proc/sys/" + name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// lintSockopt warns about the sockopts which need kernel support the host does not have,
+// xray fails to start or silently ignores them otherwise.
+func lintSockopt(result *ConfigLintResult, path string, sockopt map[string]interface{}) {
+	tcpMptcp, _ := sockopt["tcpMptcp"].(bool)
+	tcpCongestion, _ := sockopt["tcpCongestion"].(string)
+	tcpFastOpen, _ := sockopt["tcpFastOpen"].(bool)
+	if runtime.GOOS != "linux" {
+		if tcpMptcp || tcpCongestion != "" {
+			result.addWarning("kernel", path, "tcpMptcp and tcpCongestion are only supported on linux")
+		}
+		return
+	}
+	// multipath tcp needs linux 5.6 or newer with net.mptcp.enabled = 1
+	if tcpMptcp && readProcSys("net/mptcp/enabled") != "1" {
+		result.addWarning("kernel", path+".tcpMptcp", "multipath tcp is not enabled in the kernel (net.mptcp.enabled)")
+	}
+	// the algorithm has to be built in or its module loaded
+	if tcpCongestion != "" {
+		available := strings.Fields(readProcSys("net/ipv4/tcp_available_congestion_control"))
+		if !slices.Contains(available, tcpCongestion) {
+			result.addWarning("kernel", path+".tcpCongestion", "congestion control %q is not available in the kernel, available: %s", tcpCongestion, strings.Join(available, ", "))
+		}
+	}
+	// the server side of tcp fast open is the bit 2 of net.ipv4.tcp_fastopen
+	if tcpFastOpen {
+		if value, err := strconv.Atoi(readProcSys("net/ipv4/tcp_fastopen")); err == nil && value&2 == 0 {
+			result.addWarning("kernel", path+".tcpFastOpen", "tcp fast open is not enabled for servers in the kernel (net.ipv4.tcp_fastopen)")
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/web/global"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ErrorJob is a cron job that returns the error of its run, so that it is shown in the job list
+type ErrorJob interface {
+	RunErr() error
+}
+
+type CronJob struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Enabled  bool   `json:"enabled"`
+	NextRun  int64  `json:"nextRun"`
+	LastRun  int64  `json:"lastRun"`
+	// duration of the last run in milliseconds
+	LastDuration int64  `json:"lastDuration"`
+	LastError    string `json:"lastError,omitempty"`
+}
+
+type cronJobEntry struct {
+	CronJob
+	id  cron.EntryID
+	job cron.Job
+}
+
+var (
+	cronJobs     []*cronJobEntry
+	cronJobsLock sync.Mutex
+	// the parser of the shared cron, which has a seconds field
+	cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+)
+
+func (e *cronJobEntry) Run() {
+	start := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+				logger.Error("cron job", e.Name, "panicked:", r)
+			}
+		}()
+		if job, ok := e.job.(ErrorJob); ok {
+			err = job.RunErr()
+			if err != nil {
+				logger.Warning("cron job", e.Name, "failed:", err)
+			}
+			return err
+		}
+		e.job.Run()
+		return nil
+	}()
+
+	cronJobsLock.Lock()
+	defer cronJobsLock.Unlock()
+	e.LastRun = start.Unix()
+	e.LastDuration = time.Since(start).Milliseconds()
+	e.LastError = ""
+	if err != nil {
+		e.LastError = err.Error()
+	}
+}
+
+// ResetCronJobs forgets the jobs of a previous cron, the panel creates a new one on restart
+func ResetCronJobs() {
+	cronJobsLock.Lock()
+	defer cronJobsLock.Unlock()
+	cronJobs = nil
+}
+
+// AddCronJob adds job to c under a name shown in the job list
+func AddCronJob(c *cron.Cron, name string, spec string, job cron.Job) (cron.EntryID, error) {
+	schedule, err := cronParser.Parse(spec)
+	if err != nil {
+		return 0, err
+	}
+	return ScheduleCronJob(c, name, spec, schedule, job), nil
+}
+
+// ScheduleCronJob adds job to c with a custom schedule, spec only describes it in the job list
+func ScheduleCronJob(c *cron.Cron, name string, spec string, schedule cron.Schedule, job cron.Job) cron.EntryID {
+	entry := &cronJobEntry{
+		CronJob: CronJob{Name: name, Schedule: spec, Enabled: true},
+		job:     job,
+	}
+	cronJobsLock.Lock()
+	defer cronJobsLock.Unlock()
+	entry.id = c.Schedule(schedule, entry)
+	cronJobs = append(cronJobs, entry)
+	return entry.id
+}
+
+// AddDisabledCronJob lists a job that is not scheduled because it is turned off in the settings
+func AddDisabledCronJob(name string, spec string) {
+	cronJobsLock.Lock()
+	defer cronJobsLock.Unlock()
+	cronJobs = append(cronJobs, &cronJobEntry{CronJob: CronJob{Name: name, Schedule: spec}})
+}
+
+// GetCronJobs returns the jobs of the shared cron, the disabled ones last. Jobs added to the
+// cron without a name are listed by their type.
+func (s *ServerService) GetCronJobs() []*CronJob {
+	c := global.GetWebServer().GetCron()
+	entries := map[cron.EntryID]cron.Entry{}
+	for _, entry := range c.Entries() {
+		entries[entry.ID] = entry
+	}
+
+	cronJobsLock.Lock()
+	defer cronJobsLock.Unlock()
+	jobs := make([]*CronJob, 0, len(cronJobs))
+	kept := cronJobs[:0]
+	for _, job := range cronJobs {
+		if !job.Enabled {
+			kept = append(kept, job)
+			continue
+		}
+		entry, ok := entries[job.id]
+		if !ok {
+			// removed from the cron
+			continue
+		}
+		delete(entries, job.id)
+		kept = append(kept, job)
+		cronJob := job.CronJob
+		if !entry.Next.IsZero() {
+			cronJob.NextRun = entry.Next.Unix()
+		}
+		jobs = append(jobs, &cronJob)
+	}
+	cronJobs = kept
+
+	for _, entry := range entries {
+		cronJob := &CronJob{
+			Name:    fmt.Sprintf("%T", entry.Job),
+			Enabled: true,
+		}
+		if !entry.Next.IsZero() {
+			cronJob.NextRun = entry.Next.Unix()
+		}
+		if !entry.Prev.IsZero() {
+			cronJob.LastRun = entry.Prev.Unix()
+		}
+		jobs = append(jobs, cronJob)
+	}
+	for _, job := range cronJobs {
+		if !job.Enabled {
+			cronJob := job.CronJob
+			jobs = append(jobs, &cronJob)
+		}
+	}
+	return jobs
+}
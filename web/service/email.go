@@ -0,0 +1,199 @@
+package service
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+const emailTimeout = 30 * time.Second
+
+type EmailService struct {
+	settingService SettingService
+}
+
+type emailConfig struct {
+	host     string
+	port     int
+	security string
+	username string
+	password string
+	from     *mail.Address
+	to       []*mail.Address
+}
+
+func (s *EmailService) IsEnabled() bool {
+	enabled, err := s.settingService.GetEmailEnable()
+	return err == nil && enabled
+}
+
+func (s *EmailService) getConfig() (*emailConfig, error) {
+	config := &emailConfig{}
+	var err error
+	if config.host, err = s.settingService.GetSmtpHost(); err != nil {
+		return nil, err
+	}
+	if config.port, err = s.settingService.GetSmtpPort(); err != nil {
+		return nil, err
+	}
+	if config.security, err = s.settingService.GetSmtpSecurity(); err != nil {
+		return nil, err
+	}
+	if config.username, err = s.settingService.GetSmtpUsername(); err != nil {
+		return nil, err
+	}
+	if config.password, err = s.settingService.GetSmtpPassword(); err != nil {
+		return nil, err
+	}
+	from, err := s.settingService.GetEmailFrom()
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.settingService.GetEmailTo()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.host == "" {
+		return nil, common.NewError("smtp host is empty")
+	}
+	if config.from, err = mail.ParseAddress(from); err != nil {
+		return nil, common.NewError("email sender is not valid:", from)
+	}
+	if config.to, err = mail.ParseAddressList(to); err != nil {
+		return nil, common.NewError("email recipients are not valid:", to)
+	}
+	return config, nil
+}
+
+func (s *EmailService) dial(config *emailConfig) (*smtp.Client, error) {
+	addr := net.JoinHostPort(config.host, strconv.Itoa(config.port))
+	tlsConfig := &tls.Config{ServerName: config.host}
+	dialer := &net.Dialer{Timeout: emailTimeout}
+
+	var conn net.Conn
+	var err error
+	switch config.security {
+	case "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	case "starttls", "none":
+		conn, err = dialer.Dial("tcp", addr)
+	default:
+		return nil, common.NewError("smtp security is not valid:", config.security)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	client, err := smtp.NewClient(conn, config.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if config.security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, common.NewError("smtp server does not support STARTTLS")
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	if config.username != "" {
+		err = client.Auth(smtp.PlainAuth("", config.username, config.password, config.host))
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// SendEmail sends an html email to the configured recipients, whether notifications are enabled or not.
+// Line breaks in body are kept.
+func (s *EmailService) SendEmail(subject string, body string) error {
+	config, err := s.getConfig()
+	if err != nil {
+		return err
+	}
+	client, err := s.dial(config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err = client.Mail(config.from.Address); err != nil {
+		return err
+	}
+	to := make([]string, len(config.to))
+	for i, address := range config.to {
+		to[i] = address.String()
+		if err = client.Rcpt(address.Address); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	message := strings.Builder{}
+	fmt.Fprintf(&message, "From: %s\r\n", config.from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "<br>\r\n"))
+	message.WriteString("\r\n")
+	if _, err = writer.Write([]byte(message.String())); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Notify emails a notification in the background when email notifications are enabled.
+// Failures are only logged, so they never break the operation that triggered the notification.
+func (s *EmailService) Notify(subject string, body string) {
+	if !s.IsEnabled() || body == "" {
+		return
+	}
+	if host, err := os.Hostname(); err == nil {
+		subject = "[" + host + "] " + subject
+	}
+	go func() {
+		err := s.SendEmail(subject, body)
+		if err != nil {
+			logger.Warning("Error sending notification email:", err)
+		}
+	}()
+}
+
+func (s *EmailService) SendTestEmail() error {
+	tgbot := Tgbot{}
+	body := tgbot.I18nBot("tgbot.messages.testEmail", "DateTime=="+time.Now().Format("2006-01-02 15:04:05"))
+	return s.SendEmail("x-ui test email", body)
+}
+
+// SendReport emails the clients and inbounds that are depleted or about to expire.
+func (s *EmailService) SendReport() {
+	tgbot := Tgbot{}
+	s.Notify("x-ui report", tgbot.getExhausted())
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+const geoDownloadTimeout = 5 * time.Minute
+
+type GeoFile struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	LastUpdate int64  `json:"lastUpdate"`
+	LastCheck  int64  `json:"lastCheck"`
+	LastError  string `json:"lastError,omitempty"`
+}
+
+var (
+	geoFileChecks     = map[string]*GeoFile{}
+	geoFileChecksLock sync.Mutex
+	geoUpdateLock     sync.Mutex
+)
+
+func geoFilePaths() map[string]string {
+	return map[string]string{
+		"geoip.dat":   xray.GetGeoipPath(),
+		"geosite.dat": xray.GetGeositePath(),
+	}
+}
+
+// GetGeoFiles returns the geo files with the time they were last replaced, which is their
+// modification time, and the result of the last update check
+func (s *ServerService) GetGeoFiles() []*GeoFile {
+	geoFileChecksLock.Lock()
+	defer geoFileChecksLock.Unlock()
+	files := make([]*GeoFile, 0, 2)
+	for _, name := range []string{"geoip.dat", "geosite.dat"} {
+		file := &GeoFile{Name: name}
+		if check, ok := geoFileChecks[name]; ok {
+			*file = *check
+		}
+		if stat, err := os.Stat(geoFilePaths()[name]); err == nil {
+			file.Size = stat.Size()
+			file.LastUpdate = stat.ModTime().Unix()
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// UpdateGeoFiles downloads the geo files from the configured source when their published
+// sha256 digest differs from the local files, verifies them against it, replaces them
+// atomically and restarts xray. It returns the names of the replaced files.
+func (s *ServerService) UpdateGeoFiles() ([]string, error) {
+	if !geoUpdateLock.TryLock() {
+		return nil, common.NewError("a geo files update is already running")
+	}
+	defer geoUpdateLock.Unlock()
+
+	settingService := SettingService{}
+	source, err := settingService.GetGeoUpdateSource()
+	if err != nil {
+		return nil, err
+	}
+	source = strings.TrimSuffix(source, "/")
+	if !strings.HasPrefix(source, "https://") {
+		return nil, common.NewError("geo files source must be an https url:", source)
+	}
+
+	updated := make([]string, 0, 2)
+	errs := make([]string, 0)
+	for name, path := range geoFilePaths() {
+		check := &GeoFile{Name: name, LastCheck: time.Now().Unix()}
+		changed, err := updateGeoFile(source+"/"+name, path)
+		if err != nil {
+			check.LastError = err.Error()
+			errs = append(errs, name+": "+err.Error())
+			logger.Warning("update", name, "failed:", err)
+		} else if changed {
+			updated = append(updated, name)
+			logger.Info(name, "updated from", source)
+		}
+		geoFileChecksLock.Lock()
+		geoFileChecks[name] = check
+		geoFileChecksLock.Unlock()
+	}
+
+	if len(updated) > 0 {
+		err = s.xrayService.RestartXray(true)
+		if err != nil {
+			errs = append(errs, "restart xray: "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		notifyGeoUpdate("tgbot.messages.geoUpdateFailed", "Error=="+strings.Join(errs, ", "))
+		return updated, common.NewError(strings.Join(errs, ", "))
+	}
+	if len(updated) > 0 {
+		notifyGeoUpdate("tgbot.messages.geoUpdated", "Files=="+strings.Join(updated, ", "))
+	}
+	return updated, nil
+}
+
+func notifyGeoUpdate(name string, params ...string) {
+	tgbot := Tgbot{}
+	msg := tgbot.I18nBot(name, params...)
+	tgbot.SendMsgToTgbotAdmins(msg)
+	emailService := EmailService{}
+	emailService.Notify("Geo files update", msg)
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func httpGet(client *http.Client, url string) (*http.Response, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, common.NewErrorf("download %s failed: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// updateGeoFile replaces path with url when the digest published at url.sha256sum differs
+// from the one of path, it reports whether the file was replaced
+func updateGeoFile(url string, path string) (bool, error) {
+	client := newHTTPClient(geoDownloadTimeout)
+	resp, err := httpGet(client, url+".sha256sum")
+	if err != nil {
+		return false, err
+	}
+	digestFile, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	// sha256sum output: "<hex digest>  <file name>"
+	fields := strings.Fields(string(digestFile))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return false, common.NewError("invalid digest file of", url)
+	}
+	digest := strings.ToLower(fields[0])
+
+	if local, err := fileSHA256(path); err == nil && local == digest {
+		return false, nil
+	}
+
+	resp, err = httpGet(client, url)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	// the temporary file is in the same folder so that the rename is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != digest {
+		return false, common.NewError("sha256 of the downloaded", filepath.Base(path), "does not match the published digest")
+	}
+	err = os.Chmod(tmp.Name(), 0o644)
+	if err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// the client sending the DoH queries, the DoH server itself is resolved by the system
+var dohClient = &http.Client{Timeout: 10 * time.Second}
+
+// dohConn carries the dns messages the go resolver writes in tcp framing over DoH requests
+type dohConn struct {
+	ctx    context.Context
+	url    string
+	query  bytes.Buffer
+	answer bytes.Buffer
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	return c.query.Write(b)
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	if c.answer.Len() == 0 {
+		err := c.exchange()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return c.answer.Read(b)
+}
+
+// exchange sends the next written query and buffers its answer with the length prefix
+func (c *dohConn) exchange() error {
+	if c.query.Len() < 2 {
+		return io.EOF
+	}
+	length := int(binary.BigEndian.Uint16(c.query.Bytes()))
+	if c.query.Len() < 2+length {
+		return common.NewError("incomplete dns query")
+	}
+	c.query.Next(2)
+	message := c.query.Next(length)
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return common.NewErrorf("dns query to %s failed: %s", c.url, resp.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return err
+	}
+	binary.Write(&c.answer, binary.BigEndian, uint16(len(answer)))
+	c.answer.Write(answer)
+	return nil
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *dohConn) SetDeadline(t time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// newResolver returns a resolver querying server, an https:// url of a DoH server or a
+// tls://host[:port] DoT server
+func newResolver(server string) (*net.Resolver, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return &dohConn{ctx: ctx, url: server}, nil
+			},
+		}, nil
+	case "tls":
+		address := u.Host
+		if u.Port() == "" {
+			address = net.JoinHostPort(u.Hostname(), "853")
+		}
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}
+		return &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "tcp", address)
+			},
+		}, nil
+	}
+	return nil, common.NewError("dns server must be an https:// or tls:// url:", server)
+}
+
+// newHTTPClient returns the client of the requests the panel makes itself, going through the
+// proxy and the dns server of the settings when they are set. A zero timeout is no timeout.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	settingService := SettingService{}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy, _ := settingService.GetPanelProxy(); proxy != "" {
+		if proxyURL, err := url.Parse(proxy); err == nil {
+			// a socks5 proxy gets the host names, so they are not resolved here
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	if server, _ := settingService.GetPanelDNS(); server != "" {
+		resolver, err := newResolver(server)
+		if err != nil {
+			logger.Warning("panel dns server is not usable, using the system resolver:", err)
+		} else {
+			dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Resolver: resolver}
+			transport.DialContext = dialer.DialContext
+		}
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
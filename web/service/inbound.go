@@ -3,6 +3,7 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -16,7 +17,8 @@ import (
 )
 
 type InboundService struct {
-	xrayApi xray.XrayAPI
+	xrayApi        xray.XrayAPI
+	settingService SettingService
 }
 
 func (s *InboundService) GetInbounds(userId int) ([]*model.Inbound, error) {
@@ -39,34 +41,206 @@ func (s *InboundService) GetAllInbounds() ([]*model.Inbound, error) {
 	return inbounds, nil
 }
 
-func (s *InboundService) checkPortExist(listen string, port int, ignoreId int) (bool, error) {
-	db := database.GetDB()
-	if listen == "" || listen == "0.0.0.0" || listen == "::" || listen == "::0" {
-		db = db.Model(model.Inbound{}).Where("port = ?", port)
-	} else {
-		db = db.Model(model.Inbound{}).
-			Where("port = ?", port).
-			Where(
-				db.Model(model.Inbound{}).Where(
-					"listen = ?", listen,
-				).Or(
-					"listen = \"\"",
-				).Or(
-					"listen = \"0.0.0.0\"",
-				).Or(
-					"listen = \"::\"",
-				).Or(
-					"listen = \"::0\""))
-	}
-	if ignoreId > 0 {
-		db = db.Where("id != ?", ignoreId)
+// checkListen validates the bind address of an inbound, empty means all interfaces
+func (s *InboundService) checkListen(inbound *model.Inbound) error {
+	inbound.Listen = strings.TrimSpace(inbound.Listen)
+	if inbound.Listen == "" {
+		return nil
 	}
-	var count int64
-	err := db.Count(&count).Error
+	// xray also accepts unix domain sockets as listen address
+	if strings.HasPrefix(inbound.Listen, "/") || strings.HasPrefix(inbound.Listen, "@") {
+		return nil
+	}
+	if net.ParseIP(inbound.Listen) == nil {
+		return common.NewError("listen is not a valid ip:", inbound.Listen)
+	}
+	return nil
+}
+
+// checkTimeouts validates the idle timeout and the tcp keepalive sockopt of an inbound
+func (s *InboundService) checkTimeouts(inbound *model.Inbound) error {
+	if inbound.ConnIdle < 0 || inbound.ConnIdle > 86400 {
+		return common.NewError("connection idle timeout must be between 0 and 86400 seconds:", inbound.ConnIdle)
+	}
+	if inbound.StreamSettings == "" {
+		return nil
+	}
+	stream := struct {
+		Sockopt struct {
+			TcpKeepAliveIdle     int `json:"tcpKeepAliveIdle"`
+			TcpKeepAliveInterval int `json:"tcpKeepAliveInterval"`
+		} `json:"sockopt"`
+	}{}
+	err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
 	if err != nil {
-		return false, err
+		return common.NewError("invalid stream settings:", err)
+	}
+	if stream.Sockopt.TcpKeepAliveIdle < 0 {
+		return common.NewError("tcp keepalive idle is not valid:", stream.Sockopt.TcpKeepAliveIdle)
+	}
+	if stream.Sockopt.TcpKeepAliveInterval < 0 {
+		return common.NewError("tcp keepalive interval is not valid:", stream.Sockopt.TcpKeepAliveInterval)
+	}
+	return nil
+}
+
+type sockoptSettings struct {
+	TcpMptcp       bool   `json:"tcpMptcp"`
+	TcpCongestion  string `json:"tcpCongestion"`
+	TcpMaxSeg      int    `json:"tcpMaxSeg"`
+	TcpWindowClamp int    `json:"tcpWindowClamp"`
+	TcpUserTimeout int    `json:"tcpUserTimeout"`
+}
+
+// checkSockopt validates the tcp tuning sockopts of an inbound
+func (s *InboundService) checkSockopt(inbound *model.Inbound) error {
+	if inbound.StreamSettings == "" {
+		return nil
+	}
+	stream := struct {
+		Sockopt *sockoptSettings `json:"sockopt"`
+	}{}
+	err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	if err != nil {
+		return common.NewError("invalid stream settings:", err)
+	}
+	sockopt := stream.Sockopt
+	if sockopt == nil {
+		return nil
+	}
+	// any algorithm of the kernel may be loaded, the config lint warns about missing ones
+	if sockopt.TcpCongestion != "" && len(strings.Fields(sockopt.TcpCongestion)) != 1 {
+		return common.NewError("tcp congestion is not valid:", sockopt.TcpCongestion)
+	}
+	// 0 leaves the kernel default, the kernel rejects a mss out of 88-65535
+	if sockopt.TcpMaxSeg != 0 && (sockopt.TcpMaxSeg < 88 || sockopt.TcpMaxSeg > 65535) {
+		return common.NewError("tcp max segment size must be between 88 and 65535:", sockopt.TcpMaxSeg)
+	}
+	if sockopt.TcpWindowClamp < 0 {
+		return common.NewError("tcp window clamp is not valid:", sockopt.TcpWindowClamp)
+	}
+	if sockopt.TcpUserTimeout < 0 {
+		return common.NewError("tcp user timeout is not valid:", sockopt.TcpUserTimeout)
+	}
+	return nil
+}
+
+type splithttpSettings struct {
+	Path                 string            `json:"path"`
+	Host                 string            `json:"host"`
+	Headers              map[string]string `json:"headers"`
+	MaxUploadSize        int               `json:"maxUploadSize"`
+	MaxConcurrentUploads int               `json:"maxConcurrentUploads"`
+}
+
+// checkSplitHTTP validates the splithttp settings of an inbound using the splithttp network
+func (s *InboundService) checkSplitHTTP(inbound *model.Inbound) error {
+	if inbound.StreamSettings == "" {
+		return nil
+	}
+	stream := struct {
+		Network   string             `json:"network"`
+		Security  string             `json:"security"`
+		SplitHTTP *splithttpSettings `json:"splithttpSettings"`
+	}{}
+	err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	if err != nil {
+		return common.NewError("invalid stream settings:", err)
+	}
+	if stream.Network != "splithttp" {
+		return nil
+	}
+	if stream.Security == "reality" {
+		return common.NewError("reality can not be used with splithttp")
+	}
+	splithttp := stream.SplitHTTP
+	if splithttp == nil {
+		return nil
+	}
+	if splithttp.Path != "" && !strings.HasPrefix(splithttp.Path, "/") {
+		return common.NewError("splithttp path must start with /:", splithttp.Path)
+	}
+	if strings.ContainsAny(splithttp.Host, " /") {
+		return common.NewError("splithttp host is not valid:", splithttp.Host)
+	}
+	for name := range splithttp.Headers {
+		// xray takes the host from the host field, a host header is ignored
+		if strings.EqualFold(name, "host") && splithttp.Host != "" {
+			return common.NewError("splithttp host is set twice, remove the host header")
+		}
+	}
+	// 0 leaves the xray defaults of 1 MB and 10 uploads
+	if splithttp.MaxUploadSize < 0 {
+		return common.NewError("splithttp max upload size is not valid:", splithttp.MaxUploadSize)
+	}
+	if splithttp.MaxConcurrentUploads < 0 {
+		return common.NewError("splithttp max concurrent uploads is not valid:", splithttp.MaxConcurrentUploads)
+	}
+	return nil
+}
+
+// checkMaxClients validates the client limit of an inbound, 0 means unlimited
+func (s *InboundService) checkMaxClients(inbound *model.Inbound) error {
+	if inbound.MaxClients < 0 {
+		return common.NewError("max clients is not valid:", inbound.MaxClients)
+	}
+	if inbound.MaxClients == 0 {
+		return nil
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return err
+	}
+	if len(clients) > inbound.MaxClients {
+		return common.NewErrorf("inbound has %d clients, more than its limit of %d", len(clients), inbound.MaxClients)
+	}
+	return nil
+}
+
+type allocateSettings struct {
+	Strategy    string `json:"strategy"`
+	Refresh     int    `json:"refresh"`
+	Concurrency int    `json:"concurrency"`
+}
+
+// checkAllocate validates the port range and the port allocation strategy of an inbound
+func (s *InboundService) checkAllocate(inbound *model.Inbound) error {
+	fromPort, toPort, err := inbound.GetPortRange()
+	if err != nil {
+		return err
+	}
+	if fromPort <= 0 || toPort > 65535 || fromPort > toPort {
+		return common.NewError("invalid port range:", inbound.PortRange)
+	}
+	if inbound.PortRange != "" && (inbound.Port < fromPort || inbound.Port > toPort) {
+		return common.NewErrorf("port %v is out of port range %v", inbound.Port, inbound.PortRange)
+	}
+	if inbound.Allocate == "" {
+		return nil
+	}
+
+	allocate := &allocateSettings{}
+	err = json.Unmarshal([]byte(inbound.Allocate), allocate)
+	if err != nil {
+		return common.NewError("invalid allocate settings:", err)
+	}
+	switch allocate.Strategy {
+	case "", "always":
+	case "random":
+		if inbound.PortRange == "" {
+			return common.NewError("random allocate strategy requires a port range")
+		}
+		if allocate.Refresh < 2 {
+			return common.NewError("allocate refresh must be at least 2 minutes:", allocate.Refresh)
+		}
+		portCount := toPort - fromPort + 1
+		if allocate.Concurrency < 1 || allocate.Concurrency > portCount/3 {
+			return common.NewErrorf("allocate concurrency must be between 1 and %v", portCount/3)
+		}
+	default:
+		return common.NewError("unknown allocate strategy:", allocate.Strategy)
 	}
-	return count > 0, nil
+	return nil
 }
 
 func (s *InboundService) GetClients(inbound *model.Inbound) ([]model.Client, error) {
@@ -83,6 +257,74 @@ func (s *InboundService) GetClients(inbound *model.Inbound) ([]model.Client, err
 	return clients, nil
 }
 
+func (s *InboundService) getOutboundTags() ([]string, error) {
+	templateConfig, err := s.settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	xrayConfig := &xray.Config{}
+	err = json.Unmarshal([]byte(templateConfig), xrayConfig)
+	if err != nil {
+		return nil, err
+	}
+	var outbounds []map[string]interface{}
+	err = json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(outbounds))
+	for _, outbound := range outbounds {
+		if tag, ok := outbound["tag"].(string); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (s *InboundService) hasClientOutbound(inbound *model.Inbound) bool {
+	clients, _ := s.GetClients(inbound)
+	for _, client := range clients {
+		if client.Outbound != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkClientOutbounds makes sure the preferred outbound of each client exists in xray config
+func (s *InboundService) checkClientOutbounds(clients []model.Client) error {
+	var tags []string
+	for _, client := range clients {
+		if client.Outbound == "" {
+			continue
+		}
+		if tags == nil {
+			var err error
+			tags, err = s.getOutboundTags()
+			if err != nil {
+				return err
+			}
+		}
+		if !s.contains(tags, client.Outbound) {
+			return common.NewErrorf("outbound <%v> of client %v not found", client.Outbound, client.Email)
+		}
+	}
+	return nil
+}
+
+// checkClientSettings validates the per-client settings the panel acts on
+func (s *InboundService) checkClientSettings(clients []model.Client) error {
+	for _, client := range clients {
+		if client.ResetDay < 0 || client.ResetDay > 31 {
+			return common.NewErrorf("reset day of client %v must be between 1 and 31, or 0 to turn it off", client.Email)
+		}
+		if client.TrafficGrace < 0 || client.TrafficGrace > 100 {
+			return common.NewErrorf("traffic grace of client %v must be between 0 and 100 percent", client.Email)
+		}
+	}
+	return nil
+}
+
 func (s *InboundService) getAllEmails() ([]string, error) {
 	db := database.GetDB()
 	var emails []string
@@ -151,12 +393,51 @@ func (s *InboundService) checkEmailExistForInbound(inbound *model.Inbound) (stri
 }
 
 func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, bool, error) {
-	exist, err := s.checkPortExist(inbound.Listen, inbound.Port, 0)
+	err := s.applyInboundDefaults(inbound)
 	if err != nil {
 		return inbound, false, err
 	}
-	if exist {
-		return inbound, false, common.NewError("Port already exists:", inbound.Port)
+	inbound.Tag = defaultInboundTag(inbound.Listen, inbound.Port)
+	err = s.checkTagFree(inbound.Tag, 0)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkListen(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkTLSSettings(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkTimeouts(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkSockopt(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkSplitHTTP(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkMaxClients(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkAllocate(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkFallbacks(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+
+	err = s.checkConflicts(inbound, 0)
+	if err != nil {
+		return inbound, false, err
 	}
 
 	existEmail, err := s.checkEmailExistForInbound(inbound)
@@ -189,6 +470,15 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 		}
 	}
 
+	err = s.checkClientOutbounds(clients)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkClientSettings(clients)
+	if err != nil {
+		return inbound, false, err
+	}
+
 	db := database.GetDB()
 	tx := db.Begin()
 	defer func() {
@@ -210,10 +500,11 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 		return inbound, false, err
 	}
 
-	needRestart := false
+	// the policy level of an idle timeout only comes with a restart
+	needRestart := inbound.ConnIdle > 0
 	if inbound.Enable {
 		s.xrayApi.Init(p.GetAPIPort())
-		inboundJson, err1 := json.MarshalIndent(inbound.GenXrayInboundConfig(), "", "  ")
+		inboundJson, err1 := json.MarshalIndent(s.genBoundInboundConfig(inbound), "", "  ")
 		if err1 != nil {
 			logger.Debug("Unable to marshal inbound config:", err1)
 		}
@@ -271,12 +562,55 @@ func (s *InboundService) GetInbound(id int) (*model.Inbound, error) {
 }
 
 func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound, bool, error) {
-	exist, err := s.checkPortExist(inbound.Listen, inbound.Port, inbound.Id)
+	err := s.checkListen(inbound)
 	if err != nil {
 		return inbound, false, err
 	}
-	if exist {
-		return inbound, false, common.NewError("Port already exists:", inbound.Port)
+	err = s.checkTLSSettings(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkTimeouts(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkSockopt(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkSplitHTTP(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkMaxClients(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkAllocate(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkFallbacks(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+
+	err = s.checkConflicts(inbound, inbound.Id)
+	if err != nil {
+		return inbound, false, err
+	}
+
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkClientOutbounds(clients)
+	if err != nil {
+		return inbound, false, err
+	}
+	err = s.checkClientSettings(clients)
+	if err != nil {
+		return inbound, false, err
 	}
 
 	oldInbound, err := s.GetInbound(inbound.Id)
@@ -285,6 +619,17 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	}
 
 	tag := oldInbound.Tag
+	// a tag set by RenameInboundTag is kept, a generated one follows the listen and port
+	customTag := tag != defaultInboundTag(oldInbound.Listen, oldInbound.Port)
+	if newTag := defaultInboundTag(inbound.Listen, inbound.Port); !customTag && newTag != tag {
+		err = s.checkTagFree(newTag, oldInbound.Id)
+		if err != nil {
+			return inbound, false, err
+		}
+	}
+	routingChanged := s.hasClientOutbound(oldInbound) || s.hasClientOutbound(inbound)
+	// the policy levels of idle timeouts only change with a restart
+	policyChanged := oldInbound.ConnIdle != inbound.ConnIdle || inbound.ConnIdle > 0
 
 	db := database.GetDB()
 	tx := db.Begin()
@@ -314,19 +659,21 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	oldInbound.Settings = inbound.Settings
 	oldInbound.StreamSettings = inbound.StreamSettings
 	oldInbound.Sniffing = inbound.Sniffing
-	if inbound.Listen == "" || inbound.Listen == "0.0.0.0" || inbound.Listen == "::" || inbound.Listen == "::0" {
-		oldInbound.Tag = fmt.Sprintf("inbound-%v", inbound.Port)
-	} else {
-		oldInbound.Tag = fmt.Sprintf("inbound-%v:%v", inbound.Listen, inbound.Port)
+	oldInbound.PortRange = inbound.PortRange
+	oldInbound.Allocate = inbound.Allocate
+	oldInbound.ConnIdle = inbound.ConnIdle
+	oldInbound.MaxClients = inbound.MaxClients
+	if !customTag {
+		oldInbound.Tag = defaultInboundTag(inbound.Listen, inbound.Port)
 	}
 
-	needRestart := false
+	needRestart := routingChanged || policyChanged
 	s.xrayApi.Init(p.GetAPIPort())
 	if s.xrayApi.DelInbound(tag) == nil {
 		logger.Debug("Old inbound deleted by api:", tag)
 	}
 	if inbound.Enable {
-		inboundJson, err2 := json.MarshalIndent(oldInbound.GenXrayInboundConfig(), "", "  ")
+		inboundJson, err2 := json.MarshalIndent(s.genBoundInboundConfig(oldInbound), "", "  ")
 		if err2 != nil {
 			logger.Debug("Unable to marshal updated inbound config:", err2)
 			needRestart = true
@@ -433,6 +780,15 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 		}
 	}
 
+	err = s.checkClientOutbounds(clients)
+	if err != nil {
+		return false, err
+	}
+	err = s.checkClientSettings(clients)
+	if err != nil {
+		return false, err
+	}
+
 	var oldSettings map[string]interface{}
 	err = json.Unmarshal([]byte(oldInbound.Settings), &oldSettings)
 	if err != nil {
@@ -440,6 +796,10 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 	}
 
 	oldClients := oldSettings["clients"].([]interface{})
+	if oldInbound.MaxClients > 0 && len(oldClients)+len(interfaceClients) > oldInbound.MaxClients {
+		return false, common.NewErrorf("client limit of the inbound reached: %d/%d, %d can not be added",
+			len(oldClients), oldInbound.MaxClients, len(interfaceClients))
+	}
 	oldClients = append(oldClients, interfaceClients...)
 
 	oldSettings["clients"] = oldClients
@@ -462,9 +822,14 @@ func (s *InboundService) AddInboundClient(data *model.Inbound) (bool, error) {
 		}
 	}()
 
-	needRestart := false
+	// users added by api get no policy level of the idle timeout
+	needRestart := oldInbound.ConnIdle > 0
 	s.xrayApi.Init(p.GetAPIPort())
 	for _, client := range clients {
+		if client.Outbound != "" {
+			// Client routing rules are only applied by restarting xray
+			needRestart = true
+		}
 		if len(client.Email) > 0 {
 			s.AddClientStat(tx, data.Id, &client)
 			if client.Enable {
@@ -586,7 +951,17 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 		return false, err
 	}
 
+	err = s.checkClientOutbounds(clients)
+	if err != nil {
+		return false, err
+	}
+	err = s.checkClientSettings(clients)
+	if err != nil {
+		return false, err
+	}
+
 	oldEmail := ""
+	oldOutbound := ""
 	newClientId := ""
 	clientIndex := -1
 	for index, oldClient := range oldClients {
@@ -603,6 +978,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 		}
 		if clientId == oldClientId {
 			oldEmail = oldClient.Email
+			oldOutbound = oldClient.Outbound
 			clientIndex = index
 			break
 		}
@@ -664,7 +1040,8 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 			return false, err
 		}
 	}
-	needRestart := false
+	// users added by api get no policy level of the idle timeout
+	needRestart := oldInbound.ConnIdle > 0
 	if len(oldEmail) > 0 {
 		s.xrayApi.Init(p.GetAPIPort())
 		err1 := s.xrayApi.RemoveUser(oldInbound.Tag, oldEmail)
@@ -698,6 +1075,9 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 		logger.Debug("Client old email not found")
 		needRestart = true
 	}
+	if clients[0].Outbound != oldOutbound {
+		needRestart = true
+	}
 	return needRestart, tx.Save(oldInbound).Error
 }
 
@@ -721,6 +1101,10 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 	if err != nil {
 		return err, false
 	}
+	err = s.addTrafficHistory(tx, inboundTraffics, clientTraffics)
+	if err != nil {
+		return err, false
+	}
 
 	needRestart0, count, err := s.autoRenewClients(tx)
 	if err != nil {
@@ -729,6 +1113,13 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 		logger.Debugf("%v clients renewed", count)
 	}
 
+	needRestartReset, count, err := s.resetMonthlyClients(tx)
+	if err != nil {
+		logger.Warning("Error in monthly reset of clients:", err)
+	} else if count > 0 {
+		logger.Debugf("%v clients reset on their reset day", count)
+	}
+
 	needRestart1, count, err := s.disableInvalidClients(tx)
 	if err != nil {
 		logger.Warning("Error in disabling invalid clients:", err)
@@ -742,7 +1133,26 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 	} else if count > 0 {
 		logger.Debugf("%v inbounds disabled", count)
 	}
-	return nil, (needRestart0 || needRestart1 || needRestart2)
+	return nil, (needRestart0 || needRestartReset || needRestart1 || needRestart2)
+}
+
+// ResetNegativeTraffics clamps traffic counters which drifted below zero back to zero
+func (s *InboundService) ResetNegativeTraffics() (int64, error) {
+	db := database.GetDB()
+	var count int64
+	for _, column := range []string{"up", "down"} {
+		result := db.Model(model.Inbound{}).Where(column+" < 0").Update(column, 0)
+		if result.Error != nil {
+			return count, result.Error
+		}
+		count += result.RowsAffected
+		result = db.Model(xray.ClientTraffic{}).Where(column+" < 0").Update(column, 0)
+		if result.Error != nil {
+			return count, result.Error
+		}
+		count += result.RowsAffected
+	}
+	return count, nil
 }
 
 func (s *InboundService) addInboundTraffic(tx *gorm.DB, traffics []*xray.Traffic) error {
@@ -923,8 +1333,13 @@ func (s *InboundService) autoRenewClients(tx *gorm.DB) (bool, int64, error) {
 					traffics[traffic_index].ExpiryTime = newExpiryTime
 					traffics[traffic_index].Down = 0
 					traffics[traffic_index].Up = 0
-					if !traffic.Enable {
+					// a suspended client is enabled again when its suspension is over
+					if !traffic.Enable && traffic.SuspendedUntil == 0 {
 						traffics[traffic_index].Enable = true
+						// users added by api get no policy level of the idle timeout
+						if inbounds[inbound_index].ConnIdle > 0 {
+							needRestart = true
+						}
 						clientsToAdd = append(clientsToAdd,
 							struct {
 								protocol string
@@ -1006,9 +1421,18 @@ func (s *InboundService) disableInvalidInbounds(tx *gorm.DB) (bool, int64, error
 	return needRestart, count, err
 }
 
+// trafficExceeded is the condition of a client used up its traffic limit and its grace,
+// it takes the global grace percent
+const trafficExceeded = `client_traffics.total > 0 AND client_traffics.up + client_traffics.down >= client_traffics.total +
+	client_traffics.total * (CASE WHEN client_traffics.traffic_grace > 0 THEN client_traffics.traffic_grace ELSE ? END) / 100`
+
 func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error) {
 	now := time.Now().Unix() * 1000
 	needRestart := false
+	grace, err := s.settingService.GetTrafficGrace()
+	if err != nil {
+		return false, 0, err
+	}
 
 	if p != nil {
 		var results []struct {
@@ -1019,7 +1443,7 @@ func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error)
 		err := tx.Table("inbounds").
 			Select("inbounds.tag, client_traffics.email").
 			Joins("JOIN client_traffics ON inbounds.id = client_traffics.inbound_id").
-			Where("((client_traffics.total > 0 AND client_traffics.up + client_traffics.down >= client_traffics.total) OR (client_traffics.expiry_time > 0 AND client_traffics.expiry_time <= ?)) AND client_traffics.enable = ?", now, true).
+			Where("(("+trafficExceeded+") OR (client_traffics.expiry_time > 0 AND client_traffics.expiry_time <= ?)) AND client_traffics.enable = ?", grace, now, true).
 			Scan(&results).Error
 		if err != nil {
 			return false, 0, err
@@ -1036,11 +1460,24 @@ func (s *InboundService) disableInvalidClients(tx *gorm.DB) (bool, int64, error)
 		}
 		s.xrayApi.Close()
 	}
+
+	// the clients running out of their grace were told at their limit, tell them again now
+	var cutoffs []xray.ClientTraffic
+	err = tx.Model(xray.ClientTraffic{}).
+		Where("("+trafficExceeded+") AND (client_traffics.traffic_grace > 0 OR ? > 0) AND enable = ?", grace, grace, true).
+		Find(&cutoffs).Error
+	if err != nil {
+		return false, 0, err
+	}
+
 	result := tx.Model(xray.ClientTraffic{}).
-		Where("((total > 0 and up + down >= total) or (expiry_time > 0 and expiry_time <= ?)) and enable = ?", now, true).
+		Where("(("+trafficExceeded+") OR (client_traffics.expiry_time > 0 AND client_traffics.expiry_time <= ?)) AND client_traffics.enable = ?", grace, now, true).
 		Update("enable", false)
-	err := result.Error
+	err = result.Error
 	count := result.RowsAffected
+	if err == nil && len(cutoffs) > 0 {
+		go s.notifyTrafficCutoffs(cutoffs)
+	}
 	return needRestart, count, err
 }
 
@@ -1066,23 +1503,39 @@ func (s *InboundService) AddClientStat(tx *gorm.DB, inboundId int, client *model
 	clientTraffic.Up = 0
 	clientTraffic.Down = 0
 	clientTraffic.Reset = client.Reset
+	clientTraffic.ResetDay = client.ResetDay
+	if client.ResetDay > 0 {
+		clientTraffic.LastReset = time.Now().UnixMilli()
+	}
+	clientTraffic.TrafficGrace = client.TrafficGrace
+	clientTraffic.Trial = client.Trial
 	result := tx.Create(&clientTraffic)
 	err := result.Error
 	return err
 }
 
 func (s *InboundService) UpdateClientStat(tx *gorm.DB, email string, client *model.Client) error {
-	result := tx.Model(xray.ClientTraffic{}).
-		Where("email = ?", email).
-		Updates(map[string]interface{}{
-			"enable":      true,
-			"email":       client.Email,
-			"total":       client.TotalGB,
-			"expiry_time": client.ExpiryTime,
-			"reset":       client.Reset,
-		})
-	err := result.Error
-	return err
+	updates := map[string]interface{}{
+		"enable":        true,
+		"email":         client.Email,
+		"total":         client.TotalGB,
+		"expiry_time":   client.ExpiryTime,
+		"reset":         client.Reset,
+		"reset_day":     client.ResetDay,
+		"traffic_grace": client.TrafficGrace,
+		// editing a suspended client cancels the suspension
+		"suspended_until": 0,
+	}
+	var resetDay int
+	err := tx.Model(xray.ClientTraffic{}).Select("reset_day").Where("email = ?", email).Scan(&resetDay).Error
+	if err != nil {
+		return err
+	}
+	if resetDay != client.ResetDay {
+		// a new reset day starts a new cycle instead of resetting at once
+		updates["last_reset"] = time.Now().UnixMilli()
+	}
+	return tx.Model(xray.ClientTraffic{}).Where("email = ?", email).Updates(updates).Error
 }
 
 func (s *InboundService) DelClientStat(tx *gorm.DB, email string) error {
@@ -1097,7 +1550,9 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 		return false, err
 	}
 
-	if !traffic.Enable {
+	// a suspended client is enabled again when its suspension is over
+	suspended := traffic.SuspendedUntil > 0
+	if !traffic.Enable && !suspended {
 		inbound, err := s.GetInbound(id)
 		if err != nil {
 			return false, err
@@ -1106,6 +1561,8 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 		if err != nil {
 			return false, err
 		}
+		// users added by api get no policy level of the idle timeout
+		needRestart = inbound.ConnIdle > 0
 		for _, client := range clients {
 			if client.Email == clientEmail {
 				s.xrayApi.Init(p.GetAPIPort())
@@ -1139,7 +1596,7 @@ func (s *InboundService) ResetClientTraffic(id int, clientEmail string) (bool, e
 
 	traffic.Up = 0
 	traffic.Down = 0
-	traffic.Enable = true
+	traffic.Enable = traffic.Enable || !suspended
 
 	db := database.GetDB()
 	err = db.Save(traffic).Error
@@ -1160,9 +1617,14 @@ func (s *InboundService) ResetAllClientTraffics(id int) error {
 		whereText += " = ?"
 	}
 
+	// a suspended client is enabled again when its suspension is over
 	result := db.Model(xray.ClientTraffic{}).
 		Where(whereText, id).
-		Updates(map[string]interface{}{"enable": true, "up": 0, "down": 0})
+		Updates(map[string]interface{}{
+			"enable": gorm.Expr("CASE WHEN suspended_until > 0 THEN enable ELSE ? END", true),
+			"up":     0,
+			"down":   0,
+		})
 
 	err := result.Error
 	return err
@@ -1179,6 +1641,74 @@ func (s *InboundService) ResetAllTraffics() error {
 	return err
 }
 
+type InboundTrafficReset struct {
+	Up          int64 `json:"up"`
+	Down        int64 `json:"down"`
+	Clients     int64 `json:"clients"`
+	ClientsUp   int64 `json:"clientsUp"`
+	ClientsDown int64 `json:"clientsDown"`
+	// clients enabled again as they were only disabled for running out of traffic
+	Enabled int64 `json:"enabled"`
+}
+
+// ResetInboundTraffic zeroes the traffic of one inbound, and of its clients when withClients
+// is set, returning the traffic before the reset
+func (s *InboundService) ResetInboundTraffic(id int, withClients bool) (reset *InboundTrafficReset, err error) {
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	inbound := &model.Inbound{}
+	err = tx.Model(model.Inbound{}).Where("id = ?", id).First(inbound).Error
+	if err != nil {
+		return nil, err
+	}
+	reset = &InboundTrafficReset{Up: inbound.Up, Down: inbound.Down}
+	err = tx.Model(model.Inbound{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"up": 0, "down": 0}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if withClients {
+		err = tx.Model(xray.ClientTraffic{}).
+			Select("count(*) as clients, coalesce(sum(up), 0) as clients_up, coalesce(sum(down), 0) as clients_down").
+			Where("inbound_id = ?", id).
+			Scan(reset).Error
+		if err != nil {
+			return nil, err
+		}
+		grace, err := s.settingService.GetTrafficGrace()
+		if err != nil {
+			return nil, err
+		}
+		// expired and suspended clients stay disabled
+		result := tx.Model(xray.ClientTraffic{}).
+			Where("inbound_id = ? and enable = ?", id, false).
+			Where(trafficExceeded, grace).
+			Where("(expiry_time <= 0 or expiry_time > ?) and suspended_until = 0", time.Now().UnixMilli()).
+			Update("enable", true)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		reset.Enabled = result.RowsAffected
+		err = tx.Model(xray.ClientTraffic{}).
+			Where("inbound_id = ?", id).
+			Updates(map[string]interface{}{"up": 0, "down": 0}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reset, nil
+}
+
 func (s *InboundService) DelDepletedClients(id int) (err error) {
 	db := database.GetDB()
 	tx := db.Begin()
@@ -1471,3 +2001,95 @@ func (s *InboundService) MigrateDB() {
 func (s *InboundService) GetOnlineClinets() []string {
 	return p.GetOnlineClients()
 }
+
+type TopClient struct {
+	Email      string `json:"email"`
+	InboundId  int    `json:"inboundId"`
+	InboundTag string `json:"inboundTag"`
+	Up         int64  `json:"up"`
+	Down       int64  `json:"down"`
+	Total      int64  `json:"total"`
+	ExpiryTime int64  `json:"expiryTime"`
+	Enable     bool   `json:"enable"`
+	// remaining quota in bytes, -1 when the client has no traffic limit
+	Remaining int64 `json:"remaining"`
+}
+
+// GetTopClients returns the clients of all inbounds with the highest usage, by is total, up or down
+func (s *InboundService) GetTopClients(by string, limit int) ([]*TopClient, error) {
+	var order string
+	switch by {
+	case "", "total":
+		order = "client_traffics.up + client_traffics.down DESC"
+	case "up":
+		order = "client_traffics.up DESC"
+	case "down":
+		order = "client_traffics.down DESC"
+	default:
+		return nil, common.NewError("invalid sort metric:", by)
+	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	db := database.GetDB()
+	var clients []*TopClient
+	err := db.Model(xray.ClientTraffic{}).
+		Select(`client_traffics.email, client_traffics.inbound_id, inbounds.tag AS inbound_tag,
+			client_traffics.up, client_traffics.down, client_traffics.total,
+			client_traffics.expiry_time, client_traffics.enable,
+			CASE WHEN client_traffics.total > 0
+				THEN MAX(client_traffics.total - client_traffics.up - client_traffics.down, 0)
+				ELSE -1 END AS remaining`).
+		Joins("LEFT JOIN inbounds ON inbounds.id = client_traffics.inbound_id").
+		Order(order).
+		Limit(limit).
+		Scan(&clients).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	return clients, nil
+}
+
+type ProtocolStat struct {
+	Protocol model.Protocol `json:"protocol"`
+	Inbounds int64          `json:"inbounds"`
+	Clients  int64          `json:"clients"`
+	Up       int64          `json:"up"`
+	Down     int64          `json:"down"`
+}
+
+// GetProtocolStats returns the inbound and client counts and the traffic of the inbounds by protocol
+func (s *InboundService) GetProtocolStats() ([]*ProtocolStat, error) {
+	db := database.GetDB()
+	stats := make([]*ProtocolStat, 0)
+	err := db.Model(model.Inbound{}).
+		Select("protocol, COUNT(*) AS inbounds, COALESCE(SUM(up), 0) AS up, COALESCE(SUM(down), 0) AS down").
+		Group("protocol").
+		Order("protocol").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var clients []struct {
+		Protocol model.Protocol
+		Clients  int64
+	}
+	err = db.Model(xray.ClientTraffic{}).
+		Select("inbounds.protocol, COUNT(*) AS clients").
+		Joins("JOIN inbounds ON inbounds.id = client_traffics.inbound_id").
+		Group("inbounds.protocol").
+		Scan(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range clients {
+		for _, stat := range stats {
+			if stat.Protocol == count.Protocol {
+				stat.Clients = count.Clients
+			}
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"net"
+
+	"x-ui/database/model"
+	"x-ui/xray"
+)
+
+// bindListen returns the listen address of an inbound under the global bind mode.
+// "ipv4" binds wildcard addresses to 0.0.0.0 and the IPv6 loopback to 127.0.0.1, "dual"
+// binds wildcard addresses to :: which accepts both IPv4 and IPv6. Other addresses, unix
+// sockets and other modes keep listen.
+func bindListen(listen string, mode string) string {
+	ip := net.ParseIP(listen)
+	if listen != "" && ip == nil {
+		return listen
+	}
+	switch mode {
+	case "ipv4":
+		if ip == nil || ip.IsUnspecified() {
+			return "0.0.0.0"
+		}
+		if ip.IsLoopback() && ip.To4() == nil {
+			return "127.0.0.1"
+		}
+	case "dual":
+		if ip == nil || ip.IsUnspecified() {
+			return "::"
+		}
+	}
+	return listen
+}
+
+// genBoundInboundConfig returns the xray config of inbound listening under the global bind
+// mode, as GetXrayConfig generates it, for adding the inbound through the api
+func (s *InboundService) genBoundInboundConfig(inbound *model.Inbound) *xray.InboundConfig {
+	inboundBind, _ := s.settingService.GetInboundBind()
+	boundInbound := *inbound
+	boundInbound.Listen = bindListen(inbound.Listen, inboundBind)
+	return boundInbound.GenXrayInboundConfig()
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// InboundConflict is a reason why an inbound can not be saved next to the others,
+// Reason is one of port, socket, panelPort, subPort and xrayPort.
+type InboundConflict struct {
+	InboundId int    `json:"inboundId,omitempty"`
+	Remark    string `json:"remark,omitempty"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+}
+
+func isWildcardListen(listen string) bool {
+	return listen == "" || listen == "0.0.0.0" || listen == "::" || listen == "::0"
+}
+
+func isSocketListen(listen string) bool {
+	return strings.HasPrefix(listen, "/") || strings.HasPrefix(listen, "@")
+}
+
+// listensOverlap reports whether two ip listen addresses can take the same port, listens
+// which are no ip addresses only overlap when they are the same
+func listensOverlap(a string, b string) bool {
+	if isSocketListen(a) || isSocketListen(b) {
+		return false
+	}
+	if isWildcardListen(a) || isWildcardListen(b) {
+		return true
+	}
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	return ipA.Equal(ipB)
+}
+
+// inboundNetworks returns the transport layer networks an inbound listens on, for the conflict messages
+func inboundNetworks(inbound *model.Inbound) string {
+	switch inbound.Protocol {
+	case "wireguard":
+		return "udp"
+	case "dokodemo-door", model.Shadowsocks:
+		settings := struct {
+			Network string `json:"network"`
+		}{}
+		json.Unmarshal([]byte(inbound.Settings), &settings)
+		if settings.Network != "" {
+			return settings.Network
+		}
+	}
+	stream := struct {
+		Network string `json:"network"`
+	}{}
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	if stream.Network == "kcp" || stream.Network == "quic" {
+		return "udp"
+	}
+	return "tcp"
+}
+
+func describeInbound(inbound *model.Inbound) string {
+	if inbound.Remark != "" {
+		return fmt.Sprintf("inbound %d (%s)", inbound.Id, inbound.Remark)
+	}
+	return fmt.Sprintf("inbound %d", inbound.Id)
+}
+
+// GetInboundConflicts checks inbound against the other inbounds, the panel and the subscription
+// server and the inbounds of the xray template. Ports can not be shared even over different
+// networks, the tag of an inbound is made of its listen address and port only.
+func (s *InboundService) GetInboundConflicts(inbound *model.Inbound, ignoreId int) ([]*InboundConflict, error) {
+	fromPort, toPort, err := inbound.GetPortRange()
+	if err != nil {
+		return nil, err
+	}
+	conflicts := make([]*InboundConflict, 0)
+	usesPort := func(listen string, port int) bool {
+		return listensOverlap(inbound.Listen, listen) && fromPort <= port && port <= toPort
+	}
+
+	var inbounds []*model.Inbound
+	db := database.GetDB().Model(model.Inbound{})
+	if ignoreId > 0 {
+		db = db.Where("id != ?", ignoreId)
+	}
+	err = db.Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range inbounds {
+		if isSocketListen(inbound.Listen) {
+			if other.Listen == inbound.Listen {
+				conflicts = append(conflicts, &InboundConflict{
+					InboundId: other.Id,
+					Remark:    other.Remark,
+					Reason:    "socket",
+					Message:   fmt.Sprintf("socket %s is used by %s", inbound.Listen, describeInbound(other)),
+				})
+			}
+			continue
+		}
+		otherFrom, otherTo, err := other.GetPortRange()
+		if err != nil {
+			otherFrom, otherTo = other.Port, other.Port
+		}
+		if listensOverlap(inbound.Listen, other.Listen) && fromPort <= otherTo && otherFrom <= toPort {
+			conflicts = append(conflicts, &InboundConflict{
+				InboundId: other.Id,
+				Remark:    other.Remark,
+				Reason:    "port",
+				Message: fmt.Sprintf("port %d is used by %s on %s, this inbound uses %s",
+					max(fromPort, otherFrom), describeInbound(other), inboundNetworks(other), inboundNetworks(inbound)),
+			})
+		}
+	}
+	if isSocketListen(inbound.Listen) {
+		return conflicts, nil
+	}
+
+	settingService := SettingService{}
+	webListen, _ := settingService.GetListen()
+	if webPort, err := settingService.GetPort(); err == nil && usesPort(webListen, webPort) {
+		conflicts = append(conflicts, &InboundConflict{
+			Reason:  "panelPort",
+			Message: fmt.Sprintf("port %d is used by the panel", webPort),
+		})
+	}
+	if subEnable, _ := settingService.GetSubEnable(); subEnable {
+		subListen, _ := settingService.GetSubListen()
+		if subPort, err := settingService.GetSubPort(); err == nil && usesPort(subListen, subPort) {
+			conflicts = append(conflicts, &InboundConflict{
+				Reason:  "subPort",
+				Message: fmt.Sprintf("port %d is used by the subscription server", subPort),
+			})
+		}
+	}
+
+	xraySettingService := XraySettingService{}
+	if config, err := xraySettingService.getTemplateConfig(); err == nil {
+		templateInbounds, _ := config["inbounds"].([]interface{})
+		for _, templateInbound := range templateInbounds {
+			templateInbound, ok := templateInbound.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			port, ok := templateInbound["port"].(float64)
+			listen, _ := templateInbound["listen"].(string)
+			if ok && usesPort(listen, int(port)) {
+				tag, _ := templateInbound["tag"].(string)
+				conflicts = append(conflicts, &InboundConflict{
+					Reason:  "xrayPort",
+					Message: fmt.Sprintf("port %d is used by the inbound %q of the xray template", int(port), tag),
+				})
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+func (s *InboundService) checkConflicts(inbound *model.Inbound, ignoreId int) error {
+	conflicts, err := s.GetInboundConflicts(inbound, ignoreId)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return common.NewError(conflicts[0].Message)
+	}
+	return nil
+}
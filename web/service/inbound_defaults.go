@@ -0,0 +1,129 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// InboundDefaults are the sniffing and stream settings a new inbound starts with. The add inbound
+// form merges the stream settings by key, so a default like sockopt is kept next to the network
+// picked in the form.
+type InboundDefaults struct {
+	Sniffing       map[string]interface{} `json:"sniffing,omitempty"`
+	StreamSettings map[string]interface{} `json:"streamSettings,omitempty"`
+}
+
+var (
+	sniffingDestOverrides = []string{"http", "tls", "quic", "fakedns"}
+	streamNetworks        = []string{"tcp", "kcp", "ws", "http", "quic", "grpc", "httpupgrade", "splithttp"}
+	streamSecurities      = []string{"none", "tls", "reality"}
+)
+
+func (d *InboundDefaults) CheckValid() error {
+	if d.Sniffing != nil {
+		if enabled, ok := d.Sniffing["enabled"]; ok {
+			if _, ok := enabled.(bool); !ok {
+				return common.NewError("sniffing enabled must be true or false")
+			}
+		}
+		if destOverride, ok := d.Sniffing["destOverride"]; ok {
+			overrides, ok := destOverride.([]interface{})
+			if !ok {
+				return common.NewError("sniffing destOverride must be an array")
+			}
+			for _, override := range overrides {
+				if override, ok := override.(string); !ok || !slices.Contains(sniffingDestOverrides, override) {
+					return common.NewErrorf("unknown sniffing destOverride: %v", override)
+				}
+			}
+		}
+	}
+	if d.StreamSettings != nil {
+		if network, ok := d.StreamSettings["network"]; ok {
+			if network, ok := network.(string); !ok || !slices.Contains(streamNetworks, network) {
+				return common.NewErrorf("unknown stream network: %v", network)
+			}
+		}
+		if security, ok := d.StreamSettings["security"]; ok {
+			if security, ok := security.(string); !ok || !slices.Contains(streamSecurities, security) {
+				return common.NewErrorf("unknown stream security: %v", security)
+			}
+		}
+		if _, ok := d.StreamSettings["externalProxy"]; ok {
+			return common.NewError("external proxies depend on the inbound and can not be a default")
+		}
+	}
+	return nil
+}
+
+// GetInboundDefaults returns the stored defaults, which are empty when none are set
+func (s *SettingService) GetInboundDefaults() (*InboundDefaults, error) {
+	value, err := s.getString("inboundDefaults")
+	if err != nil {
+		return nil, err
+	}
+	defaults := &InboundDefaults{}
+	if value == "" {
+		return defaults, nil
+	}
+	err = json.Unmarshal([]byte(value), defaults)
+	if err != nil {
+		return nil, common.NewError("invalid inbound defaults:", err)
+	}
+	return defaults, nil
+}
+
+// SaveInboundDefaults stores defaults, an empty value removes them
+func (s *SettingService) SaveInboundDefaults(value string) error {
+	if value == "" {
+		return s.saveSetting("inboundDefaults", "")
+	}
+	defaults := &InboundDefaults{}
+	err := json.Unmarshal([]byte(value), defaults)
+	if err != nil {
+		return common.NewError("inbound defaults are not a valid json object:", err)
+	}
+	err = defaults.CheckValid()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(defaults, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.saveSetting("inboundDefaults", string(data))
+}
+
+// applyInboundDefaults fills the sniffing and stream settings a new inbound leaves empty from
+// the inbound defaults, settings given with the inbound are kept as they are
+func (s *InboundService) applyInboundDefaults(inbound *model.Inbound) error {
+	settingService := SettingService{}
+	defaults, err := settingService.GetInboundDefaults()
+	if err != nil {
+		return err
+	}
+	if inbound.Sniffing == "" && defaults.Sniffing != nil {
+		sniffing, err := json.MarshalIndent(defaults.Sniffing, "", "  ")
+		if err != nil {
+			return err
+		}
+		inbound.Sniffing = string(sniffing)
+	}
+	if inbound.StreamSettings != "" || defaults.StreamSettings == nil {
+		return nil
+	}
+	switch inbound.Protocol {
+	case model.VMess, model.VLESS, model.Trojan, model.Shadowsocks:
+	default:
+		return nil
+	}
+	streamSettings, err := json.MarshalIndent(defaults.StreamSettings, "", "  ")
+	if err != nil {
+		return err
+	}
+	inbound.StreamSettings = string(streamSettings)
+	return nil
+}
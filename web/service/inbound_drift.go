@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"time"
+
+	"x-ui/xray"
+)
+
+// InboundDrift is an inbound whose state in xray differs from the config of the panel
+type InboundDrift struct {
+	Tag    string `json:"tag"`
+	Remark string `json:"remark,omitempty"`
+	// Expected is whether the config of the panel has the inbound, Running whether xray runs it
+	Expected bool `json:"expected"`
+	Running  bool `json:"running"`
+	// Changed is set when xray was started or reloaded with another listen, port, protocol,
+	// stream, sniffing or allocate of the inbound
+	Changed bool `json:"changed"`
+}
+
+type InboundDriftReport struct {
+	Checked int             `json:"checked"`
+	Drifts  []*InboundDrift `json:"drifts"`
+}
+
+// inboundChanged compares the inbound level fields of two configs. The settings are left out,
+// the clients in them are added and removed through the api without updating the config of
+// the running process.
+func inboundChanged(want *xray.InboundConfig, have *xray.InboundConfig) bool {
+	return !bytes.Equal(want.Listen, have.Listen) ||
+		!bytes.Equal(want.Port, have.Port) ||
+		want.Protocol != have.Protocol ||
+		!bytes.Equal(want.StreamSettings, have.StreamSettings) ||
+		!bytes.Equal(want.Sniffing, have.Sniffing) ||
+		!bytes.Equal(want.Allocate, have.Allocate)
+}
+
+// GetInboundDrift compares the inbounds of the config built from the database with the ones
+// xray runs. Inbounds are looked up by the tags of the database, of the built config and of
+// the config xray was started with, an inbound added to xray by other means is not found.
+func (s *XrayService) GetInboundDrift() (*InboundDriftReport, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if p == nil || !p.IsRunning() || p.GetAPIPort() == 0 {
+		return nil, errors.New("xray is not running")
+	}
+	xrayConfig, err := s.GetXrayConfig()
+	if err != nil {
+		return nil, err
+	}
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]*xray.InboundConfig, len(xrayConfig.InboundConfigs))
+	for i := range xrayConfig.InboundConfigs {
+		expected[xrayConfig.InboundConfigs[i].Tag] = &xrayConfig.InboundConfigs[i]
+	}
+	loaded := map[string]*xray.InboundConfig{}
+	runningConfig := p.GetConfig()
+	for i := range runningConfig.InboundConfigs {
+		loaded[runningConfig.InboundConfigs[i].Tag] = &runningConfig.InboundConfigs[i]
+	}
+	remarks := make(map[string]string, len(inbounds))
+	for _, inbound := range inbounds {
+		remarks[inbound.Tag] = inbound.Remark
+	}
+
+	seen := map[string]bool{}
+	for tag := range expected {
+		seen[tag] = true
+	}
+	for tag := range loaded {
+		seen[tag] = true
+	}
+	for _, inbound := range inbounds {
+		seen[inbound.Tag] = true
+	}
+	delete(seen, "")
+	tags := make([]string, 0, len(seen))
+	for tag := range seen {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	err = s.xrayAPI.Init(p.GetAPIPort())
+	if err != nil {
+		return nil, err
+	}
+	defer s.xrayAPI.Close()
+
+	report := &InboundDriftReport{Checked: len(tags), Drifts: make([]*InboundDrift, 0)}
+	for _, tag := range tags {
+		running, err := s.xrayAPI.HasInbound(tag)
+		if err != nil {
+			return nil, err
+		}
+		want, isExpected := expected[tag]
+		have, isLoaded := loaded[tag]
+		changed := isExpected && running && (!isLoaded || inboundChanged(want, have))
+		if isExpected == running && !changed {
+			continue
+		}
+		report.Drifts = append(report.Drifts, &InboundDrift{
+			Tag:      tag,
+			Remark:   remarks[tag],
+			Expected: isExpected,
+			Running:  running,
+			Changed:  changed,
+		})
+	}
+	return report, nil
+}
+
+// ReconcileInbounds restarts xray with the config of the panel and checks the inbounds again
+func (s *XrayService) ReconcileInbounds() (*InboundDriftReport, error) {
+	err := s.RestartXray(true)
+	if err != nil {
+		return nil, err
+	}
+	// the api of the new process takes a moment to accept connections
+	var report *InboundDriftReport
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Second)
+		report, err = s.GetInboundDrift()
+		if err == nil {
+			break
+		}
+	}
+	return report, err
+}
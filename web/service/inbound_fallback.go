@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+var fallbackALPNs = map[string]bool{
+	"":         true,
+	"h2":       true,
+	"http/1.1": true,
+}
+
+type inboundFallback struct {
+	Name string          `json:"name"`
+	ALPN string          `json:"alpn"`
+	Path string          `json:"path"`
+	Dest json.RawMessage `json:"dest"`
+	Xver int             `json:"xver"`
+}
+
+// fallbackDest returns the dest of a fallback as xray reads it, a bare port means a port on 127.0.0.1
+func fallbackDest(raw json.RawMessage) (string, error) {
+	var port int
+	if err := json.Unmarshal(raw, &port); err == nil {
+		return "127.0.0.1:" + strconv.Itoa(port), nil
+	}
+	var dest string
+	if err := json.Unmarshal(raw, &dest); err != nil {
+		return "", err
+	}
+	if _, err := strconv.Atoi(dest); err == nil {
+		return "127.0.0.1:" + dest, nil
+	}
+	return dest, nil
+}
+
+// checkFallbacks validates the fallbacks of a vless or trojan inbound the way xray does when it loads them
+func (s *InboundService) checkFallbacks(inbound *model.Inbound) error {
+	if inbound.Protocol != model.VLESS && inbound.Protocol != model.Trojan {
+		return nil
+	}
+	settings := struct {
+		Fallbacks []inboundFallback `json:"fallbacks"`
+	}{}
+	err := json.Unmarshal([]byte(inbound.Settings), &settings)
+	if err != nil {
+		return common.NewError("invalid inbound settings:", err)
+	}
+
+	routes := map[string]bool{}
+	for i, fallback := range settings.Fallbacks {
+		index := i + 1
+		if !fallbackALPNs[fallback.ALPN] {
+			return common.NewErrorf("fallback %d: alpn must be empty, h2 or http/1.1: %s", index, fallback.ALPN)
+		}
+		if fallback.Path != "" && !strings.HasPrefix(fallback.Path, "/") {
+			return common.NewErrorf("fallback %d: path must be empty or start with /: %s", index, fallback.Path)
+		}
+		if fallback.Xver < 0 || fallback.Xver > 2 {
+			return common.NewErrorf("fallback %d: xver must be 0, 1 or 2: %d", index, fallback.Xver)
+		}
+		// xray keeps only the last of the fallbacks matching the same sni, alpn and path
+		route := fallback.Name + "\x00" + fallback.ALPN + "\x00" + fallback.Path
+		if routes[route] {
+			return common.NewErrorf("fallback %d: another fallback has the same sni, alpn and path", index)
+		}
+		routes[route] = true
+
+		if len(fallback.Dest) == 0 {
+			return common.NewErrorf("fallback %d: dest can not be empty", index)
+		}
+		dest, err := fallbackDest(fallback.Dest)
+		if err != nil || dest == "" {
+			return common.NewErrorf("fallback %d: dest must be a port, an address or a unix socket", index)
+		}
+		if dest[0] == '/' || dest[0] == '@' {
+			continue
+		}
+		host, port, err := net.SplitHostPort(dest)
+		if err != nil {
+			return common.NewErrorf("fallback %d: invalid dest %s: %v", index, dest, err)
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return common.NewErrorf("fallback %d: invalid dest port: %s", index, port)
+		}
+		if p == inbound.Port && (host == "127.0.0.1" || host == "localhost" || host == inbound.Listen) {
+			return common.NewErrorf("fallback %d: dest %s is the inbound itself", index, dest)
+		}
+	}
+	return nil
+}
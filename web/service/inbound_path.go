@@ -0,0 +1,116 @@
+package service
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+)
+
+const (
+	randomPathMinLength = 4
+	randomPathMaxLength = 64
+	randomPathAttempts  = 10
+)
+
+var randomPathCharsets = map[string]string{
+	"lowerNum": "abcdefghijklmnopqrstuvwxyz0123456789",
+	"all":      "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+	"hex":      "0123456789abcdef",
+}
+
+// transportPathKeys returns the settings object and the key of the path of a network,
+// grpc has a service name in place of a path
+func transportPathKeys(network string) (string, string, bool) {
+	switch network {
+	case "ws":
+		return "wsSettings", "path", true
+	case "httpupgrade":
+		return "httpupgradeSettings", "path", true
+	case "splithttp":
+		return "splithttpSettings", "path", true
+	case "grpc":
+		return "grpcSettings", "serviceName", true
+	}
+	return "", "", false
+}
+
+func transportPath(streamSettings string) string {
+	var stream map[string]interface{}
+	if json.Unmarshal([]byte(streamSettings), &stream) != nil {
+		return ""
+	}
+	network, _ := stream["network"].(string)
+	settingsKey, pathKey, ok := transportPathKeys(network)
+	if !ok {
+		return ""
+	}
+	settings, _ := stream[settingsKey].(map[string]interface{})
+	path, _ := settings[pathKey].(string)
+	return path
+}
+
+// RandomizeTransportPath replaces the ws/httpupgrade/splithttp path or the grpc service name of the
+// inbound with a random one of length characters of charset, not used by another inbound on
+// the same port
+func (s *InboundService) RandomizeTransportPath(inbound *model.Inbound, length int, charset string) error {
+	if length < randomPathMinLength || length > randomPathMaxLength {
+		return common.NewErrorf("random path length must be between %d and %d", randomPathMinLength, randomPathMaxLength)
+	}
+	chars, ok := randomPathCharsets[charset]
+	if !ok {
+		return common.NewError("unknown random path charset:", charset)
+	}
+
+	var stream map[string]interface{}
+	err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	if err != nil {
+		return err
+	}
+	network, _ := stream["network"].(string)
+	settingsKey, pathKey, ok := transportPathKeys(network)
+	if !ok {
+		return common.NewError("random paths need ws, grpc, httpupgrade or splithttp, network:", network)
+	}
+
+	var streams []string
+	db := database.GetDB()
+	err = db.Model(model.Inbound{}).Where("port = ? and id != ?", inbound.Port, inbound.Id).Pluck("stream_settings", &streams).Error
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, streamSettings := range streams {
+		used[transportPath(streamSettings)] = true
+	}
+
+	path := ""
+	for i := 0; i < randomPathAttempts && (path == "" || used[path]); i++ {
+		path = random.SeqOf(chars, length)
+		if network != "grpc" {
+			path = "/" + path
+		}
+	}
+	if used[path] {
+		return common.NewError("no unused random path found, try a longer one")
+	}
+	if (&url.URL{Path: path}).EscapedPath() != path {
+		return common.NewError("random path is not url safe:", path)
+	}
+
+	settings, _ := stream[settingsKey].(map[string]interface{})
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	settings[pathKey] = path
+	stream[settingsKey] = settings
+	streamSettings, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return err
+	}
+	inbound.StreamSettings = string(streamSettings)
+	return nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// InboundTagRename is a renamed inbound tag with the template references rewritten to it
+type InboundTagRename struct {
+	InboundId int      `json:"inboundId"`
+	OldTag    string   `json:"oldTag"`
+	NewTag    string   `json:"newTag"`
+	Rules     []int    `json:"rules"`     // routing rules by their position, starting from 1
+	Balancers []string `json:"balancers"` // tags of the balancers whose selector had the tag
+}
+
+// defaultInboundTag is the tag an inbound gets from its listen address and port
+func defaultInboundTag(listen string, port int) string {
+	if listen == "" || listen == "0.0.0.0" || listen == "::" || listen == "::0" {
+		return fmt.Sprintf("inbound-%v", port)
+	}
+	return fmt.Sprintf("inbound-%v:%v", listen, port)
+}
+
+// checkTagFree returns an error when tag is used by a panel inbound other than the one of id,
+// or by an inbound of the xray template, like api
+func (s *InboundService) checkTagFree(tag string, id int) error {
+	var count int64
+	err := database.GetDB().Model(model.Inbound{}).Where("tag = ? and id != ?", tag, id).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return common.NewError("tag already in use:", tag)
+	}
+	templateConfig, err := s.settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return err
+	}
+	config := struct {
+		Inbounds []struct {
+			Tag string `json:"tag"`
+		} `json:"inbounds"`
+	}{}
+	json.Unmarshal([]byte(templateConfig), &config)
+	for _, templateInbound := range config.Inbounds {
+		if templateInbound.Tag == tag {
+			return common.NewError("tag already in use by the xray template:", tag)
+		}
+	}
+	return nil
+}
+
+// renameInList replaces oldTag by newTag in a list of tags, telling whether it was there
+func renameInList(list []interface{}, oldTag string, newTag string) bool {
+	renamed := false
+	for i, item := range list {
+		if item == oldTag {
+			list[i] = newTag
+			renamed = true
+		}
+	}
+	return renamed
+}
+
+// RenameInboundTag gives the inbound tagged oldTag the tag newTag and rewrites the routing
+// rules and balancer selectors of the xray template referencing it. The inbound and the
+// template are saved in one transaction, xray has to be restarted afterwards.
+func (s *InboundService) RenameInboundTag(oldTag string, newTag string) (rename *InboundTagRename, err error) {
+	oldTag = strings.TrimSpace(oldTag)
+	newTag = strings.TrimSpace(newTag)
+	if oldTag == "" || newTag == "" {
+		return nil, common.NewError("tag can not be empty")
+	}
+	if oldTag == newTag {
+		return nil, common.NewError("new tag is the same as the old one")
+	}
+
+	db := database.GetDB()
+	inbound := &model.Inbound{}
+	err = db.Model(model.Inbound{}).Where("tag = ?", oldTag).First(inbound).Error
+	if err != nil {
+		if database.IsNotFound(err) {
+			return nil, common.NewError("inbound not found:", oldTag)
+		}
+		return nil, err
+	}
+	err = s.checkTagFree(newTag, inbound.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	templateConfig, err := s.settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{}
+	err = json.Unmarshal([]byte(templateConfig), &config)
+	if err != nil {
+		return nil, common.NewError("xray template config invalid:", err)
+	}
+
+	rename = &InboundTagRename{
+		InboundId: inbound.Id,
+		OldTag:    oldTag,
+		NewTag:    newTag,
+		Rules:     make([]int, 0),
+		Balancers: make([]string, 0),
+	}
+	routing, _ := config["routing"].(map[string]interface{})
+	rules, _ := routing["rules"].([]interface{})
+	for i, rule := range rules {
+		rule, _ := rule.(map[string]interface{})
+		if inboundTags, ok := rule["inboundTag"].([]interface{}); ok && renameInList(inboundTags, oldTag, newTag) {
+			rename.Rules = append(rename.Rules, i+1)
+		}
+	}
+	balancers, _ := routing["balancers"].([]interface{})
+	for _, balancer := range balancers {
+		balancer, _ := balancer.(map[string]interface{})
+		if selector, ok := balancer["selector"].([]interface{}); ok && renameInList(selector, oldTag, newTag) {
+			tag, _ := balancer["tag"].(string)
+			rename.Balancers = append(rename.Balancers, tag)
+		}
+	}
+
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.Model(model.Inbound{}).Where("id = ?", inbound.Id).Update("tag", newTag).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rename.Rules) == 0 && len(rename.Balancers) == 0 {
+		return rename, nil
+	}
+
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	xraySettingService := XraySettingService{}
+	err = xraySettingService.CheckXrayConfig(string(newConfig))
+	if err != nil {
+		return nil, err
+	}
+	setting := &model.Setting{}
+	err = tx.Model(model.Setting{}).Where("key = ?", "xrayTemplateConfig").First(setting).Error
+	if database.IsNotFound(err) {
+		err = tx.Create(&model.Setting{Key: "xrayTemplateConfig", Value: string(newConfig)}).Error
+	} else if err == nil {
+		setting.Value = string(newConfig)
+		err = tx.Save(setting).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rename, nil
+}
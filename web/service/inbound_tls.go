@@ -0,0 +1,96 @@
+package service
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"strings"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+var tlsVersions = map[string]int{
+	"1.0": 0,
+	"1.1": 1,
+	"1.2": 2,
+	"1.3": 3,
+}
+
+var tlsALPNs = map[string]bool{
+	"h3":       true,
+	"h2":       true,
+	"http/1.1": true,
+}
+
+type inboundTLSSettings struct {
+	MinVersion   string   `json:"minVersion"`
+	MaxVersion   string   `json:"maxVersion"`
+	CipherSuites string   `json:"cipherSuites"`
+	ALPN         []string `json:"alpn"`
+}
+
+func isTLSCipherSuite(name string) bool {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return true
+		}
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		if suite.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTLSSettings validates the tls versions, cipher suites and alpn of a tls inbound against the values xray accepts
+func (s *InboundService) checkTLSSettings(inbound *model.Inbound) error {
+	if inbound.StreamSettings == "" {
+		return nil
+	}
+	stream := struct {
+		Security    string              `json:"security"`
+		TLSSettings *inboundTLSSettings `json:"tlsSettings"`
+	}{}
+	err := json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	if err != nil {
+		return common.NewError("invalid stream settings:", err)
+	}
+	if stream.Security != "tls" || stream.TLSSettings == nil {
+		return nil
+	}
+	settings := stream.TLSSettings
+
+	minVersion, maxVersion := 0, 3
+	if settings.MinVersion != "" {
+		v, ok := tlsVersions[settings.MinVersion]
+		if !ok {
+			return common.NewError("invalid tls min version:", settings.MinVersion)
+		}
+		minVersion = v
+	}
+	if settings.MaxVersion != "" {
+		v, ok := tlsVersions[settings.MaxVersion]
+		if !ok {
+			return common.NewError("invalid tls max version:", settings.MaxVersion)
+		}
+		maxVersion = v
+	}
+	if minVersion > maxVersion {
+		return common.NewErrorf("tls min version %v is higher than max version %v", settings.MinVersion, settings.MaxVersion)
+	}
+
+	if settings.CipherSuites != "" {
+		for _, suite := range strings.Split(settings.CipherSuites, ":") {
+			if !isTLSCipherSuite(suite) {
+				return common.NewError("invalid tls cipher suite:", suite)
+			}
+		}
+	}
+	for _, alpn := range settings.ALPN {
+		if !tlsALPNs[alpn] {
+			return common.NewError("invalid tls alpn:", alpn)
+		}
+	}
+	return nil
+}
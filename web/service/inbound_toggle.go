@@ -0,0 +1,67 @@
+package service
+
+import (
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+)
+
+// InboundToggleResult is the outcome for one inbound of SetInboundsEnable, Changed is false
+// when the inbound already had the requested state
+type InboundToggleResult struct {
+	Id      int    `json:"id"`
+	Remark  string `json:"remark,omitempty"`
+	Changed bool   `json:"changed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SetInboundsEnable enables or disables the inbounds with ids in one transaction. Unknown ids
+// are reported and skipped. The caller restarts xray once when any inbound changed.
+func (s *InboundService) SetInboundsEnable(ids []int, enable bool) (results []*InboundToggleResult, changed bool, err error) {
+	if len(ids) == 0 {
+		return nil, false, common.NewError("no inbounds given")
+	}
+
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	results = make([]*InboundToggleResult, 0, len(ids))
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result := &InboundToggleResult{Id: id}
+		results = append(results, result)
+
+		inbound := &model.Inbound{}
+		err = tx.Model(model.Inbound{}).Where("id = ?", id).First(inbound).Error
+		if err != nil {
+			if database.IsNotFound(err) {
+				err = nil
+				result.Error = "inbound not found"
+				continue
+			}
+			return nil, false, err
+		}
+		result.Remark = inbound.Remark
+		if inbound.Enable == enable {
+			continue
+		}
+		err = tx.Model(model.Inbound{}).Where("id = ?", id).Update("enable", enable).Error
+		if err != nil {
+			return nil, false, err
+		}
+		result.Changed = true
+		changed = true
+	}
+	return results, changed, nil
+}
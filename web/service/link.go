@@ -0,0 +1,205 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"x-ui/util/common"
+
+	"github.com/xtls/xray-core/common/uuid"
+)
+
+type LinkFieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// ParsedLink is a share link decoded into its parameters,
+// Params holds the transport and security parameters like type, security, sni or path.
+type ParsedLink struct {
+	Protocol string            `json:"protocol"`
+	Remark   string            `json:"remark"`
+	Address  string            `json:"address"`
+	Port     int               `json:"port"`
+	Id       string            `json:"id,omitempty"`
+	Password string            `json:"password,omitempty"`
+	Method   string            `json:"method,omitempty"`
+	Params   map[string]string `json:"params"`
+	Errors   []LinkFieldError  `json:"errors"`
+}
+
+func (l *ParsedLink) addError(field string, format string, a ...interface{}) {
+	l.Errors = append(l.Errors, LinkFieldError{Field: field, Error: fmt.Sprintf(format, a...)})
+}
+
+func (l *ParsedLink) checkAddress() {
+	if l.Address == "" {
+		l.addError("address", "address is empty")
+	} else if net.ParseIP(l.Address) == nil && !isValidDomain(l.Address) {
+		l.addError("address", "invalid address: %v", l.Address)
+	}
+	if l.Port <= 0 || l.Port > 65535 {
+		l.addError("port", "invalid port: %v", l.Port)
+	}
+}
+
+func (l *ParsedLink) checkId() {
+	if l.Id == "" {
+		l.addError("id", "id is empty")
+	} else if _, err := uuid.ParseString(l.Id); err != nil {
+		l.addError("id", "invalid uuid: %v", l.Id)
+	}
+}
+
+// decodeBase64 accepts standard and url encoding, with or without padding
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := encoding.DecodeString(s); err == nil {
+			return data, nil
+		}
+	}
+	return nil, common.NewError("invalid base64")
+}
+
+func parseVmessLink(link *ParsedLink, body string) error {
+	data, err := decodeBase64(body)
+	if err != nil {
+		return err
+	}
+	config := map[string]interface{}{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return common.NewError("invalid vmess json:", err)
+	}
+	for key, value := range config {
+		if value == nil {
+			continue
+		}
+		str := fmt.Sprint(value)
+		switch key {
+		case "ps":
+			link.Remark = str
+		case "add":
+			link.Address = str
+		case "port":
+			link.Port, err = strconv.Atoi(str)
+			if err != nil {
+				link.addError("port", "invalid port: %v", str)
+			}
+		case "id":
+			link.Id = str
+		case "v":
+		default:
+			link.Params[key] = str
+		}
+	}
+	link.checkAddress()
+	link.checkId()
+	return nil
+}
+
+func parseURLLink(link *ParsedLink, rawLink string) error {
+	u, err := url.Parse(rawLink)
+	if err != nil {
+		return err
+	}
+	link.Remark = u.Fragment
+	for key, values := range u.Query() {
+		link.Params[key] = values[0]
+	}
+
+	userInfo := ""
+	if u.User != nil {
+		userInfo = u.User.String()
+		userInfo, _ = url.PathUnescape(userInfo)
+	}
+	host := u.Host
+
+	if link.Protocol == "shadowsocks" && userInfo == "" {
+		// legacy format, everything is base64 encoded: ss://base64(method:password@host:port)
+		data, err := decodeBase64(u.Host)
+		if err != nil {
+			return err
+		}
+		userInfo, host, _ = strings.Cut(string(data), "@")
+	}
+
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		link.addError("address", "invalid host: %v", host)
+	} else {
+		link.Address = hostname
+		link.Port, err = strconv.Atoi(port)
+		if err != nil {
+			link.addError("port", "invalid port: %v", port)
+		}
+	}
+
+	switch link.Protocol {
+	case "vless":
+		link.Id = userInfo
+		link.checkId()
+	case "trojan":
+		link.Password = userInfo
+		if link.Password == "" {
+			link.addError("password", "password is empty")
+		}
+	case "shadowsocks":
+		if !strings.Contains(userInfo, ":") {
+			if data, err := decodeBase64(userInfo); err == nil {
+				userInfo = string(data)
+			}
+		}
+		method, password, found := strings.Cut(userInfo, ":")
+		if !found || method == "" {
+			link.addError("method", "method is missing")
+		}
+		link.Method = method
+		link.Password = password
+		if link.Password == "" {
+			link.addError("password", "password is empty")
+		}
+	}
+	link.checkAddress()
+	return nil
+}
+
+// ParseLink decodes a vmess, vless, trojan or shadowsocks share link.
+// Malformed fields are reported in the Errors of the result, an error is only returned
+// when the link can not be decoded at all.
+func (s *ServerService) ParseLink(rawLink string) (*ParsedLink, error) {
+	rawLink = strings.TrimSpace(rawLink)
+	scheme, body, found := strings.Cut(rawLink, "://")
+	if !found {
+		return nil, common.NewError("not a share link")
+	}
+
+	link := &ParsedLink{
+		Params: map[string]string{},
+		Errors: make([]LinkFieldError, 0),
+	}
+	var err error
+	switch strings.ToLower(scheme) {
+	case "vmess":
+		link.Protocol = "vmess"
+		err = parseVmessLink(link, body)
+	case "vless", "trojan":
+		link.Protocol = strings.ToLower(scheme)
+		err = parseURLLink(link, rawLink)
+	case "ss":
+		link.Protocol = "shadowsocks"
+		err = parseURLLink(link, rawLink)
+	default:
+		return nil, common.NewError("unsupported link protocol:", scheme)
+	}
+	if err != nil {
+		return nil, common.NewError("invalid", link.Protocol, "link:", err)
+	}
+	return link, nil
+}
@@ -0,0 +1,508 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+	"x-ui/xray"
+)
+
+// LinkImportResult is the inbound a share link was imported into,
+// Unmapped lists the link parameters the inbound could not take over.
+type LinkImportResult struct {
+	Inbound  *model.Inbound `json:"inbound"`
+	Created  bool           `json:"created"`
+	Email    string         `json:"email"`
+	Unmapped []string       `json:"unmapped"`
+}
+
+// link parameters which only matter to the client side of a connection
+var clientOnlyLinkParams = []string{"encryption", "allowInsecure", "v", "remark"}
+
+// link parameters of the transport and security, taken over by a new inbound
+var streamLinkParams = []string{"type", "path", "host", "headerType", "serviceName", "authority", "mode",
+	"security", "sni", "fp", "alpn", "sid", "spx", "pbk"}
+
+// normalizeVmessParams renames the keys of a vmess link to the ones of vless and trojan links
+func normalizeVmessParams(params map[string]string) map[string]string {
+	normalized := map[string]string{}
+	for key, value := range params {
+		switch key {
+		case "net":
+			normalized["type"] = value
+		case "type":
+			normalized["headerType"] = value
+		case "tls":
+			normalized["security"] = value
+		default:
+			normalized[key] = value
+		}
+	}
+	return normalized
+}
+
+// linkStreamSettings builds the stream settings of an inbound serving the clients of a link,
+// the parameters it takes over are removed from params
+func (s *InboundService) linkStreamSettings(params map[string]string, report func(string, ...interface{})) (map[string]interface{}, error) {
+	take := func(key string) string {
+		value := params[key]
+		delete(params, key)
+		return value
+	}
+
+	network := take("type")
+	if network == "" {
+		network = "tcp"
+	}
+	path := take("path")
+	host := take("host")
+	headerType := take("headerType")
+	stream := map[string]interface{}{"network": network}
+	switch network {
+	case "tcp":
+		header := map[string]interface{}{"type": "none"}
+		if headerType == "http" {
+			if path == "" {
+				path = "/"
+			}
+			headers := map[string]interface{}{}
+			if host != "" {
+				headers["Host"] = strings.Split(host, ",")
+			}
+			header = map[string]interface{}{
+				"type":     "http",
+				"request":  map[string]interface{}{"version": "1.1", "method": "GET", "path": strings.Split(path, ","), "headers": headers},
+				"response": map[string]interface{}{"version": "1.1", "status": "200", "reason": "OK", "headers": map[string]interface{}{}},
+			}
+		} else if headerType != "" && headerType != "none" {
+			return nil, common.NewError("unsupported tcp header type:", headerType)
+		} else if path != "" || host != "" {
+			report("path and host: a tcp transport without an http header has none")
+		}
+		stream["tcpSettings"] = map[string]interface{}{"acceptProxyProtocol": false, "header": header}
+	case "ws", "httpupgrade":
+		if path == "" {
+			path = "/"
+		}
+		stream[network+"Settings"] = map[string]interface{}{
+			"acceptProxyProtocol": false,
+			"path":                path,
+			"host":                host,
+			"headers":             map[string]interface{}{},
+		}
+	case "splithttp":
+		if path == "" {
+			path = "/"
+		}
+		stream["splithttpSettings"] = map[string]interface{}{
+			"path":                 path,
+			"host":                 host,
+			"headers":              map[string]interface{}{},
+			"maxUploadSize":        1000000,
+			"maxConcurrentUploads": 10,
+		}
+	case "grpc":
+		stream["grpcSettings"] = map[string]interface{}{
+			"serviceName": take("serviceName"),
+			"authority":   take("authority"),
+			"multiMode":   take("mode") == "multi",
+		}
+		if path != "" || host != "" {
+			report("path and host: a grpc transport has none")
+		}
+	default:
+		return nil, common.NewError("unsupported link transport:", network)
+	}
+	if headerType != "" && network != "tcp" && headerType != "none" {
+		report("headerType %s: only a tcp transport has a header type", headerType)
+	}
+
+	security := take("security")
+	sni := take("sni")
+	fingerprint := take("fp")
+	alpn := take("alpn")
+	switch security {
+	case "", "none":
+		stream["security"] = "none"
+	case "tls":
+		settingService := SettingService{}
+		certFile, _ := settingService.GetCertFile()
+		keyFile, _ := settingService.GetKeyFile()
+		if certFile == "" || keyFile == "" {
+			return nil, common.NewError("a tls link needs the certificate files of the panel, they are not set")
+		}
+		tlsSettings := map[string]interface{}{
+			"serverName":   sni,
+			"certificates": []interface{}{map[string]interface{}{"certificateFile": certFile, "keyFile": keyFile, "ocspStapling": 3600}},
+			"alpn":         []string{},
+			"settings":     map[string]interface{}{"allowInsecure": false, "fingerprint": fingerprint},
+		}
+		if alpn != "" {
+			tlsSettings["alpn"] = strings.Split(alpn, ",")
+		}
+		stream["security"] = "tls"
+		stream["tlsSettings"] = tlsSettings
+		report("certificates: the certificate files of the panel are used")
+	case "reality":
+		if sni == "" {
+			return nil, common.NewError("a reality link needs an sni")
+		}
+		keyPair, err := (&ServerService{}).GetNewX25519Cert()
+		if err != nil {
+			return nil, common.NewError("generate reality keys:", err)
+		}
+		keys := keyPair.(map[string]interface{})
+		if fingerprint == "" {
+			fingerprint = "chrome"
+		}
+		shortId := take("sid")
+		spiderX := take("spx")
+		if spiderX == "" {
+			spiderX = "/"
+		}
+		stream["security"] = "reality"
+		stream["realitySettings"] = map[string]interface{}{
+			"show":        false,
+			"xver":        0,
+			"dest":        sni + ":443",
+			"serverNames": []string{sni},
+			"privateKey":  keys["privateKey"],
+			"minClient":   "",
+			"maxClient":   "",
+			"maxTimediff": 0,
+			"shortIds":    []string{shortId},
+			"settings":    map[string]interface{}{"publicKey": keys["publicKey"], "fingerprint": fingerprint, "serverName": "", "spiderX": spiderX},
+		}
+		if take("pbk") != "" {
+			report("pbk: the private key of the link server is unknown, a new key pair is generated")
+		}
+		if alpn != "" {
+			report("alpn %s: a reality inbound has no alpn", alpn)
+		}
+	default:
+		return nil, common.NewError("unsupported link security:", security)
+	}
+	return stream, nil
+}
+
+// linkClient builds the client of a link for an inbound of the same protocol,
+// a remark which is already the email of another client gets a random suffix
+func (s *InboundService) linkClient(link *ParsedLink, params map[string]string) (map[string]interface{}, error) {
+	allEmails, err := s.getAllEmails()
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSpace(link.Remark)
+	if base == "" {
+		base = random.Seq(8)
+	}
+	email := base
+	for s.contains(allEmails, email) {
+		email = base + "-" + random.Seq(4)
+	}
+	client := map[string]interface{}{
+		"email":      email,
+		"enable":     true,
+		"tgId":       "",
+		"subId":      random.Seq(16),
+		"reset":      0,
+		"totalGB":    0,
+		"expiryTime": 0,
+		"limitIp":    0,
+	}
+	switch link.Protocol {
+	case "trojan":
+		client["password"] = link.Password
+	case "vless":
+		client["id"] = link.Id
+		client["flow"] = params["flow"]
+		delete(params, "flow")
+	case "vmess":
+		client["id"] = link.Id
+		if aid := params["aid"]; aid == "" || aid == "0" {
+			delete(params, "aid")
+		}
+		if security := params["scy"]; security == "" || security == "auto" {
+			delete(params, "scy")
+		}
+	}
+	return client, nil
+}
+
+// testInboundConfig runs the xray config with inbound added, or replacing the inbound of the same tag, through xray -test
+func (s *InboundService) testInboundConfig(inbound *model.Inbound) error {
+	xrayService := XrayService{}
+	xrayConfig, err := xrayService.GetXrayConfig()
+	if err != nil {
+		return err
+	}
+	inboundConfig := s.genBoundInboundConfig(inbound)
+	index := slices.IndexFunc(xrayConfig.InboundConfigs, func(config xray.InboundConfig) bool {
+		return config.Tag == inbound.Tag
+	})
+	if index >= 0 {
+		xrayConfig.InboundConfigs[index] = *inboundConfig
+	} else {
+		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
+	}
+	output, err := xray.TestConfig(xrayConfig)
+	if err != nil {
+		return common.NewErrorf("xray rejects the imported config: %v %s", err, strings.TrimSpace(output))
+	}
+	return nil
+}
+
+// linkInboundMismatches compares the transport and security parameters of a link with the
+// stream settings of an existing inbound, returning the ones the inbound does not serve.
+// A host or tls sni the inbound does not restrict matches any value.
+func linkInboundMismatches(inbound *model.Inbound, params map[string]string) []string {
+	stream := map[string]interface{}{}
+	json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+	str := func(m map[string]interface{}, key string) string {
+		value, _ := m[key].(string)
+		return value
+	}
+	obj := func(m map[string]interface{}, key string) map[string]interface{} {
+		value, _ := m[key].(map[string]interface{})
+		return value
+	}
+	strs := func(value interface{}) []string {
+		list, _ := value.([]interface{})
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			if item, ok := item.(string); ok {
+				result = append(result, item)
+			}
+		}
+		return result
+	}
+
+	mismatches := make([]string, 0)
+	compare := func(key string, linkValue string, inboundValues []string, anyIfEmpty bool) {
+		if anyIfEmpty && (len(inboundValues) == 0 || inboundValues[0] == "") {
+			return
+		}
+		if !slices.Contains(inboundValues, linkValue) {
+			mismatches = append(mismatches, fmt.Sprintf("%s %q is not %q", key, linkValue, strings.Join(inboundValues, ",")))
+		}
+	}
+
+	network := params["type"]
+	if network == "" {
+		network = "tcp"
+	}
+	compare("type", network, []string{str(stream, "network")}, false)
+	path, host := params["path"], params["host"]
+	switch network {
+	case "tcp":
+		header := obj(obj(stream, "tcpSettings"), "header")
+		headerType, inboundHeaderType := params["headerType"], str(header, "type")
+		if headerType == "" {
+			headerType = "none"
+		}
+		if inboundHeaderType == "" {
+			inboundHeaderType = "none"
+		}
+		compare("headerType", headerType, []string{inboundHeaderType}, false)
+		if headerType == "http" && inboundHeaderType == "http" {
+			request := obj(header, "request")
+			if path == "" {
+				path = "/"
+			}
+			compare("path", path, strs(request["path"]), false)
+			if host != "" {
+				compare("host", host, strs(obj(request, "headers")["Host"]), true)
+			}
+		}
+	case "ws", "httpupgrade", "splithttp":
+		settings := obj(stream, network+"Settings")
+		// early data is a query parameter of the client path
+		path, _, _ = strings.Cut(path, "?")
+		if path == "" {
+			path = "/"
+		}
+		compare("path", path, []string{str(settings, "path")}, false)
+		if host != "" {
+			compare("host", host, []string{str(settings, "host")}, true)
+		}
+	case "grpc":
+		compare("serviceName", params["serviceName"], []string{str(obj(stream, "grpcSettings"), "serviceName")}, false)
+	}
+
+	security := params["security"]
+	if security == "" {
+		security = "none"
+	}
+	compare("security", security, []string{str(stream, "security")}, false)
+	sni := params["sni"]
+	switch security {
+	case "tls":
+		if sni != "" {
+			compare("sni", sni, []string{str(obj(stream, "tlsSettings"), "serverName")}, true)
+		}
+	case "reality":
+		reality := obj(stream, "realitySettings")
+		compare("sni", sni, strs(reality["serverNames"]), false)
+		compare("sid", params["sid"], strs(reality["shortIds"]), false)
+		compare("pbk", params["pbk"], []string{str(obj(reality, "settings"), "publicKey")}, false)
+	}
+	return mismatches
+}
+
+// ImportLink adds the client of a vmess, vless or trojan share link to the inbound on the port of
+// the link when its protocol, transport and security match the link, or creates that inbound when
+// the port is free.
+// The config is checked with xray before anything is saved.
+func (s *InboundService) ImportLink(rawLink string, userId int) (*LinkImportResult, bool, error) {
+	link, err := (&ServerService{}).ParseLink(rawLink)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(link.Errors) > 0 {
+		return nil, false, common.NewErrorf("invalid %s: %s", link.Errors[0].Field, link.Errors[0].Error)
+	}
+	switch link.Protocol {
+	case "vmess", "vless", "trojan":
+	default:
+		return nil, false, common.NewError("only vmess, vless and trojan links can be imported, not", link.Protocol)
+	}
+
+	params := link.Params
+	if link.Protocol == "vmess" {
+		params = normalizeVmessParams(params)
+	}
+	unmapped := make([]string, 0)
+	report := func(format string, a ...interface{}) {
+		unmapped = append(unmapped, fmt.Sprintf(format, a...))
+	}
+
+	client, err := s.linkClient(link, params)
+	if err != nil {
+		return nil, false, err
+	}
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return nil, false, err
+	}
+	var existing *model.Inbound
+	for _, inbound := range inbounds {
+		if inbound.Port == link.Port {
+			existing = inbound
+			break
+		}
+	}
+	result := &LinkImportResult{Email: client["email"].(string)}
+
+	if existing != nil {
+		if string(existing.Protocol) != link.Protocol {
+			return nil, false, common.NewErrorf("port %d is used by inbound %q of %s", link.Port, existing.Remark, existing.Protocol)
+		}
+		mismatches := linkInboundMismatches(existing, params)
+		if len(mismatches) > 0 {
+			return nil, false, common.NewErrorf("link does not match inbound %q on port %d: %s", existing.Remark, link.Port, strings.Join(mismatches, ", "))
+		}
+		for key, value := range params {
+			if !slices.Contains(clientOnlyLinkParams, key) && !slices.Contains(streamLinkParams, key) {
+				report("%s=%s: not supported by the import", key, value)
+			}
+		}
+		slices.Sort(unmapped)
+		result.Unmapped = unmapped
+
+		settings := map[string]interface{}{}
+		err = json.Unmarshal([]byte(existing.Settings), &settings)
+		if err != nil {
+			return nil, false, err
+		}
+		clients, _ := settings["clients"].([]interface{})
+		settings["clients"] = append(clients, client)
+		candidate := *existing
+		candidateSettings, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, false, err
+		}
+		candidate.Settings = string(candidateSettings)
+		err = s.testInboundConfig(&candidate)
+		if err != nil {
+			return nil, false, err
+		}
+
+		data, err := json.Marshal(map[string]interface{}{"clients": []interface{}{client}})
+		if err != nil {
+			return nil, false, err
+		}
+		needRestart, err := s.AddInboundClient(&model.Inbound{Id: existing.Id, Settings: string(data)})
+		if err != nil {
+			return nil, false, err
+		}
+		result.Inbound, err = s.GetInbound(existing.Id)
+		return result, needRestart, err
+	}
+
+	stream, err := s.linkStreamSettings(params, report)
+	if err != nil {
+		return nil, false, err
+	}
+	for key, value := range params {
+		if !slices.Contains(clientOnlyLinkParams, key) {
+			report("%s=%s: not supported by the import", key, value)
+		}
+	}
+	slices.Sort(unmapped)
+	report("address %s: the inbound listens on all addresses of this server", link.Address)
+	result.Unmapped = unmapped
+
+	settings := map[string]interface{}{"clients": []interface{}{client}}
+	if link.Protocol != "vmess" {
+		settings["fallbacks"] = []interface{}{}
+	}
+	if link.Protocol == "vless" {
+		settings["decryption"] = "none"
+	}
+	settingsJson, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	streamJson, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	remark := link.Remark
+	if remark == "" {
+		remark = link.Protocol + "-" + strconv.Itoa(link.Port)
+	}
+	inbound := &model.Inbound{
+		UserId:         userId,
+		Remark:         remark,
+		Enable:         true,
+		Port:           link.Port,
+		Protocol:       model.Protocol(link.Protocol),
+		Settings:       string(settingsJson),
+		StreamSettings: string(streamJson),
+		Tag:            defaultInboundTag("", link.Port),
+	}
+	err = s.applyInboundDefaults(inbound)
+	if err != nil {
+		return nil, false, err
+	}
+	if inbound.Sniffing == "" {
+		inbound.Sniffing = `{"enabled":true,"destOverride":["http","tls","quic","fakedns"]}`
+	}
+	err = s.testInboundConfig(inbound)
+	if err != nil {
+		return nil, false, err
+	}
+	inbound, needRestart, err := s.AddInbound(inbound)
+	if err != nil {
+		return nil, false, err
+	}
+	result.Inbound = inbound
+	result.Created = true
+	return result, needRestart, nil
+}
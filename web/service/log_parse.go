@@ -0,0 +1,97 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// LogEntry is a log line split into its parts, Parsed is false when no known format matched
+// and the line is only in Raw.
+type LogEntry struct {
+	Time     string `json:"time,omitempty"`
+	Level    string `json:"level,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Dest     string `json:"dest,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Inbound  string `json:"inbound,omitempty"`
+	Outbound string `json:"outbound,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Raw      string `json:"raw"`
+	Parsed   bool   `json:"parsed"`
+}
+
+var (
+	// the panel log buffer: "2006/01/02 15:04:05 LEVEL - message"
+	panelLogRegex = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) ([A-Z]+) - (.*)$`)
+	// journalctl: "Jan 02 15:04:05 host x-ui[123]: LEVEL - message"
+	syslogRegex = regexp.MustCompile(`^([A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}) \S+ [^:]+: ([A-Z]+) - (.*)$`)
+	// xray access: "[2006/01/02 15:04:05.000000 ][from ]1.2.3.4:5678 accepted tcp:example.com:443 [in >> out] email: user"
+	xrayAccessRegex = regexp.MustCompile(`^(?:(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?) )?(?:from )?(\S+) (accepted|rejected) (\S+)(?: \[([^\]]*)\])?(?: email: (\S+))?`)
+	// xray error log without the panel prefix: "[Info] [123] message"
+	xrayLevelRegex = regexp.MustCompile(`^\[(Debug|Info|Warning|Error)\] (.*)$`)
+	// the panel access log: "2006/01/02 15:04:05 1.2.3.4 GET /path 200 1.5ms"
+	panelAccessRegex = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) (\S+) ([A-Z]+ \S+ \d{3} \S+)$`)
+)
+
+// ParseLogs splits the lines returned by GetLogs into entries, a line of no known format is kept raw
+func ParseLogs(lines []string) []*LogEntry {
+	entries := make([]*LogEntry, 0, len(lines))
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		entries = append(entries, parseLogLine(line))
+	}
+	return entries
+}
+
+func parseLogLine(line string) *LogEntry {
+	entry := &LogEntry{Raw: line}
+	var message string
+	if matches := panelLogRegex.FindStringSubmatch(line); matches != nil {
+		entry.Time, entry.Level, message = matches[1], matches[2], matches[3]
+	} else if matches := syslogRegex.FindStringSubmatch(line); matches != nil {
+		entry.Time, entry.Level, message = matches[1], matches[2], matches[3]
+	} else if matches := panelAccessRegex.FindStringSubmatch(line); matches != nil {
+		entry.Time, entry.Source, entry.Message = matches[1], matches[2], matches[3]
+		entry.Parsed = true
+		return entry
+	} else {
+		return entry
+	}
+	entry.Parsed = true
+	entry.Message = message
+
+	body, fromXray := strings.CutPrefix(message, "XRAY: ")
+	if !fromXray {
+		return entry
+	}
+	if matches := xrayLevelRegex.FindStringSubmatch(body); matches != nil {
+		body = matches[2]
+		entry.Message = "XRAY: " + body
+	}
+	parseXrayAccess(entry, body)
+	return entry
+}
+
+// parseXrayAccess fills entry with the parts of an xray access log line, when body is one
+func parseXrayAccess(entry *LogEntry, body string) {
+	if matches := xrayAccessRegex.FindStringSubmatch(body); matches != nil {
+		if matches[1] != "" {
+			entry.Time = matches[1]
+		}
+		entry.Source = matches[2]
+		entry.Status = matches[3]
+		entry.Dest = matches[4]
+		// the route is "inbound >> outbound", or "inbound -> outbound" in older versions
+		route := strings.Replace(matches[5], "->", ">>", 1)
+		if inbound, outbound, ok := strings.Cut(route, ">>"); ok {
+			entry.Inbound = strings.TrimSpace(inbound)
+			entry.Outbound = strings.TrimSpace(outbound)
+		} else {
+			entry.Inbound = strings.TrimSpace(route)
+		}
+		entry.Email = matches[6]
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/logger"
+)
+
+func (s *UserService) AddLoginAttempt(username string, ip string, success bool) {
+	db := database.GetDB()
+	err := db.Create(&model.LoginAttempt{
+		Time:     time.Now().Unix(),
+		IP:       ip,
+		Username: username,
+		Success:  success,
+	}).Error
+	if err != nil {
+		logger.Warning("save login attempt failed:", err)
+	}
+}
+
+// GetLoginAttempts returns a page of login attempts, newest first, and the total count.
+func (s *UserService) GetLoginAttempts(page int, pageSize int, onlyFailed bool) ([]*model.LoginAttempt, int64, error) {
+	db := database.GetDB()
+	query := db.Model(model.LoginAttempt{})
+	if onlyFailed {
+		query = query.Where("success = ?", false)
+	}
+	var total int64
+	err := query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	attempts := make([]*model.LoginAttempt, 0)
+	err = query.Order("time desc, id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&attempts).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return attempts, total, nil
+}
+
+// DelLoginAttemptsBefore deletes the login attempts older than before (unix seconds).
+func (s *UserService) DelLoginAttemptsBefore(before int64) (int64, error) {
+	db := database.GetDB()
+	result := db.Where("time < ?", before).Delete(model.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/xray"
+)
+
+const outboundProbeTimeout = 5 * time.Second
+
+type OutboundHealth struct {
+	Tag       string  `json:"tag"`
+	Protocol  string  `json:"protocol"`
+	Address   string  `json:"address,omitempty"`
+	Status    string  `json:"status"`           // up, down or unknown when it can not be probed
+	Source    string  `json:"source,omitempty"` // probe or observatory
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+	CheckedAt int64   `json:"checkedAt"`
+}
+
+var (
+	outboundHealth     = map[string]*OutboundHealth{}
+	outboundHealthLock sync.Mutex
+)
+
+// outboundAddress returns the host:port of the upstream server of an outbound,
+// empty for outbounds without one like freedom or blackhole
+func outboundAddress(outbound map[string]interface{}) string {
+	settings, _ := outbound["settings"].(map[string]interface{})
+	for _, key := range []string{"vnext", "servers"} {
+		servers, _ := settings[key].([]interface{})
+		if len(servers) == 0 {
+			continue
+		}
+		server, _ := servers[0].(map[string]interface{})
+		address, _ := server["address"].(string)
+		port, _ := server["port"].(float64)
+		if address != "" && port > 0 {
+			return net.JoinHostPort(address, strconv.Itoa(int(port)))
+		}
+	}
+	return ""
+}
+
+func (s *XrayService) getOutbounds() ([]map[string]interface{}, error) {
+	xrayConfig, err := s.GetXrayConfig()
+	if err != nil {
+		return nil, err
+	}
+	outbounds := make([]map[string]interface{}, 0)
+	err = json.Unmarshal(xrayConfig.OutboundConfigs, &outbounds)
+	if err != nil {
+		return nil, err
+	}
+	return outbounds, nil
+}
+
+// GetOutboundsHealth lists the outbounds of the effective config with their last probe result
+func (s *XrayService) GetOutboundsHealth() ([]*OutboundHealth, error) {
+	outbounds, err := s.getOutbounds()
+	if err != nil {
+		return nil, err
+	}
+	observations := s.getObservations()
+
+	outboundHealthLock.Lock()
+	defer outboundHealthLock.Unlock()
+	result := make([]*OutboundHealth, 0, len(outbounds))
+	for _, outbound := range outbounds {
+		tag, _ := outbound["tag"].(string)
+		protocol, _ := outbound["protocol"].(string)
+		health := &OutboundHealth{Tag: tag, Protocol: protocol, Status: "unknown"}
+		if cached, ok := outboundHealth[tag]; ok && cached.Protocol == protocol {
+			*health = *cached
+		}
+		// the observatory probes through the outbound, so it wins over the dial probe
+		if observation, ok := observations[tag]; ok && observation.LastTryTime > 0 {
+			health.Source = "observatory"
+			health.CheckedAt = observation.LastTryTime
+			health.Error = observation.LastError
+			health.LatencyMs = float64(observation.Delay)
+			health.Status = "down"
+			if observation.Alive {
+				health.Status = "up"
+			}
+		}
+		result = append(result, health)
+	}
+	return result, nil
+}
+
+// getObservations returns the observatory results by outbound tag, empty when xray
+// does not run an observatory
+func (s *XrayService) getObservations() map[string]*xray.OutboundStatus {
+	observations := map[string]*xray.OutboundStatus{}
+	if !s.IsXrayRunning() || len(p.GetConfig().Observatory) == 0 {
+		return observations
+	}
+	s.xrayAPI.Init(p.GetAPIPort())
+	defer s.xrayAPI.Close()
+	statuses, err := s.xrayAPI.GetObservatoryStatus()
+	if err != nil {
+		logger.Debug("get observatory status failed:", err)
+		return observations
+	}
+	for _, status := range statuses {
+		observations[status.Tag] = status
+	}
+	return observations
+}
+
+// ProbeOutbounds dials the upstream server of every outbound and caches the results. It only
+// tells whether the server is reachable, not whether the proxy protocol works through it.
+func (s *XrayService) ProbeOutbounds() error {
+	outbounds, err := s.getOutbounds()
+	if err != nil {
+		return err
+	}
+	results := make(map[string]*OutboundHealth, len(outbounds))
+	var wg sync.WaitGroup
+	for _, outbound := range outbounds {
+		tag, _ := outbound["tag"].(string)
+		protocol, _ := outbound["protocol"].(string)
+		health := &OutboundHealth{
+			Tag:       tag,
+			Protocol:  protocol,
+			Address:   outboundAddress(outbound),
+			Status:    "unknown",
+			Source:    "probe",
+			CheckedAt: time.Now().Unix(),
+		}
+		results[tag] = health
+		// wireguard and others without a tcp server are not probed
+		if health.Address == "" || protocol == "wireguard" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", health.Address, outboundProbeTimeout)
+			if err != nil {
+				health.Status = "down"
+				health.Error = err.Error()
+				return
+			}
+			conn.Close()
+			health.Status = "up"
+			health.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		}()
+	}
+	wg.Wait()
+
+	outboundHealthLock.Lock()
+	outboundHealth = results
+	outboundHealthLock.Unlock()
+	return nil
+}
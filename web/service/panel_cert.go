@@ -0,0 +1,147 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"x-ui/logger"
+)
+
+func (s *SettingService) GetWebSelfSigned() (bool, error) {
+	return s.getBool("webSelfSigned")
+}
+
+// GetSelfSignedCert returns the self-signed certificate of the panel, it is generated on the
+// first call and kept in the settings so that its fingerprint stays the same across restarts
+func (s *SettingService) GetSelfSignedCert() (*tls.Certificate, error) {
+	certPEM, err := s.getString("webSelfSignedCert")
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := s.getString("webSelfSignedKey")
+	if err != nil {
+		return nil, err
+	}
+	if certPEM != "" && keyPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err == nil {
+			return &cert, nil
+		}
+		logger.Warning("stored self-signed certificate is invalid, generating a new one:", err)
+	}
+
+	certPEM, keyPEM, err = s.generateSelfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+	err = s.saveSetting("webSelfSignedCert", certPEM)
+	if err != nil {
+		return nil, err
+	}
+	err = s.saveSetting("webSelfSignedKey", keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("generated a self-signed certificate for the panel, sha256 fingerprint:", CertFingerprint(&cert))
+	return &cert, nil
+}
+
+// GetSelfSignedFingerprint returns the fingerprint of the self-signed certificate when the panel
+// serves it, that is when it is enabled and no certificate files are set
+func (s *SettingService) GetSelfSignedFingerprint() string {
+	enabled, err := s.GetWebSelfSigned()
+	if err != nil || !enabled {
+		return ""
+	}
+	certFile, _ := s.GetCertFile()
+	keyFile, _ := s.GetKeyFile()
+	if certFile != "" || keyFile != "" {
+		return ""
+	}
+	certPEM, err := s.getString("webSelfSignedCert")
+	if err != nil {
+		return ""
+	}
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return ""
+	}
+	return CertFingerprint(&tls.Certificate{Certificate: [][]byte{block.Bytes}})
+}
+
+// CertFingerprint returns the sha256 fingerprint of the leaf certificate as colon separated hex
+func CertFingerprint(cert *tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	hexSum := strings.ToUpper(hex.EncodeToString(sum[:]))
+	parts := make([]string, 0, len(sum))
+	for i := 0; i < len(hexSum); i += 2 {
+		parts = append(parts, hexSum[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+func (s *SettingService) generateSelfSignedCert() (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "x-ui"
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{hostname, "localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if domain, err := s.GetWebDomain(); err == nil && domain != "" && domain != hostname {
+		template.DNSNames = append(template.DNSNames, domain)
+	}
+	if listen, err := s.GetListen(); err == nil {
+		if ip := net.ParseIP(listen); ip != nil && !ip.IsUnspecified() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM), nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"net"
+	"strconv"
+
+	"x-ui/util/common"
+)
+
+type PortProbe struct {
+	Port     int    `json:"port"`
+	Network  string `json:"network"`
+	Listen   string `json:"listen"`
+	Bindable bool   `json:"bindable"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ProbePort tries to bind port on listen, an empty listen being all addresses, and releases
+// it right away. A port already used by the panel or xray is reported as not bindable.
+func (s *ServerService) ProbePort(network string, listen string, port int) (*PortProbe, error) {
+	if port < 1 || port > 65535 {
+		return nil, common.NewError("port is not valid:", port)
+	}
+	if listen != "" && net.ParseIP(listen) == nil {
+		return nil, common.NewError("listen is not an ip address:", listen)
+	}
+	probe := &PortProbe{Port: port, Network: network, Listen: listen}
+	address := net.JoinHostPort(listen, strconv.Itoa(port))
+	var err error
+	switch network {
+	case "tcp":
+		var listener net.Listener
+		listener, err = net.Listen("tcp", address)
+		if err == nil {
+			listener.Close()
+		}
+	case "udp":
+		var conn net.PacketConn
+		conn, err = net.ListenPacket("udp", address)
+		if err == nil {
+			conn.Close()
+		}
+	default:
+		return nil, common.NewError("network must be tcp or udp:", network)
+	}
+	probe.Bindable = err == nil
+	if err != nil {
+		probe.Error = err.Error()
+	}
+	return probe, nil
+}
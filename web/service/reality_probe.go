@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strings"
+	"time"
+
+	"x-ui/util/common"
+)
+
+const probeDestTimeout = 5 * time.Second
+
+type ProbeCert struct {
+	Subject  string   `json:"subject"`
+	Issuer   string   `json:"issuer"`
+	DNSNames []string `json:"dnsNames,omitempty"`
+	NotAfter int64    `json:"notAfter"`
+}
+
+type ProbeDestResult struct {
+	Dest      string      `json:"dest"`
+	Address   string      `json:"address"`
+	Version   string      `json:"version"`
+	ALPN      string      `json:"alpn"`
+	Cipher    string      `json:"cipher"`
+	Verified  bool        `json:"verified"`
+	VerifyErr string      `json:"verifyError,omitempty"`
+	Certs     []ProbeCert `json:"certs"`
+	LatencyMs float64     `json:"latencyMs"`
+	Suitable  bool        `json:"suitable"`
+	// why the dest is not a good REALITY target
+	Problems []string `json:"problems"`
+}
+
+// ProbeDest makes a TLS handshake with dest, a domain with an optional port (443 by default),
+// and tells whether it fits as the dest of a REALITY inbound: TLS 1.3, h2 and a valid certificate
+func (s *ServerService) ProbeDest(dest string) (*ProbeDestResult, error) {
+	dest = strings.TrimSpace(dest)
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil {
+		host, port = dest, "443"
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return nil, common.NewError("dest must be a domain:", dest)
+	}
+	address := net.JoinHostPort(host, port)
+
+	config := &tls.Config{
+		ServerName: host,
+		NextProtos: []string{"h2", "http/1.1"},
+		// the chain is verified below so that an invalid certificate is reported, not fatal
+		InsecureSkipVerify: true,
+	}
+	dialer := &tls.Dialer{Config: config}
+	ctx, cancel := context.WithTimeout(context.Background(), probeDestTimeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, common.NewError("tls handshake with", address, "failed:", err)
+	}
+	latency := time.Since(start)
+	defer conn.Close()
+	state := conn.(*tls.Conn).ConnectionState()
+
+	result := &ProbeDestResult{
+		Dest:      host,
+		Address:   conn.RemoteAddr().String(),
+		Version:   tls.VersionName(state.Version),
+		ALPN:      state.NegotiatedProtocol,
+		Cipher:    tls.CipherSuiteName(state.CipherSuite),
+		Certs:     make([]ProbeCert, 0, len(state.PeerCertificates)),
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+		Problems:  make([]string, 0),
+	}
+	for _, cert := range state.PeerCertificates {
+		result.Certs = append(result.Certs, ProbeCert{
+			Subject:  cert.Subject.CommonName,
+			Issuer:   cert.Issuer.CommonName,
+			DNSNames: cert.DNSNames,
+			NotAfter: cert.NotAfter.Unix(),
+		})
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		intermediates := x509.NewCertPool()
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err = state.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       host,
+			Intermediates: intermediates,
+		})
+		result.Verified = err == nil
+		if err != nil {
+			result.VerifyErr = err.Error()
+		}
+	}
+
+	if state.Version != tls.VersionTLS13 {
+		result.Problems = append(result.Problems, "TLS 1.3 is not supported")
+	}
+	if state.NegotiatedProtocol != "h2" {
+		result.Problems = append(result.Problems, "HTTP/2 is not supported")
+	}
+	if !result.Verified {
+		result.Problems = append(result.Problems, "the certificate is not valid for the domain")
+	}
+	result.Suitable = len(result.Problems) == 0
+	return result, nil
+}
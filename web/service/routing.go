@@ -0,0 +1,260 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"x-ui/util/common"
+)
+
+type RoutingTestRequest struct {
+	Destination string `json:"destination" form:"destination"`
+	Port        int    `json:"port" form:"port"`
+	Network     string `json:"network" form:"network"`
+	InboundTag  string `json:"inboundTag" form:"inboundTag"`
+}
+
+type RoutingTestResult struct {
+	RuleIndex   int                    `json:"ruleIndex"`
+	Rule        map[string]interface{} `json:"rule"`
+	OutboundTag string                 `json:"outboundTag"`
+	BalancerTag string                 `json:"balancerTag"`
+	// rules which could not be evaluated, e.g. geosite/geoip lists or user/protocol conditions
+	SkippedRules []int `json:"skippedRules"`
+}
+
+var privateIPNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.0.0.0/24", "192.0.2.0/24", "192.88.99.0/24", "192.168.0.0/16",
+		"198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/3",
+		"::/127", "fc00::/7", "fe80::/10", "ff00::/8",
+	} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		nets = append(nets, ipNet)
+	}
+	return nets
+}()
+
+// errRuleNotTestable marks rule conditions which can not be evaluated without xray itself
+var errRuleNotTestable = common.NewError("rule is not testable")
+
+func toStringSlice(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Split(value, ",")
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, v := range value {
+			result = append(result, fmt.Sprint(v))
+		}
+		return result
+	}
+	return nil
+}
+
+func matchDomain(patterns []string, domain string) (bool, error) {
+	domain = strings.ToLower(domain)
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		switch {
+		case strings.HasPrefix(pattern, "geosite:"), strings.HasPrefix(pattern, "ext:"):
+			return false, errRuleNotTestable
+		case strings.HasPrefix(pattern, "full:"):
+			if domain == strings.ToLower(pattern[len("full:"):]) {
+				return true, nil
+			}
+		case strings.HasPrefix(pattern, "domain:"):
+			d := strings.ToLower(pattern[len("domain:"):])
+			if domain == d || strings.HasSuffix(domain, "."+d) {
+				return true, nil
+			}
+		case strings.HasPrefix(pattern, "regexp:"):
+			re, err := regexp.Compile(pattern[len("regexp:"):])
+			if err != nil {
+				return false, err
+			}
+			if re.MatchString(domain) {
+				return true, nil
+			}
+		case strings.HasPrefix(pattern, "keyword:"):
+			if strings.Contains(domain, strings.ToLower(pattern[len("keyword:"):])) {
+				return true, nil
+			}
+		default:
+			if strings.Contains(domain, strings.ToLower(pattern)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func matchIP(patterns []string, ip net.IP) (bool, error) {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		switch {
+		case pattern == "geoip:private":
+			for _, ipNet := range privateIPNets {
+				if ipNet.Contains(ip) {
+					return true, nil
+				}
+			}
+		case strings.HasPrefix(pattern, "geoip:"), strings.HasPrefix(pattern, "ext:"):
+			return false, errRuleNotTestable
+		case strings.Contains(pattern, "/"):
+			_, ipNet, err := net.ParseCIDR(pattern)
+			if err != nil {
+				return false, err
+			}
+			if ipNet.Contains(ip) {
+				return true, nil
+			}
+		default:
+			if ip.Equal(net.ParseIP(pattern)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func matchPort(value interface{}, port int) (bool, error) {
+	for _, portRange := range toStringSlice(value) {
+		portRange = strings.TrimSpace(portRange)
+		from, to, found := strings.Cut(portRange, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return false, common.NewError("invalid port in rule:", portRange)
+		}
+		end := start
+		if found {
+			end, err = strconv.Atoi(strings.TrimSpace(to))
+			if err != nil {
+				return false, common.NewError("invalid port in rule:", portRange)
+			}
+		}
+		if port >= start && port <= end {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchRoutingRule(rule map[string]interface{}, req *RoutingTestRequest) (bool, error) {
+	for _, key := range []string{"source", "sourcePort", "user", "protocol", "attrs"} {
+		if _, ok := rule[key]; ok {
+			return false, errRuleNotTestable
+		}
+	}
+	ip := net.ParseIP(req.Destination)
+	if domains, ok := rule["domain"]; ok {
+		// domain rules never match an ip destination
+		if ip != nil {
+			return false, nil
+		}
+		matched, err := matchDomain(toStringSlice(domains), req.Destination)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if ips, ok := rule["ip"]; ok {
+		// with AsIs domain strategy ip rules never match a domain destination
+		if ip == nil {
+			return false, nil
+		}
+		matched, err := matchIP(toStringSlice(ips), ip)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if port, ok := rule["port"]; ok {
+		matched, err := matchPort(port, req.Port)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if network, ok := rule["network"]; ok {
+		matched := false
+		for _, n := range toStringSlice(network) {
+			if strings.TrimSpace(n) == req.Network {
+				matched = true
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	if inboundTags, ok := rule["inboundTag"]; ok {
+		matched := false
+		for _, tag := range toStringSlice(inboundTags) {
+			if tag == req.InboundTag {
+				matched = true
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// TestRouting finds the routing rule of the xray template which matches req,
+// mirroring xray's rule semantics: rules are checked in order and all conditions of a rule must match.
+// Without a matching rule the first outbound is used.
+func (s *XraySettingService) TestRouting(req *RoutingTestRequest) (*RoutingTestResult, error) {
+	if req.Destination == "" {
+		return nil, common.NewError("destination can not be empty")
+	}
+	if req.Port < 0 || req.Port > 65535 {
+		return nil, common.NewError("port is not valid:", req.Port)
+	}
+	if req.Network == "" {
+		req.Network = "tcp"
+	}
+
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return nil, err
+	}
+	result := &RoutingTestResult{
+		RuleIndex:    -1,
+		SkippedRules: make([]int, 0),
+	}
+
+	routing, _ := config["routing"].(map[string]interface{})
+	rules, _ := routing["rules"].([]interface{})
+	for index, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		matched, err := matchRoutingRule(rule, req)
+		if err == errRuleNotTestable {
+			result.SkippedRules = append(result.SkippedRules, index)
+			continue
+		}
+		if err != nil {
+			return nil, common.NewErrorf("routing rule %d: %v", index, err)
+		}
+		if matched {
+			result.RuleIndex = index
+			result.Rule = rule
+			result.OutboundTag, _ = rule["outboundTag"].(string)
+			result.BalancerTag, _ = rule["balancerTag"].(string)
+			return result, nil
+		}
+	}
+
+	outbounds, _ := config["outbounds"].([]interface{})
+	if len(outbounds) > 0 {
+		if outbound, ok := outbounds[0].(map[string]interface{}); ok {
+			result.OutboundTag, _ = outbound["tag"].(string)
+		}
+	}
+	return result, nil
+}
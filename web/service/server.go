@@ -3,6 +3,8 @@ package service
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/ecdh"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,9 +13,11 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"x-ui/config"
@@ -59,6 +63,9 @@ type Status struct {
 		State    ProcessState `json:"state"`
 		ErrorMsg string       `json:"errorMsg"`
 		Version  string       `json:"version"`
+		Stats    bool         `json:"stats"`
+		// GOGC and GOMEMLIMIT of the running xray, empty for the go defaults
+		MemTuning XrayMemTuning `json:"memTuning"`
 	} `json:"xray"`
 	Uptime   uint64    `json:"uptime"`
 	Loads    []float64 `json:"loads"`
@@ -82,15 +89,85 @@ type Status struct {
 		Ipv4     string `json:"ipv4"`
 		Ipv6     string `json:"ipv6"`
 	} `json:"hostInfo"`
+	XrayInstances []XrayInstanceStatus `json:"xrayInstances"`
+	XrayWatchdog  XrayWatchdogState    `json:"xrayWatchdog"`
+	// unix time of the pending scheduled xray restart, 0 if none
+	ScheduledRestart int64 `json:"scheduledRestart"`
+	// global inbound bind mode, empty when inbounds bind as configured
+	InboundBind string `json:"inboundBind"`
 }
 
 type Release struct {
 	TagName string `json:"tag_name"`
 }
 
+type XrayUpdateInfo struct {
+	Installed       string `json:"installed"`
+	Latest          string `json:"latest"`
+	UpdateAvailable bool   `json:"updateAvailable"`
+	Stale           bool   `json:"stale"`
+}
+
+type TrafficChange struct {
+	Name string `json:"name"`
+	Up   int64  `json:"up"`
+	Down int64  `json:"down"`
+}
+
+type TrafficResync struct {
+	Inbounds     []TrafficChange `json:"inbounds"`
+	Clients      []TrafficChange `json:"clients"`
+	FixedCounter int64           `json:"fixedCounter"`
+}
+
+type InstallState string
+
+const (
+	InstallIdle        InstallState = "Idle"
+	InstallDownloading InstallState = "Downloading"
+	InstallInstalling  InstallState = "Installing"
+	InstallCompleted   InstallState = "Completed"
+	InstallFailed      InstallState = "Failed"
+)
+
+type InstallProgress struct {
+	Version    string       `json:"version"`
+	State      InstallState `json:"state"`
+	Percent    float64      `json:"percent"`
+	Downloaded int64        `json:"downloaded"`
+	Total      int64        `json:"total"`
+	ErrorMsg   string       `json:"errorMsg"`
+}
+
+var (
+	installProgress     = InstallProgress{State: InstallIdle}
+	installProgressLock sync.Mutex
+)
+
+// progressWriter records the number of bytes written into the shared install progress
+type progressWriter struct{}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	installProgressLock.Lock()
+	defer installProgressLock.Unlock()
+	installProgress.Downloaded += int64(len(b))
+	if installProgress.Total > 0 {
+		installProgress.Percent = float64(installProgress.Downloaded) * 100 / float64(installProgress.Total)
+	}
+	return len(b), nil
+}
+
+func setInstallProgress(update func(progress *InstallProgress)) {
+	installProgressLock.Lock()
+	defer installProgressLock.Unlock()
+	update(&installProgress)
+}
+
 type ServerService struct {
-	xrayService    XrayService
-	inboundService InboundService
+	xrayService         XrayService
+	inboundService      InboundService
+	xrayInstanceService XrayInstanceService
+	xraySettingService  XraySettingService
 }
 
 func (s *ServerService) GetStatus(lastStatus *Status) *Status {
@@ -187,6 +264,12 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 		status.Xray.ErrorMsg = s.xrayService.GetXrayResult()
 	}
 	status.Xray.Version = s.xrayService.GetXrayVersion()
+	status.Xray.Stats = s.xrayService.IsStatsEnabled()
+	status.Xray.MemTuning = GetActiveXrayMemTuning()
+	status.XrayInstances = s.xrayInstanceService.GetInstancesStatus()
+	status.XrayWatchdog = GetXrayWatchdogState()
+	status.ScheduledRestart = GetScheduledRestart()
+	status.InboundBind, _ = s.xraySettingService.GetInboundBind()
 
 	var rtm runtime.MemStats
 	runtime.ReadMemStats(&rtm)
@@ -221,14 +304,68 @@ func (s *ServerService) GetStatus(lastStatus *Status) *Status {
 	return status
 }
 
+type PanelInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	// sha256 fingerprint of the self-signed certificate when the panel serves one
+	CertFingerprint string `json:"certFingerprint,omitempty"`
+}
+
+func (s *ServerService) GetPanelInfo() *PanelInfo {
+	settingService := SettingService{}
+	return &PanelInfo{
+		Name:      config.GetName(),
+		Version:   config.GetVersion(),
+		Commit:    config.GetCommit(),
+		BuildTime: config.GetBuildTime(),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+
+		CertFingerprint: settingService.GetSelfSignedFingerprint(),
+	}
+}
+
+// GetXrayVersions fetches the xray releases, retrying failed requests with a doubling delay
 func (s *ServerService) GetXrayVersions() ([]string, error) {
+	settingService := SettingService{}
+	retries, err := settingService.GetXrayVersionRetries()
+	if err != nil {
+		retries = 3
+	}
+	timeout, err := settingService.GetXrayVersionTimeout()
+	if err != nil || timeout < 1 {
+		timeout = 10
+	}
+	client := newHTTPClient(time.Duration(timeout) * time.Second)
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		versions, err := fetchXrayVersions(client)
+		if err == nil || attempt >= retries {
+			return versions, err
+		}
+		logger.Warningf("get xray versions failed, retrying in %v: %v", delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func fetchXrayVersions(client *http.Client) ([]string, error) {
 	url := "https://api.github.com/repos/XTLS/Xray-core/releases"
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return nil, err
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, common.NewError("github releases returned", resp.Status)
+	}
 	buffer := bytes.NewBuffer(make([]byte, 8192))
 	buffer.Reset()
 	_, err = buffer.ReadFrom(resp.Body)
@@ -250,6 +387,105 @@ func (s *ServerService) GetXrayVersions() ([]string, error) {
 	return versions, nil
 }
 
+// compareVersions compares two dotted versions like "v1.8.16", ignoring the "v" prefix
+func compareVersions(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aNum, bNum int
+		if i < len(aParts) {
+			aNum, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bNum, _ = strconv.Atoi(bParts[i])
+		}
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// InboundLabel names an inbound by its stable tag and its editable remark
+type InboundLabel struct {
+	Id     int    `json:"id"`
+	Tag    string `json:"tag"`
+	Remark string `json:"remark"`
+	Enable bool   `json:"enable"`
+}
+
+type Summary struct {
+	Status          *Status         `json:"status"`
+	Inbounds        int             `json:"inbounds"`
+	InboundLabels   []InboundLabel  `json:"inboundLabels"`
+	EnabledInbounds int             `json:"enabledInbounds"`
+	Clients         int             `json:"clients"`
+	ActiveClients   int             `json:"activeClients"`
+	OnlineClients   int             `json:"onlineClients"`
+	Up              int64           `json:"up"`
+	Down            int64           `json:"down"`
+	XrayVersion     string          `json:"xrayVersion"`
+	XrayUpdate      *XrayUpdateInfo `json:"xrayUpdate"`
+}
+
+// GetSummary composes the dashboard data, versions may be nil when the release list is not available
+func (s *ServerService) GetSummary(status *Status, versions []string) (*Summary, error) {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return nil, err
+	}
+	summary := &Summary{
+		Status:        status,
+		Inbounds:      len(inbounds),
+		InboundLabels: make([]InboundLabel, 0, len(inbounds)),
+		XrayVersion:   s.xrayService.GetXrayVersion(),
+	}
+	for _, inbound := range inbounds {
+		summary.InboundLabels = append(summary.InboundLabels, InboundLabel{
+			Id:     inbound.Id,
+			Tag:    inbound.Tag,
+			Remark: inbound.Remark,
+			Enable: inbound.Enable,
+		})
+		if inbound.Enable {
+			summary.EnabledInbounds++
+		}
+		summary.Up += inbound.Up
+		summary.Down += inbound.Down
+		for _, traffic := range inbound.ClientStats {
+			summary.Clients++
+			if traffic.Enable {
+				summary.ActiveClients++
+			}
+		}
+	}
+	if s.xrayService.IsXrayRunning() {
+		summary.OnlineClients = len(s.inboundService.GetOnlineClinets())
+	}
+	if versions != nil {
+		summary.XrayUpdate = s.GetXrayUpdateInfo(versions)
+	}
+	return summary, nil
+}
+
+func (s *ServerService) GetXrayUpdateInfo(versions []string) *XrayUpdateInfo {
+	info := &XrayUpdateInfo{
+		Installed: s.xrayService.GetXrayVersion(),
+	}
+	for _, version := range versions {
+		if info.Latest == "" || compareVersions(version, info.Latest) > 0 {
+			info.Latest = version
+		}
+	}
+	if info.Latest != "" && info.Installed != "Unknown" {
+		info.UpdateAvailable = compareVersions(info.Installed, info.Latest) < 0
+	}
+	return info
+}
+
 func (s *ServerService) StopXrayService() (string error) {
 	err := s.xrayService.StopXray()
 	if err != nil {
@@ -260,18 +496,40 @@ func (s *ServerService) StopXrayService() (string error) {
 	return nil
 }
 
+func (s *ServerService) ReloadConfig() (bool, error) {
+	return s.xrayService.ReloadConfig()
+}
+
 func (s *ServerService) RestartXrayService() (string error) {
+	start := time.Now()
 	s.xrayService.StopXray()
 	defer func() {
 		err := s.xrayService.RestartXray(true)
 		if err != nil {
 			logger.Error("start xray failed:", err)
 		}
+		go measureXrayStartup(start, err)
 	}()
 
 	return nil
 }
 
+func (s *ServerService) SetStatsService(enable bool) error {
+	inbounds, err := s.inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	inboundPorts := make([]int, 0, len(inbounds))
+	for _, inbound := range inbounds {
+		inboundPorts = append(inboundPorts, inbound.Port)
+	}
+	err = s.xraySettingService.SetStatsService(enable, inboundPorts)
+	if err != nil {
+		return err
+	}
+	return s.RestartXrayService()
+}
+
 func (s *ServerService) downloadXRay(version string) (string, error) {
 	osName := runtime.GOOS
 	arch := runtime.GOARCH
@@ -290,28 +548,49 @@ func (s *ServerService) downloadXRay(version string) (string, error) {
 
 	fileName := fmt.Sprintf("Xray-%s-%s.zip", osName, arch)
 	url := fmt.Sprintf("https://github.com/XTLS/Xray-core/releases/download/%s/%s", version, fileName)
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
 
-	os.Remove(fileName)
-	file, err := os.Create(fileName)
+	settingService := SettingService{}
+	connections, err := settingService.GetXrayDownloadConnections()
 	if err != nil {
-		return "", err
+		connections = 1
+	}
+	err = downloadFile(url, fileName, connections)
+	if err == nil {
+		err = verifyXrayDigest(url, fileName)
 	}
-	defer file.Close()
-
-	_, err = io.Copy(file, resp.Body)
 	if err != nil {
+		os.Remove(fileName)
 		return "", err
 	}
 
 	return fileName, nil
 }
 
-func (s *ServerService) UpdateXray(version string) error {
+func (s *ServerService) GetInstallProgress() InstallProgress {
+	installProgressLock.Lock()
+	defer installProgressLock.Unlock()
+	return installProgress
+}
+
+func (s *ServerService) UpdateXray(version string) (err error) {
+	setInstallProgress(func(progress *InstallProgress) {
+		*progress = InstallProgress{
+			Version: version,
+			State:   InstallDownloading,
+		}
+	})
+	defer func() {
+		setInstallProgress(func(progress *InstallProgress) {
+			if err != nil {
+				progress.State = InstallFailed
+				progress.ErrorMsg = err.Error()
+			} else {
+				progress.State = InstallCompleted
+				progress.Percent = 100
+			}
+		})
+	}()
+
 	zipFileName, err := s.downloadXRay(version)
 	if err != nil {
 		return err
@@ -335,6 +614,10 @@ func (s *ServerService) UpdateXray(version string) error {
 		return err
 	}
 
+	setInstallProgress(func(progress *InstallProgress) {
+		progress.State = InstallInstalling
+	})
+
 	s.xrayService.StopXray()
 	defer func() {
 		err := s.xrayService.RestartXray(true)
@@ -366,6 +649,52 @@ func (s *ServerService) UpdateXray(version string) error {
 	return nil
 }
 
+// FlushTraffic commits the pending counters of xray stats to the database right away
+// instead of waiting for the traffic job, it returns the number of client counters updated
+func (s *ServerService) FlushTraffic() (int, error) {
+	_, clientTraffics, err := s.xrayService.SyncTraffic()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, traffic := range clientTraffics {
+		if traffic.Up+traffic.Down > 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ResyncTraffic pulls the pending counters from xray stats into the database
+// and repairs counters which are no longer valid
+func (s *ServerService) ResyncTraffic() (*TrafficResync, error) {
+	resync := &TrafficResync{
+		Inbounds: make([]TrafficChange, 0),
+		Clients:  make([]TrafficChange, 0),
+	}
+
+	traffics, clientTraffics, err := s.xrayService.SyncTraffic()
+	if err != nil {
+		return nil, err
+	}
+	for _, traffic := range traffics {
+		if traffic.IsInbound && traffic.Up+traffic.Down > 0 {
+			resync.Inbounds = append(resync.Inbounds, TrafficChange{Name: traffic.Tag, Up: traffic.Up, Down: traffic.Down})
+		}
+	}
+	for _, traffic := range clientTraffics {
+		if traffic.Up+traffic.Down > 0 {
+			resync.Clients = append(resync.Clients, TrafficChange{Name: traffic.Email, Up: traffic.Up, Down: traffic.Down})
+		}
+	}
+
+	resync.FixedCounter, err = s.inboundService.ResetNegativeTraffics()
+	if err != nil {
+		return nil, err
+	}
+	return resync, nil
+}
+
 func (s *ServerService) GetLogs(count string, level string, syslog string) []string {
 	c, _ := strconv.Atoi(count)
 	var lines []string
@@ -381,6 +710,8 @@ func (s *ServerService) GetLogs(count string, level string, syslog string) []str
 			return []string{"Failed to run journalctl command!"}
 		}
 		lines = strings.Split(out.String(), "\n")
+	} else if syslog == "access" {
+		lines = logger.GetAccessLogs(c)
 	} else {
 		lines = logger.GetLogs(c, level)
 	}
@@ -388,6 +719,33 @@ func (s *ServerService) GetLogs(count string, level string, syslog string) []str
 	return lines
 }
 
+// ClientLogMatcher returns a function telling whether a log is an xray log line of the client with email
+func (s *ServerService) ClientLogMatcher(email string) (func(log string) bool, error) {
+	if email == "" {
+		return nil, common.NewError("email can not be empty")
+	}
+	// access log lines end with "email: <email>"
+	emailRegex, err := regexp.Compile(`email: ` + regexp.QuoteMeta(email) + `(\s|$)`)
+	if err != nil {
+		return nil, err
+	}
+	return func(log string) bool {
+		return strings.HasPrefix(log, "XRAY: ") && emailRegex.MatchString(log)
+	}, nil
+}
+
+// GetClientLogs returns the last count xray log lines of the client with email, with context lines around them
+func (s *ServerService) GetClientLogs(email string, count int, level string, context int) ([]string, error) {
+	match, err := s.ClientLogMatcher(email)
+	if err != nil {
+		return nil, err
+	}
+	if count <= 0 {
+		count = 100
+	}
+	return logger.GetLogsMatching(count, level, match, context), nil
+}
+
 func (s *ServerService) GetConfigJson() (interface{}, error) {
 	config, err := s.xrayService.GetXrayConfig()
 	if err != nil {
@@ -407,6 +765,30 @@ func (s *ServerService) GetConfigJson() (interface{}, error) {
 	return jsonData, nil
 }
 
+type DBStats struct {
+	Size   int64                `json:"size"`
+	Tables []database.TableStat `json:"tables"`
+}
+
+func (s *ServerService) GetDBStats() (*DBStats, error) {
+	err := database.Checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(config.GetDBPath())
+	if err != nil {
+		return nil, err
+	}
+	tables, err := database.GetTableStats()
+	if err != nil {
+		return nil, err
+	}
+	return &DBStats{
+		Size:   info.Size(),
+		Tables: tables,
+	}, nil
+}
+
 func (s *ServerService) GetDb() ([]byte, error) {
 	// Update by manually trigger a checkpoint operation
 	err := database.Checkpoint()
@@ -554,3 +936,21 @@ func (s *ServerService) GetNewX25519Cert() (interface{}, error) {
 
 	return keyPair, nil
 }
+
+func (s *ServerService) VerifyX25519(privateKey string, publicKey string) (bool, error) {
+	privateKeyBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(privateKey))
+	if err != nil {
+		return false, common.NewErrorf("invalid private key: %v", err)
+	}
+	publicKeyBytes, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return false, common.NewErrorf("invalid public key: %v", err)
+	}
+
+	key, err := ecdh.X25519().NewPrivateKey(privateKeyBytes)
+	if err != nil {
+		return false, common.NewErrorf("invalid private key: %v", err)
+	}
+
+	return bytes.Equal(key.PublicKey().Bytes(), publicKeyBytes), nil
+}
@@ -24,17 +24,52 @@ var xrayTemplateConfig string
 
 var defaultValueMap = map[string]string{
 	"xrayTemplateConfig": xrayTemplateConfig,
+	"subSingboxTemplate": "",
+	"inboundDefaults":    "",
 	"webListen":          "",
 	"webDomain":          "",
+	"trustedProxies":     "127.0.0.1,::1",
 	"webPort":            "54321",
 	"webCertFile":        "",
 	"webKeyFile":         "",
+	"webSelfSigned":      "false",
+	"webSelfSignedCert":  "",
+	"webSelfSignedKey":   "",
 	"secret":             random.Seq(32),
 	"webBasePath":        "/",
 	"sessionMaxAge":      "0",
+	"sessionIdleTimeout": "0",
+	"rememberMeDays":     "30",
 	"pageSize":           "0",
+	"maxUploadSize":      "100",
+	"metricsToken":       "",
+	"metricsClients":     "true",
+	"xrayWatchdog":       "true",
+	"xrayWatchdogMax":    "5",
+	"geoUpdateInterval":  "0",
+	"backupFilename":     "x-ui.db",
+	"geoUpdateSource":    "https://github.com/Loyalsoldier/v2ray-rules-dat/releases/latest/download",
+	"xrayVersionRetries": "3",
+	"xrayVersionTimeout": "10",
+	"xrayDownloadConns":  "1",
+	"panelDns":           "",
+	"panelProxy":         "",
+	"maxConcurrentReqs":  "0",
+	"loginRetention":     "30",
+	"trafficRetention":   "90",
+	"accessLogEnable":    "false",
+	"accessLogRetention": "7",
+	"inboundBind":        "",
+	"blockedLog":         "false",
+	"xrayGoGC":           "",
+	"xrayGoMemLimit":     "",
 	"expireDiff":         "0",
 	"trafficDiff":        "0",
+	"trafficAlert":       "0",
+	"trafficGrace":       "0",
+	"trialTraffic":       "1024",
+	"trialDuration":      "24",
+	"trialPerIp":         "0",
 	"remarkModel":        "-ieo",
 	"timeLocation":       "Asia/Tehran",
 	"tgBotEnable":        "false",
@@ -45,6 +80,14 @@ var defaultValueMap = map[string]string{
 	"tgBotLoginNotify":   "false",
 	"tgCpu":              "0",
 	"tgLang":             "en-US",
+	"emailEnable":        "false",
+	"smtpHost":           "",
+	"smtpPort":           "587",
+	"smtpSecurity":       "starttls",
+	"smtpUsername":       "",
+	"smtpPassword":       "",
+	"emailFrom":          "",
+	"emailTo":            "",
 	"subEnable":          "false",
 	"subListen":          "",
 	"subPort":            "2096",
@@ -61,7 +104,9 @@ var defaultValueMap = map[string]string{
 	"subJsonFragment":    "",
 	"subJsonMux":         "",
 	"subJsonRules":       "",
+	"subHeaders":         "",
 	"warp":               "",
+	"xrayInstances":      "[]",
 }
 
 type SettingService struct{}
@@ -226,6 +271,21 @@ func (s *SettingService) GetWebDomain() (string, error) {
 	return s.getString("webDomain")
 }
 
+// GetTrustedProxies returns the IPs and CIDRs whose X-Forwarded-For and X-Real-IP headers are trusted.
+func (s *SettingService) GetTrustedProxies() ([]string, error) {
+	value, err := s.getString("trustedProxies")
+	if err != nil {
+		return nil, err
+	}
+	proxies := make([]string, 0)
+	for _, proxy := range strings.Split(value, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies, nil
+}
+
 func (s *SettingService) GetTgBotToken() (string, error) {
 	return s.getString("tgBotToken")
 }
@@ -274,6 +334,38 @@ func (s *SettingService) GetTgLang() (string, error) {
 	return s.getString("tgLang")
 }
 
+func (s *SettingService) GetEmailEnable() (bool, error) {
+	return s.getBool("emailEnable")
+}
+
+func (s *SettingService) GetSmtpHost() (string, error) {
+	return s.getString("smtpHost")
+}
+
+func (s *SettingService) GetSmtpPort() (int, error) {
+	return s.getInt("smtpPort")
+}
+
+func (s *SettingService) GetSmtpSecurity() (string, error) {
+	return s.getString("smtpSecurity")
+}
+
+func (s *SettingService) GetSmtpUsername() (string, error) {
+	return s.getString("smtpUsername")
+}
+
+func (s *SettingService) GetSmtpPassword() (string, error) {
+	return s.getString("smtpPassword")
+}
+
+func (s *SettingService) GetEmailFrom() (string, error) {
+	return s.getString("emailFrom")
+}
+
+func (s *SettingService) GetEmailTo() (string, error) {
+	return s.getString("emailTo")
+}
+
 func (s *SettingService) GetPort() (int, error) {
 	return s.getInt("webPort")
 }
@@ -298,10 +390,38 @@ func (s *SettingService) GetTrafficDiff() (int, error) {
 	return s.getInt("trafficDiff")
 }
 
+func (s *SettingService) GetTrafficAlert() (int, error) {
+	return s.getInt("trafficAlert")
+}
+
+func (s *SettingService) GetTrafficGrace() (int, error) {
+	return s.getInt("trafficGrace")
+}
+
+func (s *SettingService) GetTrialTraffic() (int, error) {
+	return s.getInt("trialTraffic")
+}
+
+func (s *SettingService) GetTrialDuration() (int, error) {
+	return s.getInt("trialDuration")
+}
+
+func (s *SettingService) GetTrialPerIp() (int, error) {
+	return s.getInt("trialPerIp")
+}
+
 func (s *SettingService) GetSessionMaxAge() (int, error) {
 	return s.getInt("sessionMaxAge")
 }
 
+func (s *SettingService) GetSessionIdleTimeout() (int, error) {
+	return s.getInt("sessionIdleTimeout")
+}
+
+func (s *SettingService) GetRememberMeDays() (int, error) {
+	return s.getInt("rememberMeDays")
+}
+
 func (s *SettingService) GetRemarkModel() (string, error) {
 	return s.getString("remarkModel")
 }
@@ -393,6 +513,109 @@ func (s *SettingService) GetPageSize() (int, error) {
 	return s.getInt("pageSize")
 }
 
+func (s *SettingService) GetMaxUploadSize() (int, error) {
+	return s.getInt("maxUploadSize")
+}
+
+func (s *SettingService) GetMetricsToken() (string, error) {
+	return s.getString("metricsToken")
+}
+
+func (s *SettingService) GetMetricsClients() (bool, error) {
+	return s.getBool("metricsClients")
+}
+
+func (s *SettingService) GetXrayWatchdog() (bool, error) {
+	return s.getBool("xrayWatchdog")
+}
+
+func (s *SettingService) GetXrayWatchdogMaxAttempts() (int, error) {
+	return s.getInt("xrayWatchdogMax")
+}
+
+// GetBackupFilename returns the file name of database backups with the placeholders of the
+// template filled, x-ui.db when the template is not set or gives an invalid name
+func (s *SettingService) GetBackupFilename() string {
+	template, err := s.getString("backupFilename")
+	if err != nil || template == "" {
+		return "x-ui.db"
+	}
+	filename := common.FormatFilename(template, time.Now())
+	if !common.IsValidFilename(filename) {
+		logger.Warning("invalid backup file name, using x-ui.db:", filename)
+		return "x-ui.db"
+	}
+	return filename
+}
+
+func (s *SettingService) GetGeoUpdateInterval() (int, error) {
+	return s.getInt("geoUpdateInterval")
+}
+
+func (s *SettingService) GetGeoUpdateSource() (string, error) {
+	return s.getString("geoUpdateSource")
+}
+
+func (s *SettingService) GetXrayVersionRetries() (int, error) {
+	return s.getInt("xrayVersionRetries")
+}
+
+// GetPanelDNS returns the DoH or DoT server resolving the requests the panel makes itself
+func (s *SettingService) GetPanelDNS() (string, error) {
+	return s.getString("panelDns")
+}
+
+// GetPanelProxy returns the proxy of the requests the panel makes itself
+func (s *SettingService) GetPanelProxy() (string, error) {
+	return s.getString("panelProxy")
+}
+
+// GetXrayDownloadConnections returns the number of parallel range requests downloading an xray release
+func (s *SettingService) GetXrayDownloadConnections() (int, error) {
+	return s.getInt("xrayDownloadConns")
+}
+
+// GetXrayVersionTimeout returns the timeout of one request for the xray releases in seconds
+func (s *SettingService) GetXrayVersionTimeout() (int, error) {
+	return s.getInt("xrayVersionTimeout")
+}
+
+func (s *SettingService) GetXrayGoGC() (string, error) {
+	return s.getString("xrayGoGC")
+}
+
+func (s *SettingService) GetXrayGoMemLimit() (string, error) {
+	return s.getString("xrayGoMemLimit")
+}
+
+func (s *SettingService) GetInboundBind() (string, error) {
+	return s.getString("inboundBind")
+}
+
+func (s *SettingService) GetBlockedLog() (bool, error) {
+	return s.getBool("blockedLog")
+}
+
+func (s *SettingService) GetLoginAttemptsRetention() (int, error) {
+	return s.getInt("loginRetention")
+}
+
+func (s *SettingService) GetTrafficHistoryRetention() (int, error) {
+	return s.getInt("trafficRetention")
+}
+
+func (s *SettingService) GetAccessLogEnable() (bool, error) {
+	return s.getBool("accessLogEnable")
+}
+
+func (s *SettingService) GetAccessLogRetention() (int, error) {
+	return s.getInt("accessLogRetention")
+}
+
+func (s *SettingService) GetMaxConcurrentRequests() (int, error) {
+	return s.getInt("maxConcurrentReqs")
+}
+
 func (s *SettingService) GetSubURI() (string, error) {
 	return s.getString("subURI")
 }
@@ -413,6 +636,14 @@ func (s *SettingService) GetSubJsonRules() (string, error) {
 	return s.getString("subJsonRules")
 }
 
+func (s *SettingService) GetSubHeaders() (map[string]string, error) {
+	headers, err := s.getString("subHeaders")
+	if err != nil {
+		return nil, err
+	}
+	return entity.ParseSubHeaders(headers)
+}
+
 func (s *SettingService) GetWarp() (string, error) {
 	return s.getString("warp")
 }
@@ -421,6 +652,14 @@ func (s *SettingService) SetWarp(data string) error {
 	return s.setString("warp", data)
 }
 
+func (s *SettingService) GetXrayInstances() (string, error) {
+	return s.getString("xrayInstances")
+}
+
+func (s *SettingService) SetXrayInstances(data string) error {
+	return s.setString("xrayInstances", data)
+}
+
 func (s *SettingService) UpdateAllSetting(allSetting *entity.AllSetting) error {
 	if err := allSetting.CheckValid(); err != nil {
 		return err
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/util/random"
+	"x-ui/xray"
+)
+
+// SubGroupInfo is a subscription group with the number of clients in its group
+type SubGroupInfo struct {
+	*model.SubGroup
+	Clients int `json:"clients"`
+}
+
+func (s *InboundService) GetSubGroups() ([]*SubGroupInfo, error) {
+	db := database.GetDB()
+	var groups []*model.SubGroup
+	err := db.Model(model.SubGroup{}).Order("name").Find(&groups).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*SubGroupInfo, 0, len(groups))
+	for _, group := range groups {
+		emails, err := s.GetGroupEmails(group.Name)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, &SubGroupInfo{SubGroup: group, Clients: len(emails)})
+	}
+	return result, nil
+}
+
+func (s *InboundService) GetSubGroupBySubId(subId string) (*model.SubGroup, error) {
+	db := database.GetDB()
+	group := &model.SubGroup{}
+	err := db.Model(model.SubGroup{}).Where("sub_id = ?", subId).First(group).Error
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// AddSubGroup creates the subscription group of the client group name with a new random
+// subscription id
+func (s *InboundService) AddSubGroup(name string) (*model.SubGroup, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, common.NewError("group is empty")
+	}
+	db := database.GetDB()
+	var count int64
+	err := db.Model(model.SubGroup{}).Where("LOWER(name) = LOWER(?)", name).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, common.NewError("subscription group already exists:", name)
+	}
+	group := &model.SubGroup{Name: name, SubId: random.Seq(16)}
+	return group, db.Create(group).Error
+}
+
+// DelSubGroup removes the subscription of a group, its clients keep their group
+func (s *InboundService) DelSubGroup(id int) error {
+	db := database.GetDB()
+	return db.Delete(model.SubGroup{}, id).Error
+}
+
+// SetClientsGroup puts the clients with emails into group, an empty group takes them out of
+// the group they are in. It returns the emails that changed.
+func (s *InboundService) SetClientsGroup(emails []string, group string) (changed []string, err error) {
+	if len(emails) == 0 {
+		return nil, common.NewError("no clients given")
+	}
+	group = strings.TrimSpace(group)
+
+	db := database.GetDB()
+	tx := db.Begin()
+	defer func() {
+		if err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}()
+
+	inbounds := map[int]*model.Inbound{}
+	inboundSettings := map[int]map[string]interface{}{}
+	changed = make([]string, 0, len(emails))
+	for _, email := range emails {
+		traffic := &xray.ClientTraffic{}
+		err = tx.Model(xray.ClientTraffic{}).Where("email = ?", email).First(traffic).Error
+		if err != nil {
+			if database.IsNotFound(err) {
+				err = nil
+				continue
+			}
+			return nil, err
+		}
+
+		settings, ok := inboundSettings[traffic.InboundId]
+		if !ok {
+			inbound, err := s.GetInbound(traffic.InboundId)
+			if err != nil {
+				return nil, err
+			}
+			settings = map[string]interface{}{}
+			err = json.Unmarshal([]byte(inbound.Settings), &settings)
+			if err != nil {
+				return nil, err
+			}
+			inbounds[inbound.Id] = inbound
+			inboundSettings[inbound.Id] = settings
+		}
+
+		clients, _ := settings["clients"].([]interface{})
+		for _, client := range clients {
+			if c, ok := client.(map[string]interface{}); ok && c["email"] == email {
+				if current, _ := c["group"].(string); current != group {
+					c["group"] = group
+					changed = append(changed, email)
+				}
+			}
+		}
+	}
+
+	for id, inbound := range inbounds {
+		newSettings, err := json.MarshalIndent(inboundSettings[id], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		inbound.Settings = string(newSettings)
+		err = tx.Save(inbound).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"x-ui/util/common"
+)
+
+//go:embed singbox.json
+var singboxTemplate string
+
+// placeholders of the sing-box subscription template, SingboxOutbounds is an element of the
+// top level outbounds and is replaced by the outbounds of the clients, SingboxTags may be an
+// element of any array and is replaced by their tags
+const (
+	SingboxOutbounds = "{{outbounds}}"
+	SingboxTags      = "{{tags}}"
+)
+
+func (s *SettingService) GetDefaultSubSingboxTemplate() string {
+	return singboxTemplate
+}
+
+// GetSubSingboxTemplate returns the stored template, or the built-in one when none is set
+func (s *SettingService) GetSubSingboxTemplate() (string, error) {
+	template, err := s.getString("subSingboxTemplate")
+	if err != nil {
+		return "", err
+	}
+	if template == "" {
+		return singboxTemplate, nil
+	}
+	return template, nil
+}
+
+// SaveSubSingboxTemplate stores template, an empty template restores the built-in one
+func (s *SettingService) SaveSubSingboxTemplate(template string) error {
+	if template != "" {
+		err := CheckSingboxTemplate(template)
+		if err != nil {
+			return err
+		}
+	}
+	return s.saveSetting("subSingboxTemplate", template)
+}
+
+func CheckSingboxTemplate(template string) error {
+	config := map[string]interface{}{}
+	err := json.Unmarshal([]byte(template), &config)
+	if err != nil {
+		return common.NewError("sing-box template is not a valid json object:", err)
+	}
+	outbounds, ok := config["outbounds"].([]interface{})
+	if !ok {
+		return common.NewError("sing-box template has no outbounds array")
+	}
+	for _, outbound := range outbounds {
+		if outbound == SingboxOutbounds {
+			return nil
+		}
+	}
+	return common.NewErrorf("the outbounds of the sing-box template must contain the %q placeholder", SingboxOutbounds)
+}
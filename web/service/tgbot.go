@@ -80,7 +80,7 @@ func (t *Tgbot) Start(i18nFS embed.FS) error {
 	}
 
 	for {
-		bot, err = tgbotapi.NewBotAPI(tgBottoken)
+		bot, err = tgbotapi.NewBotAPIWithClient(tgBottoken, tgbotapi.APIEndpoint, newHTTPClient(0))
 		if err != nil {
 			fmt.Println("Get tgbot's api error:", err)
 			fmt.Println("Retrying after 10 secound...")
@@ -710,15 +710,20 @@ func (t *Tgbot) sendBackup(chatId int64) {
 	output := t.I18nBot("tgbot.messages.backupTime", "Time=="+time.Now().Format("2006-01-02 15:04:05"))
 	t.SendMsgToTgbot(chatId, output)
 
-	file := tgbotapi.FilePath(config.GetDBPath())
-	msg := tgbotapi.NewDocument(chatId, file)
-	_, err = bot.Send(msg)
+	db, err := os.Open(config.GetDBPath())
 	if err != nil {
 		logger.Warning("Error in uploading backup: ", err)
+	} else {
+		file := tgbotapi.FileReader{Name: t.settingService.GetBackupFilename(), Reader: db}
+		_, err = bot.Send(tgbotapi.NewDocument(chatId, file))
+		db.Close()
+		if err != nil {
+			logger.Warning("Error in uploading backup: ", err)
+		}
 	}
 
-	file = tgbotapi.FilePath(xray.GetConfigPath())
-	msg = tgbotapi.NewDocument(chatId, file)
+	file := tgbotapi.FilePath(xray.GetConfigPath())
+	msg := tgbotapi.NewDocument(chatId, file)
 	_, err = bot.Send(msg)
 	if err != nil {
 		logger.Warning("Error in uploading config.json: ", err)
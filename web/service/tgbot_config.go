@@ -0,0 +1,121 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"x-ui/util/common"
+	"x-ui/web/locale"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// TgConfig is the telegram bot part of the settings, for moving it between panels
+type TgConfig struct {
+	Enable      bool   `json:"enable"`
+	Token       string `json:"token"`
+	ChatId      string `json:"chatId"`
+	RunTime     string `json:"runTime"`
+	Backup      bool   `json:"backup"`
+	LoginNotify bool   `json:"loginNotify"`
+	Cpu         int    `json:"cpu"`
+	Lang        string `json:"lang"`
+	// a redacted export has no token, importing it keeps the token of the panel
+	Redacted bool `json:"redacted"`
+}
+
+func (s *SettingService) GetTgConfig(redact bool) (*TgConfig, error) {
+	var err error
+	config := &TgConfig{Redacted: redact}
+	if config.Enable, err = s.GetTgbotenabled(); err != nil {
+		return nil, err
+	}
+	if !redact {
+		if config.Token, err = s.GetTgBotToken(); err != nil {
+			return nil, err
+		}
+	}
+	if config.ChatId, err = s.GetTgBotChatId(); err != nil {
+		return nil, err
+	}
+	if config.RunTime, err = s.GetTgbotRuntime(); err != nil {
+		return nil, err
+	}
+	if config.Backup, err = s.GetTgBotBackup(); err != nil {
+		return nil, err
+	}
+	if config.LoginNotify, err = s.GetTgBotLoginNotify(); err != nil {
+		return nil, err
+	}
+	if config.Cpu, err = s.GetTgCpu(); err != nil {
+		return nil, err
+	}
+	if config.Lang, err = s.GetTgLang(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SetTgConfig validates config, checks the token with getMe and saves it,
+// the bot picks it up when the panel restarts
+func (s *SettingService) SetTgConfig(config *TgConfig) error {
+	token := strings.TrimSpace(config.Token)
+	if token == "" {
+		if !config.Redacted {
+			return common.NewError("telegram bot token can not be empty")
+		}
+		var err error
+		if token, err = s.GetTgBotToken(); err != nil {
+			return err
+		}
+	}
+	chatIds := make([]string, 0)
+	for _, chatId := range strings.Split(config.ChatId, ",") {
+		chatId = strings.TrimSpace(chatId)
+		if chatId == "" {
+			continue
+		}
+		if _, err := strconv.ParseInt(chatId, 10, 64); err != nil {
+			return common.NewError("invalid telegram chat id:", chatId)
+		}
+		chatIds = append(chatIds, chatId)
+	}
+	if _, err := cronParser.Parse(config.RunTime); err != nil {
+		return common.NewError("invalid telegram report schedule:", config.RunTime, err)
+	}
+	if config.Cpu < 0 || config.Cpu > 100 {
+		return common.NewError("telegram cpu threshold must be between 0 and 100:", config.Cpu)
+	}
+	if !locale.IsSupported(config.Lang) {
+		return common.NewError("unsupported telegram bot language:", config.Lang)
+	}
+	if config.Enable && token == "" {
+		return common.NewError("the telegram bot can not be enabled without a token")
+	}
+	if token != "" {
+		// NewBotAPI calls getMe
+		client := newHTTPClient(10 * time.Second)
+		_, err := tgbotapi.NewBotAPIWithClient(token, tgbotapi.APIEndpoint, client)
+		if err != nil {
+			return common.NewError("telegram bot token check failed:", err)
+		}
+	}
+
+	values := map[string]string{
+		"tgBotEnable":      strconv.FormatBool(config.Enable),
+		"tgBotToken":       token,
+		"tgBotChatId":      strings.Join(chatIds, ","),
+		"tgRunTime":        config.RunTime,
+		"tgBotBackup":      strconv.FormatBool(config.Backup),
+		"tgBotLoginNotify": strconv.FormatBool(config.LoginNotify),
+		"tgCpu":            strconv.Itoa(config.Cpu),
+		"tgLang":           config.Lang,
+	}
+	for key, value := range values {
+		if err := s.saveSetting(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
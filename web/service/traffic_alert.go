@@ -0,0 +1,179 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+
+	"x-ui/database"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// CheckTrafficAlerts notifies once when a client with a traffic limit passes its alert percent,
+// its own one or else the global one. The alert fires again after the usage dropped below the
+// percent, which happens when the traffic is reset or the limit raised.
+func (s *InboundService) CheckTrafficAlerts() error {
+	globalPercent, err := s.settingService.GetTrafficAlert()
+	if err != nil {
+		return err
+	}
+	globalGrace, err := s.settingService.GetTrafficGrace()
+	if err != nil {
+		return err
+	}
+	inbounds, err := s.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+
+	alerts := make([]string, 0)
+	firedIds := make([]int, 0)
+	clearedIds := make([]int, 0)
+	graceIds := make([]int, 0)
+	graceClearedIds := make([]int, 0)
+	for _, inbound := range inbounds {
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		percents := make(map[string]int, len(clients))
+		tgIds := make(map[string]string, len(clients))
+		for _, client := range clients {
+			percents[client.Email] = client.TrafficAlert
+			tgIds[client.Email] = client.TgID
+		}
+		for _, traffic := range inbound.ClientStats {
+			percent := percents[traffic.Email]
+			if percent <= 0 {
+				percent = globalPercent
+			}
+			reached := percent > 0 && traffic.Total > 0 && (traffic.Up+traffic.Down)*100 >= traffic.Total*int64(percent)
+			switch {
+			case reached && !traffic.Alerted:
+				firedIds = append(firedIds, traffic.Id)
+				alerts = append(alerts, s.notifyTrafficAlert(traffic, tgIds[traffic.Email]))
+			case !reached && traffic.Alerted:
+				clearedIds = append(clearedIds, traffic.Id)
+			}
+
+			grace := traffic.TrafficGrace
+			if grace <= 0 {
+				grace = globalGrace
+			}
+			capped := traffic.Total > 0 && traffic.Up+traffic.Down >= traffic.Total
+			switch {
+			case capped && grace > 0 && traffic.Enable && !traffic.GraceNotified:
+				graceIds = append(graceIds, traffic.Id)
+				alerts = append(alerts, s.notifyTrafficGrace(traffic, grace, tgIds[traffic.Email]))
+			case !capped && traffic.GraceNotified:
+				graceClearedIds = append(graceClearedIds, traffic.Id)
+			}
+		}
+	}
+
+	db := database.GetDB()
+	if len(firedIds) > 0 {
+		err = db.Model(xray.ClientTraffic{}).Where("id IN ?", firedIds).Update("alerted", true).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(clearedIds) > 0 {
+		err = db.Model(xray.ClientTraffic{}).Where("id IN ?", clearedIds).Update("alerted", false).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(graceIds) > 0 {
+		err = db.Model(xray.ClientTraffic{}).Where("id IN ?", graceIds).Update("grace_notified", true).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(graceClearedIds) > 0 {
+		err = db.Model(xray.ClientTraffic{}).Where("id IN ?", graceClearedIds).Update("grace_notified", false).Error
+		if err != nil {
+			return err
+		}
+	}
+	if len(alerts) > 0 {
+		emailService := EmailService{}
+		emailService.Notify("Traffic alert", strings.Join(alerts, "\r\n\r\n"))
+	}
+	return nil
+}
+
+// notifyTrafficAlert sends the alert of a client to the telegram admins and the linked chat of
+// the client, it returns the message for the email summary
+func (s *InboundService) notifyTrafficAlert(traffic xray.ClientTraffic, tgId string) string {
+	tgbot := Tgbot{}
+	used := traffic.Up + traffic.Down
+	msg := tgbot.I18nBot("tgbot.messages.trafficAlert",
+		"Email=="+traffic.Email,
+		"Percent=="+strconv.FormatInt(used*100/traffic.Total, 10),
+		"Used=="+common.FormatTraffic(used),
+		"Total=="+common.FormatTraffic(traffic.Total))
+	logger.Info("traffic alert of", traffic.Email)
+	if tgbot.IsRunning() {
+		tgbot.SendMsgToTgbotAdmins(msg)
+		if chatId, err := strconv.ParseInt(tgId, 10, 64); err == nil {
+			go tgbot.SendMsgToTgbot(chatId, msg)
+		}
+	}
+	return msg
+}
+
+// notifyTrafficGrace tells that a client reached its traffic limit and keeps working for its
+// grace, it returns the message for the email summary
+func (s *InboundService) notifyTrafficGrace(traffic xray.ClientTraffic, grace int, tgId string) string {
+	tgbot := Tgbot{}
+	msg := tgbot.I18nBot("tgbot.messages.trafficGrace",
+		"Email=="+traffic.Email,
+		"Total=="+common.FormatTraffic(traffic.Total),
+		"Grace=="+common.FormatTraffic(traffic.Total*int64(grace)/100))
+	logger.Info("traffic limit reached with grace by", traffic.Email)
+	if tgbot.IsRunning() {
+		tgbot.SendMsgToTgbotAdmins(msg)
+		if chatId, err := strconv.ParseInt(tgId, 10, 64); err == nil {
+			go tgbot.SendMsgToTgbot(chatId, msg)
+		}
+	}
+	return msg
+}
+
+// notifyTrafficCutoffs tells that clients used up their grace and were disabled
+func (s *InboundService) notifyTrafficCutoffs(traffics []xray.ClientTraffic) {
+	tgbot := Tgbot{}
+	msgs := make([]string, 0, len(traffics))
+	for _, traffic := range traffics {
+		msg := tgbot.I18nBot("tgbot.messages.trafficCutoff",
+			"Email=="+traffic.Email,
+			"Used=="+common.FormatTraffic(traffic.Up+traffic.Down),
+			"Total=="+common.FormatTraffic(traffic.Total))
+		logger.Info("traffic grace used up by", traffic.Email)
+		msgs = append(msgs, msg)
+		if !tgbot.IsRunning() {
+			continue
+		}
+		tgbot.SendMsgToTgbotAdmins(msg)
+		inbound, err := s.GetInbound(traffic.InboundId)
+		if err != nil {
+			continue
+		}
+		clients, err := s.GetClients(inbound)
+		if err != nil {
+			continue
+		}
+		for _, client := range clients {
+			if client.Email != traffic.Email {
+				continue
+			}
+			if chatId, err := strconv.ParseInt(client.TgID, 10, 64); err == nil {
+				tgbot.SendMsgToTgbot(chatId, msg)
+			}
+		}
+	}
+	emailService := EmailService{}
+	emailService.Notify("Traffic cutoff", strings.Join(msgs, "\r\n\r\n"))
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	"x-ui/database"
+	"x-ui/database/model"
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"gorm.io/gorm"
+)
+
+// TrafficTotal is the traffic of the buckets in From to To, unix milliseconds
+type TrafficTotal struct {
+	From      int64  `json:"from"`
+	To        int64  `json:"to"`
+	Email     string `json:"email,omitempty"`
+	InboundId int    `json:"inboundId,omitempty"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+	Total     int64  `json:"total"`
+}
+
+// trafficBucketSize is the length of a traffic bucket. Every time zone is offset from UTC by
+// a multiple of it, so the buckets start on the local hours and half hours too.
+const trafficBucketSize = 15 * time.Minute
+
+// trafficBucketTime returns the start of the bucket holding t
+func trafficBucketTime(t time.Time) int64 {
+	return t.Truncate(trafficBucketSize).UnixMilli()
+}
+
+// trafficBucketCeil returns the start of the first bucket starting at or after t, unix milliseconds
+func trafficBucketCeil(t int64) int64 {
+	bucket := trafficBucketTime(time.UnixMilli(t))
+	if bucket < t {
+		bucket += trafficBucketSize.Milliseconds()
+	}
+	return bucket
+}
+
+// ParseTrafficTime parses a bound of a traffic range given as unix milliseconds or as a date
+// like 2006-01-02, which starts at midnight in the time location of the panel
+func ParseTrafficTime(value string) (int64, error) {
+	if t, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return t, nil
+	}
+	settingService := SettingService{}
+	location, err := settingService.GetTimeLocation()
+	if err != nil {
+		return 0, err
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, location)
+	if err != nil {
+		return 0, common.NewErrorf("invalid time %q, it must be unix milliseconds or a date like 2006-01-02", value)
+	}
+	return date.UnixMilli(), nil
+}
+
+func addTrafficBucket(tx *gorm.DB, bucketTime int64, inboundId int, email string, up int64, down int64) error {
+	result := tx.Model(model.TrafficBucket{}).
+		Where("time = ? AND inbound_id = ? AND email = ?", bucketTime, inboundId, email).
+		Updates(map[string]interface{}{
+			"up":   gorm.Expr("up + ?", up),
+			"down": gorm.Expr("down + ?", down),
+		})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	return tx.Create(&model.TrafficBucket{Time: bucketTime, InboundId: inboundId, Email: email, Up: up, Down: down}).Error
+}
+
+// addTrafficHistory adds the traffic read from xray to the current buckets. The buckets
+// keep what was used rather than the counters, so resetting a counter does not change the history.
+func (s *InboundService) addTrafficHistory(tx *gorm.DB, inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) error {
+	bucketTime := trafficBucketTime(time.Now())
+
+	tags := make([]string, 0, len(inboundTraffics))
+	for _, traffic := range inboundTraffics {
+		if traffic.IsInbound && traffic.Up+traffic.Down > 0 {
+			tags = append(tags, traffic.Tag)
+		}
+	}
+	if len(tags) > 0 {
+		var inbounds []*model.Inbound
+		err := tx.Model(model.Inbound{}).Select("id", "tag").Where("tag IN ?", tags).Find(&inbounds).Error
+		if err != nil {
+			return err
+		}
+		inboundIds := make(map[string]int, len(inbounds))
+		for _, inbound := range inbounds {
+			inboundIds[inbound.Tag] = inbound.Id
+		}
+		for _, traffic := range inboundTraffics {
+			if id, ok := inboundIds[traffic.Tag]; ok && traffic.IsInbound && traffic.Up+traffic.Down > 0 {
+				err = addTrafficBucket(tx, bucketTime, id, "", traffic.Up, traffic.Down)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	emails := make([]string, 0, len(clientTraffics))
+	for _, traffic := range clientTraffics {
+		if traffic.Up+traffic.Down > 0 {
+			emails = append(emails, traffic.Email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+	var dbTraffics []*xray.ClientTraffic
+	err := tx.Model(xray.ClientTraffic{}).Select("email", "inbound_id").Where("email IN ?", emails).Find(&dbTraffics).Error
+	if err != nil {
+		return err
+	}
+	clientInbounds := make(map[string]int, len(dbTraffics))
+	for _, traffic := range dbTraffics {
+		clientInbounds[traffic.Email] = traffic.InboundId
+	}
+	for _, traffic := range clientTraffics {
+		if id, ok := clientInbounds[traffic.Email]; ok && traffic.Up+traffic.Down > 0 {
+			err = addTrafficBucket(tx, bucketTime, id, traffic.Email, traffic.Up, traffic.Down)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetTrafficTotal sums the traffic used from from to to, unix milliseconds, of the client with
+// email or, without an email, of the inbound with inboundId or of all inbounds. The history is kept
+// in buckets of 15 minutes, so both ends are rounded up to the start of a bucket and the range
+// covers the buckets starting in it. The rounded range is returned.
+func (s *InboundService) GetTrafficTotal(from int64, to int64, email string, inboundId int) (*TrafficTotal, error) {
+	if from < 0 || to <= from {
+		return nil, common.NewErrorf("invalid time range: %v to %v", from, to)
+	}
+	from = trafficBucketCeil(from)
+	to = trafficBucketCeil(to)
+	if to <= from {
+		return nil, common.NewError("time range is shorter than the traffic history buckets of 15 minutes")
+	}
+
+	db := database.GetDB()
+	query := db.Model(model.TrafficBucket{}).Where("time >= ? AND time < ?", from, to)
+	if email != "" {
+		query = query.Where("email = ?", email)
+	} else {
+		query = query.Where("email = ?", "")
+	}
+	if inboundId > 0 {
+		query = query.Where("inbound_id = ?", inboundId)
+	}
+	total := &TrafficTotal{From: from, To: to, Email: email, InboundId: inboundId}
+	err := query.Select("COALESCE(SUM(up), 0) AS up, COALESCE(SUM(down), 0) AS down").Row().Scan(&total.Up, &total.Down)
+	if err != nil {
+		return nil, err
+	}
+	total.Total = total.Up + total.Down
+	return total, nil
+}
+
+func (s *InboundService) DelTrafficHistoryBefore(before int64) (int64, error) {
+	db := database.GetDB()
+	result := db.Where("time < ?", before).Delete(model.TrafficBucket{})
+	return result.RowsAffected, result.Error
+}
+
+// InactiveClient is a client without traffic in the asked window, LastActive is the start of the
+// last bucket it used traffic in, 0 when the history has none
+type InactiveClient struct {
+	Email      string `json:"email"`
+	InboundId  int    `json:"inboundId"`
+	Enable     bool   `json:"enable"`
+	ExpiryTime int64  `json:"expiryTime"`
+	LastActive int64  `json:"lastActive"`
+}
+
+// GetInactiveClients returns the clients of all inbounds that used no traffic in the last days.
+// The history is only kept for the retention days and starts when it was first recorded, so the
+// start of the history is returned too: a client is only known to be inactive since then.
+func (s *InboundService) GetInactiveClients(days int) ([]*InactiveClient, int64, error) {
+	if days <= 0 {
+		return nil, 0, common.NewError("days must be positive")
+	}
+	settingService := SettingService{}
+	retention, err := settingService.GetTrafficHistoryRetention()
+	if err != nil {
+		return nil, 0, err
+	}
+	if retention > 0 && days > retention {
+		return nil, 0, common.NewErrorf("traffic history is only kept for %v days", retention)
+	}
+	since := time.Now().AddDate(0, 0, -days).UnixMilli()
+
+	db := database.GetDB()
+	var historyFrom int64
+	err = db.Model(model.TrafficBucket{}).Select("COALESCE(MIN(time), 0)").Row().Scan(&historyFrom)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lastActive []struct {
+		Email string
+		Time  int64
+	}
+	err = db.Model(model.TrafficBucket{}).
+		Select("email, MAX(time) AS time").
+		Where("email != ? AND up + down > 0", "").
+		Group("email").
+		Scan(&lastActive).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	lastActiveTimes := make(map[string]int64, len(lastActive))
+	for _, active := range lastActive {
+		lastActiveTimes[active.Email] = active.Time
+	}
+
+	var traffics []*xray.ClientTraffic
+	err = db.Model(xray.ClientTraffic{}).Order("inbound_id, email").Find(&traffics).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	clients := make([]*InactiveClient, 0)
+	for _, traffic := range traffics {
+		last := lastActiveTimes[traffic.Email]
+		// a bucket holds the traffic until its end
+		if last+trafficBucketSize.Milliseconds() > since {
+			continue
+		}
+		clients = append(clients, &InactiveClient{
+			Email:      traffic.Email,
+			InboundId:  traffic.InboundId,
+			Enable:     traffic.Enable,
+			ExpiryTime: traffic.ExpiryTime,
+			LastActive: last,
+		})
+	}
+	return clients, historyFrom, nil
+}
@@ -3,9 +3,13 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"sort"
+	"strconv"
 	"sync"
 
 	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/util/json_util"
 	"x-ui/xray"
 
 	"go.uber.org/atomic"
@@ -16,6 +20,8 @@ var (
 	lock              sync.Mutex
 	isNeedXrayRestart atomic.Bool
 	result            string
+	// set by StopXray, so the watchdog does not take a stop for a crash
+	isXrayStopped atomic.Bool
 )
 
 type XrayService struct {
@@ -28,6 +34,20 @@ func (s *XrayService) IsXrayRunning() bool {
 	return p != nil && p.IsRunning()
 }
 
+// IsXrayStopped tells whether xray was stopped on purpose and not started since
+func (s *XrayService) IsXrayStopped() bool {
+	return isXrayStopped.Load()
+}
+
+func (s *XrayService) GetXrayUptime() uint64 {
+	lock.Lock()
+	defer lock.Unlock()
+	if p == nil || !p.IsRunning() {
+		return 0
+	}
+	return p.GetUptime()
+}
+
 func (s *XrayService) GetXrayErr() error {
 	if p == nil {
 		return nil
@@ -49,6 +69,14 @@ func (s *XrayService) GetXrayResult() string {
 	return result
 }
 
+func (s *XrayService) IsStatsEnabled() bool {
+	if p == nil || p.GetConfig() == nil {
+		return false
+	}
+	stats := string(p.GetConfig().Stats)
+	return stats != "" && stats != "null" && p.GetAPIPort() > 0
+}
+
 func (s *XrayService) GetXrayVersion() string {
 	if p == nil {
 		return "Unknown"
@@ -78,14 +106,38 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	// emails of clients which prefer a specific outbound, grouped by outbound tag
+	clientOutbounds := map[string][]string{}
+	// policy levels of the inbound idle timeouts, keyed by timeout
+	connIdleLevels := map[int]int{}
+	inboundBind, err := s.settingService.GetInboundBind()
+	if err != nil {
+		return nil, err
+	}
 	for _, inbound := range inbounds {
 		if !inbound.Enable {
 			continue
 		}
+		level := 0
+		if inbound.ConnIdle > 0 {
+			level = connIdleLevels[inbound.ConnIdle]
+			if level == 0 {
+				level = connIdleLevelBase + len(connIdleLevels)
+				connIdleLevels[inbound.ConnIdle] = level
+			}
+		}
 		// get settings clients
 		settings := map[string]interface{}{}
 		json.Unmarshal([]byte(inbound.Settings), &settings)
 		clients, ok := settings["clients"].([]interface{})
+		if !ok && level > 0 {
+			settings["userLevel"] = level
+			modifiedSettings, err := json.MarshalIndent(settings, "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			inbound.Settings = string(modifiedSettings)
+		}
 		if ok {
 			// check users active or not
 			clientStats := inbound.ClientStats
@@ -113,6 +165,11 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 						continue
 					}
 				}
+				if outbound, ok := c["outbound"].(string); ok && outbound != "" {
+					if email, ok := c["email"].(string); ok && email != "" {
+						clientOutbounds[outbound] = append(clientOutbounds[outbound], email)
+					}
+				}
 				for key := range c {
 					if key != "email" && key != "id" && key != "password" && key != "flow" && key != "method" {
 						delete(c, key)
@@ -121,6 +178,9 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 						c["flow"] = "xtls-rprx-vision"
 					}
 				}
+				if level > 0 {
+					c["level"] = level
+				}
 				final_clients = append(final_clients, interface{}(c))
 			}
 
@@ -158,12 +218,119 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 			inbound.StreamSettings = string(newStream)
 		}
 
+		inbound.Listen = bindListen(inbound.Listen, inboundBind)
 		inboundConfig := inbound.GenXrayInboundConfig()
 		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
 	}
+
+	if len(clientOutbounds) > 0 {
+		xrayConfig.RouterConfig, err = s.addClientRoutingRules(xrayConfig.RouterConfig, xrayConfig.OutboundConfigs, clientOutbounds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(connIdleLevels) > 0 {
+		xrayConfig.Policy, err = s.addConnIdleLevels(xrayConfig.Policy, connIdleLevels)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if blockedLog, err := s.settingService.GetBlockedLog(); err == nil && blockedLog {
+		xrayConfig.LogConfig, err = s.enableAccessLog(xrayConfig.LogConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return xrayConfig, nil
 }
 
+// inbounds with an idle timeout get policy levels from this one upwards,
+// lower levels are left to the template
+const connIdleLevelBase = 100
+
+// addConnIdleLevels adds a policy level per inbound idle timeout. The levels copy
+// level 0 of the template, so user stats keep working, and only override connIdle.
+func (s *XrayService) addConnIdleLevels(policyConfig json_util.RawMessage, connIdleLevels map[int]int) (json_util.RawMessage, error) {
+	policy := map[string]interface{}{}
+	if len(policyConfig) > 0 {
+		err := json.Unmarshal(policyConfig, &policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	levels, _ := policy["levels"].(map[string]interface{})
+	if levels == nil {
+		levels = map[string]interface{}{}
+	}
+	level0, _ := levels["0"].(map[string]interface{})
+	for connIdle, level := range connIdleLevels {
+		newLevel := map[string]interface{}{}
+		for key, value := range level0 {
+			newLevel[key] = value
+		}
+		newLevel["connIdle"] = connIdle
+		levels[strconv.Itoa(level)] = newLevel
+	}
+	policy["levels"] = levels
+	return json.MarshalIndent(policy, "", "  ")
+}
+
+// addClientRoutingRules puts a rule per preferred outbound after the last rule routing to a
+// blackhole outbound, so a preferred outbound can not get around the blocking rules
+func (s *XrayService) addClientRoutingRules(routerConfig json_util.RawMessage, outboundConfigs json_util.RawMessage, clientOutbounds map[string][]string) (json_util.RawMessage, error) {
+	routing := map[string]interface{}{}
+	if len(routerConfig) > 0 {
+		err := json.Unmarshal(routerConfig, &routing)
+		if err != nil {
+			return nil, err
+		}
+	}
+	rules, _ := routing["rules"].([]interface{})
+
+	var outbounds []map[string]interface{}
+	if len(outboundConfigs) > 0 {
+		err := json.Unmarshal(outboundConfigs, &outbounds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	blackholes := map[string]bool{}
+	for _, outbound := range outbounds {
+		if protocol, _ := outbound["protocol"].(string); protocol == "blackhole" {
+			tag, _ := outbound["tag"].(string)
+			blackholes[tag] = true
+		}
+	}
+	insertAt := 0
+	for i, rule := range rules {
+		rule, _ := rule.(map[string]interface{})
+		if tag, ok := rule["outboundTag"].(string); ok && blackholes[tag] {
+			insertAt = i + 1
+		}
+	}
+
+	tags := make([]string, 0, len(clientOutbounds))
+	for tag := range clientOutbounds {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	clientRules := make([]interface{}, 0, len(tags))
+	for _, tag := range tags {
+		clientRules = append(clientRules, map[string]interface{}{
+			"type":        "field",
+			"user":        clientOutbounds[tag],
+			"outboundTag": tag,
+		})
+	}
+	newRules := make([]interface{}, 0, len(rules)+len(clientRules))
+	newRules = append(newRules, rules[:insertAt]...)
+	newRules = append(newRules, clientRules...)
+	routing["rules"] = append(newRules, rules[insertAt:]...)
+
+	return json.MarshalIndent(routing, "", "  ")
+}
+
 func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, []*xray.ClientTraffic, error) {
 	if !s.IsXrayRunning() {
 		return nil, nil, errors.New("xray is not running")
@@ -173,6 +340,32 @@ func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, []*xray.ClientTraffic,
 	return s.xrayAPI.GetTraffic(true)
 }
 
+// SyncTraffic moves the pending counters of xray stats into the database and asks for a
+// restart when clients got disabled by it, returning the counters moved
+func (s *XrayService) SyncTraffic() ([]*xray.Traffic, []*xray.ClientTraffic, error) {
+	traffics, clientTraffics, err := s.GetXrayTraffic()
+	if err != nil {
+		return nil, nil, common.NewError("get xray traffic failed:", err)
+	}
+	// stats are reset after xray restarts, so a negative value is never added
+	for _, traffic := range traffics {
+		traffic.Up = max(traffic.Up, 0)
+		traffic.Down = max(traffic.Down, 0)
+	}
+	for _, traffic := range clientTraffics {
+		traffic.Up = max(traffic.Up, 0)
+		traffic.Down = max(traffic.Down, 0)
+	}
+	err, needRestart := s.inboundService.AddTraffic(traffics, clientTraffics)
+	if needRestart {
+		s.SetToNeedRestart()
+	}
+	if err != nil {
+		return nil, nil, common.NewError("add traffic failed:", err)
+	}
+	return traffics, clientTraffics, nil
+}
+
 func (s *XrayService) RestartXray(isForce bool) error {
 	lock.Lock()
 	defer lock.Unlock()
@@ -192,7 +385,14 @@ func (s *XrayService) RestartXray(isForce bool) error {
 	}
 
 	p = xray.NewProcess(xrayConfig)
+	memTuning, err := s.settingService.GetXrayMemTuning()
+	if err != nil {
+		return err
+	}
+	p.SetEnv(memTuning.Env())
 	result = ""
+	isXrayStopped.Store(false)
+	s.captureBlockedLog(xrayConfig)
 	err = p.Start()
 	if err != nil {
 		return err
@@ -200,11 +400,101 @@ func (s *XrayService) RestartXray(isForce bool) error {
 	return nil
 }
 
+// hotReload applies inbound changes of the new config through the xray api without restarting it.
+// It reports false when the running core can not be reloaded this way.
+func (s *XrayService) hotReload() (bool, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if p == nil || !p.IsRunning() || p.GetAPIPort() == 0 {
+		return false, nil
+	}
+	xrayConfig, err := s.GetXrayConfig()
+	if err != nil {
+		return false, err
+	}
+	oldConfig := p.GetConfig()
+	if !oldConfig.EqualsExceptInbounds(xrayConfig) {
+		return false, nil
+	}
+
+	oldInbounds := make(map[string]*xray.InboundConfig, len(oldConfig.InboundConfigs))
+	for i := range oldConfig.InboundConfigs {
+		oldInbounds[oldConfig.InboundConfigs[i].Tag] = &oldConfig.InboundConfigs[i]
+	}
+	newInbounds := make(map[string]*xray.InboundConfig, len(xrayConfig.InboundConfigs))
+	for i := range xrayConfig.InboundConfigs {
+		newInbounds[xrayConfig.InboundConfigs[i].Tag] = &xrayConfig.InboundConfigs[i]
+	}
+
+	removed := make([]string, 0)
+	for tag, oldInbound := range oldInbounds {
+		newInbound, ok := newInbounds[tag]
+		if !ok || !oldInbound.Equals(newInbound) {
+			removed = append(removed, tag)
+		}
+	}
+	added := make([]*xray.InboundConfig, 0)
+	for tag, newInbound := range newInbounds {
+		oldInbound, ok := oldInbounds[tag]
+		if !ok || !oldInbound.Equals(newInbound) {
+			added = append(added, newInbound)
+		}
+	}
+	for _, tag := range removed {
+		// the api inbound can not be replaced through itself
+		if tag == "api" {
+			return false, nil
+		}
+	}
+
+	err = s.xrayAPI.Init(p.GetAPIPort())
+	if err != nil {
+		return false, err
+	}
+	defer s.xrayAPI.Close()
+	for _, tag := range removed {
+		err = s.xrayAPI.DelInbound(tag)
+		if err != nil {
+			return false, err
+		}
+		logger.Debug("Inbound removed by api:", tag)
+	}
+	for _, inbound := range added {
+		inboundJson, err := json.MarshalIndent(inbound, "", "  ")
+		if err != nil {
+			return false, err
+		}
+		err = s.xrayAPI.AddInbound(inboundJson)
+		if err != nil {
+			return false, err
+		}
+		logger.Debug("Inbound added by api:", inbound.Tag)
+	}
+
+	return true, p.SetConfig(xrayConfig)
+}
+
+// ReloadConfig applies the current config to xray, through the api when only inbounds
+// have changed so existing connections are kept, otherwise by a full restart.
+// It reports whether a hot reload was done.
+func (s *XrayService) ReloadConfig() (bool, error) {
+	hot, err := s.hotReload()
+	if err != nil {
+		logger.Warning("hot reload of xray config failed, restarting xray:", err)
+	}
+	if hot && err == nil {
+		return true, nil
+	}
+	return false, s.RestartXray(true)
+}
+
 func (s *XrayService) StopXray() error {
 	lock.Lock()
 	defer lock.Unlock()
 	logger.Debug("stop xray")
 	if s.IsXrayRunning() {
+		isXrayStopped.Store(true)
 		return p.Stop()
 	}
 	return errors.New("xray is not running")
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"x-ui/util/common"
+)
+
+type BalancerConfig struct {
+	Tag         string   `json:"tag"`
+	Selector    []string `json:"selector"`
+	Strategy    string   `json:"strategy"`
+	FallbackTag string   `json:"fallbackTag"`
+}
+
+type ObservatoryConfig struct {
+	SubjectSelector   []string `json:"subjectSelector"`
+	ProbeURL          string   `json:"probeURL"`
+	ProbeInterval     string   `json:"probeInterval"`
+	EnableConcurrency bool     `json:"enableConcurrency"`
+}
+
+// BalancerSetting is the balancers of the routing and the observatory of the xray template,
+// no balancers and a nil observatory leave both out of the config
+type BalancerSetting struct {
+	Balancers   []BalancerConfig   `json:"balancers"`
+	Observatory *ObservatoryConfig `json:"observatory"`
+}
+
+var balancerStrategies = []string{"random", "roundRobin", "leastPing", "leastLoad"}
+
+func (b *BalancerSetting) CheckValid(outboundTags []string, hasBurstObservatory bool) error {
+	matchesOutbound := func(selector string) bool {
+		for _, tag := range outboundTags {
+			// xray selectors match outbound tags by prefix
+			if strings.HasPrefix(tag, selector) {
+				return true
+			}
+		}
+		return false
+	}
+
+	tags := map[string]bool{}
+	for _, balancer := range b.Balancers {
+		if balancer.Tag == "" {
+			return common.NewError("balancer tag can not be empty")
+		}
+		if tags[balancer.Tag] {
+			return common.NewError("duplicate balancer tag:", balancer.Tag)
+		}
+		tags[balancer.Tag] = true
+		if len(balancer.Selector) == 0 {
+			return common.NewError("balancer has no selector:", balancer.Tag)
+		}
+		for _, selector := range balancer.Selector {
+			if selector == "" || !matchesOutbound(selector) {
+				return common.NewErrorf("selector %q of balancer %s matches no outbound", selector, balancer.Tag)
+			}
+		}
+		if !slices.Contains(balancerStrategies, balancer.Strategy) {
+			return common.NewErrorf("unknown strategy %q of balancer %s", balancer.Strategy, balancer.Tag)
+		}
+		if balancer.Strategy == "leastPing" && b.Observatory == nil && !hasBurstObservatory {
+			return common.NewError("leastPing needs the observatory, balancer:", balancer.Tag)
+		}
+		if balancer.Strategy == "leastLoad" && !hasBurstObservatory {
+			return common.NewError("leastLoad needs a burst observatory in the xray template, balancer:", balancer.Tag)
+		}
+		if balancer.FallbackTag != "" && !slices.Contains(outboundTags, balancer.FallbackTag) {
+			return common.NewErrorf("fallback outbound %q of balancer %s does not exist", balancer.FallbackTag, balancer.Tag)
+		}
+	}
+
+	if o := b.Observatory; o != nil {
+		if len(o.SubjectSelector) == 0 {
+			return common.NewError("observatory has no subject selector")
+		}
+		for _, selector := range o.SubjectSelector {
+			if selector == "" || !matchesOutbound(selector) {
+				return common.NewErrorf("observatory selector %q matches no outbound", selector)
+			}
+		}
+		u, err := url.Parse(o.ProbeURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.NewError("observatory probe url must be an http(s) url:", o.ProbeURL)
+		}
+		interval, err := time.ParseDuration(o.ProbeInterval)
+		if err != nil || interval < time.Second {
+			return common.NewError("observatory probe interval must be a duration of 1s or more:", o.ProbeInterval)
+		}
+	}
+	return nil
+}
+
+func templateOutboundTags(config map[string]interface{}) []string {
+	tags := make([]string, 0)
+	outbounds, _ := config["outbounds"].([]interface{})
+	for _, outbound := range outbounds {
+		if outbound, ok := outbound.(map[string]interface{}); ok {
+			if tag, ok := outbound["tag"].(string); ok && tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func (s *XraySettingService) GetBalancerSetting() (*BalancerSetting, error) {
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return nil, err
+	}
+	setting := &BalancerSetting{Balancers: make([]BalancerConfig, 0)}
+	routing, _ := config["routing"].(map[string]interface{})
+	balancers, _ := routing["balancers"].([]interface{})
+	for _, balancer := range balancers {
+		balancer, ok := balancer.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		b := BalancerConfig{Selector: make([]string, 0), Strategy: "random"}
+		b.Tag, _ = balancer["tag"].(string)
+		b.FallbackTag, _ = balancer["fallbackTag"].(string)
+		selectors, _ := balancer["selector"].([]interface{})
+		for _, selector := range selectors {
+			if selector, ok := selector.(string); ok {
+				b.Selector = append(b.Selector, selector)
+			}
+		}
+		if strategy, ok := balancer["strategy"].(map[string]interface{}); ok {
+			if strategyType, ok := strategy["type"].(string); ok && strategyType != "" {
+				b.Strategy = strategyType
+			}
+		}
+		setting.Balancers = append(setting.Balancers, b)
+	}
+
+	if observatory, ok := config["observatory"].(map[string]interface{}); ok {
+		o := &ObservatoryConfig{SubjectSelector: make([]string, 0)}
+		selectors, _ := observatory["subjectSelector"].([]interface{})
+		for _, selector := range selectors {
+			if selector, ok := selector.(string); ok {
+				o.SubjectSelector = append(o.SubjectSelector, selector)
+			}
+		}
+		o.ProbeURL, _ = observatory["probeURL"].(string)
+		o.ProbeInterval, _ = observatory["probeInterval"].(string)
+		o.EnableConcurrency, _ = observatory["enableConcurrency"].(bool)
+		setting.Observatory = o
+	}
+	return setting, nil
+}
+
+// SaveBalancerSetting replaces the balancers and the observatory of the xray template, the
+// strategy settings of kept balancers and the burst observatory are left as they are
+func (s *XraySettingService) SaveBalancerSetting(setting *BalancerSetting) error {
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+	_, hasBurstObservatory := config["burstObservatory"].(map[string]interface{})
+	err = setting.CheckValid(templateOutboundTags(config), hasBurstObservatory)
+	if err != nil {
+		return err
+	}
+
+	routing, _ := config["routing"].(map[string]interface{})
+	if routing == nil {
+		routing = map[string]interface{}{}
+	}
+	oldBalancers := map[string]map[string]interface{}{}
+	balancers, _ := routing["balancers"].([]interface{})
+	for _, balancer := range balancers {
+		if balancer, ok := balancer.(map[string]interface{}); ok {
+			if tag, ok := balancer["tag"].(string); ok {
+				oldBalancers[tag] = balancer
+			}
+		}
+	}
+
+	newTags := map[string]bool{}
+	newBalancers := make([]interface{}, 0, len(setting.Balancers))
+	for _, b := range setting.Balancers {
+		newTags[b.Tag] = true
+		strategy := map[string]interface{}{"type": b.Strategy}
+		if old, ok := oldBalancers[b.Tag]["strategy"].(map[string]interface{}); ok && old["type"] == b.Strategy {
+			strategy = old
+		}
+		balancer := map[string]interface{}{
+			"tag":      b.Tag,
+			"selector": b.Selector,
+			"strategy": strategy,
+		}
+		if b.FallbackTag != "" {
+			balancer["fallbackTag"] = b.FallbackTag
+		}
+		newBalancers = append(newBalancers, balancer)
+	}
+
+	rules, _ := routing["rules"].([]interface{})
+	for _, rule := range rules {
+		if rule, ok := rule.(map[string]interface{}); ok {
+			if tag, ok := rule["balancerTag"].(string); ok && !newTags[tag] {
+				return common.NewErrorf("balancer %q is used by a routing rule", tag)
+			}
+		}
+	}
+
+	if len(newBalancers) > 0 {
+		routing["balancers"] = newBalancers
+	} else {
+		delete(routing, "balancers")
+	}
+	config["routing"] = routing
+
+	if o := setting.Observatory; o != nil {
+		config["observatory"] = map[string]interface{}{
+			"subjectSelector":   o.SubjectSelector,
+			"probeURL":          o.ProbeURL,
+			"probeInterval":     o.ProbeInterval,
+			"enableConcurrency": o.EnableConcurrency,
+		}
+		// the panel reads the observations through the api
+		if api, ok := config["api"].(map[string]interface{}); ok {
+			services, _ := api["services"].([]interface{})
+			if !slices.Contains(services, interface{}("ObservatoryService")) {
+				api["services"] = append(services, "ObservatoryService")
+			}
+		}
+	} else {
+		delete(config, "observatory")
+	}
+
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(newConfig))
+}
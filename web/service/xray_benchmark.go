@@ -0,0 +1,230 @@
+package service
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"x-ui/util/common"
+	"x-ui/xray"
+
+	"github.com/xtls/xray-core/common/uuid"
+)
+
+const (
+	benchmarkMaxDuration = 10 * time.Second
+	benchmarkMaxBytes    = 1 << 30
+	benchmarkPings       = 10
+	// not a valid instance name, so it never shares the config file of a user instance
+	benchmarkInstance = "benchmark.tmp"
+)
+
+var benchmarkLock sync.Mutex
+
+type BenchmarkResult struct {
+	CoreVersion string  `json:"coreVersion"`
+	Duration    int64   `json:"duration"`
+	Bytes       int64   `json:"bytes"`
+	Mbps        float64 `json:"mbps"`
+	ConnectMs   float64 `json:"connectMs"`
+	LatencyMs   float64 `json:"latencyMs"`
+}
+
+// Benchmark measures the throughput and latency of a temporary xray on loopback:
+// client -> socks inbound -> vless outbound -> vless inbound -> freedom -> local sink.
+// The upload stops after duration or maxBytes, whichever comes first.
+func (s *ServerService) Benchmark(duration time.Duration, maxBytes int64) (*BenchmarkResult, error) {
+	if !benchmarkLock.TryLock() {
+		return nil, common.NewError("a benchmark is already running")
+	}
+	defer benchmarkLock.Unlock()
+
+	duration = min(max(duration, time.Second), benchmarkMaxDuration)
+	maxBytes = min(max(maxBytes, 1<<20), benchmarkMaxBytes)
+
+	sink, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer sink.Close()
+	go serveBenchmarkSink(sink)
+
+	socksPort, err := freeLocalPort()
+	if err != nil {
+		return nil, err
+	}
+	vlessPort, err := freeLocalPort()
+	if err != nil {
+		return nil, err
+	}
+	config, err := benchmarkConfig(socksPort, vlessPort)
+	if err != nil {
+		return nil, err
+	}
+	process := xray.NewInstanceProcess(benchmarkInstance, "", config)
+	err = process.Start()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(xray.GetInstanceConfigPath(benchmarkInstance))
+	defer process.Stop()
+
+	socksAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(socksPort))
+	sinkAddr := sink.Addr().(*net.TCPAddr)
+	result := &BenchmarkResult{}
+
+	// wait for the socks inbound, xray needs a moment to start
+	var conn net.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		start := time.Now()
+		conn, err = dialSocks(socksAddr, sinkAddr, 'p')
+		if err == nil {
+			result.ConnectMs = float64(time.Since(start).Microseconds()) / 1000
+			break
+		}
+		if time.Now().After(deadline) || !process.IsRunning() {
+			return nil, common.NewError("benchmark xray did not start:", process.GetResult(), err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	result.CoreVersion = process.GetVersion()
+
+	// latency of one byte echoed by the sink
+	buf := make([]byte, 1)
+	var total time.Duration
+	for i := 0; i < benchmarkPings; i++ {
+		start := time.Now()
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err = conn.Write(buf); err == nil {
+			_, err = io.ReadFull(conn, buf)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, common.NewError("benchmark ping failed:", err)
+		}
+		total += time.Since(start)
+	}
+	conn.Close()
+	result.LatencyMs = float64(total.Microseconds()) / 1000 / benchmarkPings
+
+	conn, err = dialSocks(socksAddr, sinkAddr, 'u')
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	chunk := make([]byte, 32*1024)
+	start := time.Now()
+	conn.SetWriteDeadline(start.Add(duration + 2*time.Second))
+	for time.Since(start) < duration && result.Bytes < maxBytes {
+		n, err := conn.Write(chunk)
+		result.Bytes += int64(n)
+		if err != nil {
+			return nil, common.NewError("benchmark upload failed:", err)
+		}
+	}
+	elapsed := time.Since(start)
+	result.Duration = elapsed.Milliseconds()
+	result.Mbps = float64(result.Bytes*8) / elapsed.Seconds() / 1e6
+	return result, nil
+}
+
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func benchmarkConfig(socksPort int, vlessPort int) (*xray.Config, error) {
+	id := uuid.New()
+	config := fmt.Sprintf(`{
+  "log": {"loglevel": "none"},
+  "inbounds": [
+    {"tag": "bench-in", "listen": "127.0.0.1", "port": %d, "protocol": "socks", "settings": {"auth": "noauth"}},
+    {"tag": "bench-vless", "listen": "127.0.0.1", "port": %d, "protocol": "vless", "settings": {"clients": [{"id": "%s"}], "decryption": "none"}}
+  ],
+  "outbounds": [
+    {"tag": "bench-out", "protocol": "vless", "settings": {"vnext": [{"address": "127.0.0.1", "port": %d, "users": [{"id": "%s", "encryption": "none"}]}]}},
+    {"tag": "direct", "protocol": "freedom"}
+  ],
+  "routing": {"rules": [
+    {"type": "field", "inboundTag": ["bench-in"], "outboundTag": "bench-out"},
+    {"type": "field", "inboundTag": ["bench-vless"], "outboundTag": "direct"}
+  ]}
+}`, socksPort, vlessPort, id.String(), vlessPort, id.String())
+	xrayConfig := &xray.Config{}
+	err := json.Unmarshal([]byte(config), xrayConfig)
+	if err != nil {
+		return nil, err
+	}
+	return xrayConfig, nil
+}
+
+// serveBenchmarkSink discards the connections starting with 'u' and echoes the others
+func serveBenchmarkSink(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			mode := make([]byte, 1)
+			if _, err := io.ReadFull(conn, mode); err != nil {
+				return
+			}
+			if mode[0] == 'u' {
+				io.Copy(io.Discard, conn)
+			} else {
+				io.Copy(conn, conn)
+			}
+		}()
+	}
+}
+
+// dialSocks opens a socks5 connection to target and sends the sink mode byte
+func dialSocks(socksAddr string, target *net.TCPAddr, mode byte) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", socksAddr, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	reply := make([]byte, 10)
+	request := []byte{5, 1, 0, 1}
+	request = append(request, target.IP.To4()...)
+	request = binary.BigEndian.AppendUint16(request, uint16(target.Port))
+	// no auth greeting, then the connect request, replied with an ipv4 bind address
+	if _, err = conn.Write([]byte{5, 1, 0}); err == nil {
+		_, err = io.ReadFull(conn, reply[:2])
+	}
+	if err == nil && reply[1] != 0 {
+		err = common.NewError("socks auth rejected")
+	}
+	if err == nil {
+		_, err = conn.Write(request)
+	}
+	if err == nil {
+		_, err = io.ReadFull(conn, reply)
+	}
+	if err == nil && reply[1] != 0 {
+		err = common.NewError("socks connect failed:", reply[1])
+	}
+	if err == nil {
+		_, err = conn.Write([]byte{mode})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
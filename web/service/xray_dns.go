@@ -0,0 +1,255 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+
+	"x-ui/util/common"
+)
+
+// DNSSetting is the structured part of the xray dns config editable from the panel,
+// other keys of the dns block in the template are kept as they are
+type DNSSetting struct {
+	Servers       []*DNSServer        `json:"servers"`
+	Hosts         map[string][]string `json:"hosts"`
+	QueryStrategy string              `json:"queryStrategy"`
+	ClientIP      string              `json:"clientIp"`
+}
+
+// DNSServer is a dns server given as an address or as a server object. The fields of a
+// server object besides the address, like domains, expectIPs and port, are kept as they are.
+type DNSServer struct {
+	Address string
+	Fields  map[string]interface{}
+}
+
+func (d *DNSServer) MarshalJSON() ([]byte, error) {
+	if d.Fields == nil {
+		return json.Marshal(d.Address)
+	}
+	fields := make(map[string]interface{}, len(d.Fields)+1)
+	for key, value := range d.Fields {
+		fields[key] = value
+	}
+	fields["address"] = d.Address
+	return json.Marshal(fields)
+}
+
+func (d *DNSServer) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &d.Address); err == nil {
+		d.Fields = nil
+		return nil
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return common.NewError("dns server must be an address or an object:", err)
+	}
+	address, ok := fields["address"].(string)
+	if !ok {
+		return common.NewError("dns server object has no address")
+	}
+	delete(fields, "address")
+	d.Address = address
+	d.Fields = fields
+	return nil
+}
+
+var dnsServerSchemes = map[string]bool{
+	"https":       true,
+	"https+local": true,
+	"quic+local":  true,
+	"tcp":         true,
+	"tcp+local":   true,
+	"udp":         true,
+}
+
+func isValidDNSHost(host string) bool {
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if h, port, err := net.SplitHostPort(host); err == nil && port != "" {
+		return isValidDNSHost(h)
+	}
+	return isValidDomain(host)
+}
+
+func isValidDomain(domain string) bool {
+	if domain == "" || len(domain) > 253 || strings.ContainsAny(domain, " /\\") {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(domain, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
+
+func checkDNSServer(server string) error {
+	switch server {
+	case "":
+		return common.NewError("dns server can not be empty")
+	case "localhost", "fakedns":
+		return nil
+	}
+	if strings.Contains(server, "://") {
+		u, err := url.Parse(server)
+		if err != nil {
+			return common.NewError("invalid dns server:", server)
+		}
+		if !dnsServerSchemes[u.Scheme] || u.Host == "" {
+			return common.NewError("invalid dns server:", server)
+		}
+		return nil
+	}
+	if !isValidDNSHost(server) {
+		return common.NewError("invalid dns server:", server)
+	}
+	return nil
+}
+
+func (d *DNSSetting) CheckValid() error {
+	for _, server := range d.Servers {
+		if server == nil {
+			return common.NewError("dns server can not be empty")
+		}
+		if err := checkDNSServer(server.Address); err != nil {
+			return err
+		}
+	}
+	for domain, addresses := range d.Hosts {
+		if domain == "" {
+			return common.NewError("dns host domain can not be empty")
+		}
+		if len(addresses) == 0 {
+			return common.NewError("dns host has no address:", domain)
+		}
+		for _, address := range addresses {
+			if net.ParseIP(address) == nil && !isValidDomain(address) {
+				return common.NewError("invalid dns host address:", address)
+			}
+		}
+	}
+	switch d.QueryStrategy {
+	case "", "UseIP", "UseIPv4", "UseIPv6":
+	default:
+		return common.NewError("invalid dns query strategy:", d.QueryStrategy)
+	}
+	if d.ClientIP != "" && net.ParseIP(d.ClientIP) == nil {
+		return common.NewError("invalid dns client ip:", d.ClientIP)
+	}
+	return nil
+}
+
+func (s *XraySettingService) getTemplateConfig() (map[string]interface{}, error) {
+	templateConfig, err := s.SettingService.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{}
+	err = json.Unmarshal([]byte(templateConfig), &config)
+	if err != nil {
+		return nil, common.NewError("xray template config invalid:", err)
+	}
+	return config, nil
+}
+
+func (s *XraySettingService) GetDNSSetting() (*DNSSetting, error) {
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return nil, err
+	}
+	setting := &DNSSetting{
+		Servers: make([]*DNSServer, 0),
+		Hosts:   make(map[string][]string),
+	}
+	dns, _ := config["dns"].(map[string]interface{})
+	if dns == nil {
+		return setting, nil
+	}
+
+	servers, _ := dns["servers"].([]interface{})
+	for _, server := range servers {
+		data, err := json.Marshal(server)
+		if err != nil {
+			return nil, err
+		}
+		dnsServer := &DNSServer{}
+		if json.Unmarshal(data, dnsServer) == nil {
+			setting.Servers = append(setting.Servers, dnsServer)
+		}
+	}
+	hosts, _ := dns["hosts"].(map[string]interface{})
+	for domain, address := range hosts {
+		switch address := address.(type) {
+		case string:
+			setting.Hosts[domain] = []string{address}
+		case []interface{}:
+			for _, a := range address {
+				if a, ok := a.(string); ok {
+					setting.Hosts[domain] = append(setting.Hosts[domain], a)
+				}
+			}
+		}
+	}
+	setting.QueryStrategy, _ = dns["queryStrategy"].(string)
+	setting.ClientIP, _ = dns["clientIp"].(string)
+	return setting, nil
+}
+
+func (s *XraySettingService) SaveDNSSetting(setting *DNSSetting) error {
+	if err := setting.CheckValid(); err != nil {
+		return err
+	}
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+	dns, _ := config["dns"].(map[string]interface{})
+	if dns == nil {
+		dns = map[string]interface{}{}
+	}
+
+	if len(setting.Servers) > 0 {
+		dns["servers"] = setting.Servers
+	} else {
+		delete(dns, "servers")
+	}
+	if len(setting.Hosts) > 0 {
+		hosts := make(map[string]interface{}, len(setting.Hosts))
+		for domain, addresses := range setting.Hosts {
+			if len(addresses) == 1 {
+				hosts[domain] = addresses[0]
+			} else {
+				hosts[domain] = addresses
+			}
+		}
+		dns["hosts"] = hosts
+	} else {
+		delete(dns, "hosts")
+	}
+	if setting.QueryStrategy != "" {
+		dns["queryStrategy"] = setting.QueryStrategy
+	} else {
+		delete(dns, "queryStrategy")
+	}
+	if setting.ClientIP != "" {
+		dns["clientIp"] = setting.ClientIP
+	} else {
+		delete(dns, "clientIp")
+	}
+
+	if len(dns) > 0 {
+		config["dns"] = dns
+	} else {
+		delete(config, "dns")
+	}
+
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(newConfig))
+}
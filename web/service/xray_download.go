@@ -0,0 +1,169 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"x-ui/logger"
+	"x-ui/util/common"
+)
+
+// a file smaller than this is not worth splitting
+const minRangeDownloadSize = 1 << 20
+
+// downloadFile saves url to fileName, over connections parallel range requests when there
+// is more than one and the server supports them, and over a single stream otherwise
+func downloadFile(url string, fileName string, connections int) error {
+	client := newHTTPClient(0)
+	os.Remove(fileName)
+	if connections > 1 {
+		size, finalURL, ok := probeRangeSupport(client, url)
+		if ok && size >= minRangeDownloadSize {
+			err := downloadRanges(client, finalURL, fileName, size, connections)
+			if err == nil {
+				return nil
+			}
+			logger.Warning("download over", connections, "connections failed, using one:", err)
+			os.Remove(fileName)
+		}
+	}
+	return downloadStream(client, url, fileName)
+}
+
+func downloadStream(client *http.Client, url string, fileName string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return common.NewErrorf("download %s failed: %s", url, resp.Status)
+	}
+
+	setInstallProgress(func(progress *InstallProgress) {
+		progress.Total = resp.ContentLength
+		progress.Downloaded = 0
+	})
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, io.TeeReader(resp.Body, &progressWriter{}))
+	return err
+}
+
+// probeRangeSupport returns the size of url and the url after redirects if the server accepts byte ranges
+func probeRangeSupport(client *http.Client, url string) (int64, string, bool) {
+	resp, err := client.Head(url)
+	if err != nil {
+		return 0, "", false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength <= 0 {
+		return 0, "", false
+	}
+	return resp.ContentLength, resp.Request.URL.String(), true
+}
+
+func downloadRanges(client *http.Client, url string, fileName string, size int64, connections int) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = file.Truncate(size)
+	if err != nil {
+		return err
+	}
+
+	setInstallProgress(func(progress *InstallProgress) {
+		progress.Total = size
+		progress.Downloaded = 0
+	})
+
+	partSize := (size + int64(connections) - 1) / int64(connections)
+	errs := make(chan error, connections)
+	for start := int64(0); start < size; start += partSize {
+		end := min(start+partSize, size) - 1
+		go func() {
+			errs <- downloadRange(client, url, file, start, end)
+		}()
+	}
+	for start := int64(0); start < size; start += partSize {
+		if partErr := <-errs; partErr != nil && err == nil {
+			err = partErr
+		}
+	}
+	return err
+}
+
+// downloadRange writes the bytes start to end of url at the same offsets of file
+func downloadRange(client *http.Client, url string, file *os.File, start int64, end int64) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return common.NewErrorf("range %d-%d: %s", start, end, resp.Status)
+	}
+	n, err := io.Copy(io.NewOffsetWriter(file, start), io.TeeReader(resp.Body, &progressWriter{}))
+	if err != nil {
+		return err
+	}
+	if n != end-start+1 {
+		return common.NewErrorf("range %d-%d: got %d bytes", start, end, n)
+	}
+	return nil
+}
+
+// verifyXrayDigest checks fileName against the SHA2-256 line of the .dgst file xray publishes next to each archive
+func verifyXrayDigest(url string, fileName string) error {
+	resp, err := newHTTPClient(0).Get(url + ".dgst")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return common.NewErrorf("download digest of %s failed: %s", fileName, resp.Status)
+	}
+	var expected string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if digest, ok := strings.CutPrefix(scanner.Text(), "SHA2-256="); ok {
+			expected = strings.ToLower(strings.TrimSpace(digest))
+			break
+		}
+	}
+	if expected == "" {
+		return common.NewError("no SHA2-256 digest for", fileName)
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return common.NewErrorf("checksum mismatch of %s: expected %s, got %s", fileName, expected, actual)
+	}
+	return nil
+}
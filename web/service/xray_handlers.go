@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+// RuntimeHandlerChange is an inbound or outbound added or removed through the xray api. Such
+// changes are not saved and are lost when xray restarts.
+type RuntimeHandlerChange struct {
+	Kind   string `json:"kind"`   // inbound or outbound
+	Action string `json:"action"` // add or remove
+	Tag    string `json:"tag"`
+	Config string `json:"config,omitempty"`
+	Time   int64  `json:"time"`
+}
+
+var (
+	runtimeHandlerChanges []RuntimeHandlerChange
+	// the xray process the changes were made to
+	runtimeHandlerProcess *xray.Process
+	runtimeHandlerLock    sync.Mutex
+)
+
+// GetRuntimeHandlerChanges returns the api changes made to the running xray
+func (s *XrayService) GetRuntimeHandlerChanges() []RuntimeHandlerChange {
+	runtimeHandlerLock.Lock()
+	defer runtimeHandlerLock.Unlock()
+	if runtimeHandlerProcess != p {
+		runtimeHandlerChanges = nil
+	}
+	changes := make([]RuntimeHandlerChange, len(runtimeHandlerChanges))
+	copy(changes, runtimeHandlerChanges)
+	return changes
+}
+
+// ChangeRuntimeHandler adds or removes an inbound or outbound of the running xray through its
+// api without saving anything, config is the json of the handler to add
+func (s *XrayService) ChangeRuntimeHandler(kind string, action string, tag string, config string) error {
+	if !s.IsXrayRunning() {
+		return common.NewError("xray is not running")
+	}
+	if action == "add" {
+		var handler struct {
+			Tag string `json:"tag"`
+		}
+		err := json.Unmarshal([]byte(config), &handler)
+		if err != nil {
+			return err
+		}
+		if handler.Tag == "" {
+			return common.NewError("the", kind, "needs a tag")
+		}
+		tag = handler.Tag
+	} else if tag == "" {
+		return common.NewError("tag can not be empty")
+	}
+
+	runtimeHandlerLock.Lock()
+	defer runtimeHandlerLock.Unlock()
+	err := s.xrayAPI.Init(p.GetAPIPort())
+	if err != nil {
+		return err
+	}
+	defer s.xrayAPI.Close()
+	switch kind + "/" + action {
+	case "inbound/add":
+		err = s.xrayAPI.AddInbound([]byte(config))
+	case "inbound/remove":
+		err = s.xrayAPI.DelInbound(tag)
+	case "outbound/add":
+		err = s.xrayAPI.AddOutbound([]byte(config))
+	case "outbound/remove":
+		err = s.xrayAPI.DelOutbound(tag)
+	default:
+		return common.NewErrorf("unknown handler change %s %s", action, kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	if runtimeHandlerProcess != p {
+		runtimeHandlerChanges = nil
+		runtimeHandlerProcess = p
+	}
+	runtimeHandlerChanges = append(runtimeHandlerChanges, RuntimeHandlerChange{
+		Kind:   kind,
+		Action: action,
+		Tag:    tag,
+		Config: config,
+		Time:   time.Now().Unix(),
+	})
+	return nil
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"x-ui/config"
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/xray"
+)
+
+var (
+	instanceProcesses = map[string]*xray.Process{}
+	instanceLock      sync.Mutex
+	instanceNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-]+$`)
+)
+
+type XrayInstance struct {
+	Name       string `json:"name" form:"name"`
+	BinaryPath string `json:"binaryPath" form:"binaryPath"`
+	Config     string `json:"config" form:"config"`
+}
+
+type XrayInstanceStatus struct {
+	Name     string       `json:"name"`
+	State    ProcessState `json:"state"`
+	ErrorMsg string       `json:"errorMsg"`
+	Version  string       `json:"version"`
+	Uptime   uint64       `json:"uptime"`
+}
+
+type XrayInstanceService struct {
+	settingService SettingService
+}
+
+func (s *XrayInstanceService) GetInstances() ([]XrayInstance, error) {
+	data, err := s.settingService.GetXrayInstances()
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]XrayInstance, 0)
+	err = json.Unmarshal([]byte(data), &instances)
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+func (s *XrayInstanceService) saveInstances(instances []XrayInstance) error {
+	data, err := json.Marshal(instances)
+	if err != nil {
+		return err
+	}
+	return s.settingService.SetXrayInstances(string(data))
+}
+
+func (s *XrayInstanceService) getInstance(name string) (*XrayInstance, error) {
+	instances, err := s.GetInstances()
+	if err != nil {
+		return nil, err
+	}
+	for i := range instances {
+		if instances[i].Name == name {
+			return &instances[i], nil
+		}
+	}
+	return nil, common.NewErrorf("xray instance <%v> not found", name)
+}
+
+// checkBinaryPath makes sure an instance binary is a file inside the bin folder, so a
+// panel session can not run any program of the host. Empty is the panel's xray binary.
+func checkBinaryPath(binaryPath string) error {
+	if binaryPath == "" {
+		return nil
+	}
+	binFolder, err := filepath.Abs(config.GetBinFolderPath())
+	if err != nil {
+		return err
+	}
+	binFolder, err = filepath.EvalSymlinks(binFolder)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(binaryPath) {
+		binaryPath = filepath.Join(binFolder, binaryPath)
+	}
+	binaryPath, err = filepath.EvalSymlinks(binaryPath)
+	if err != nil {
+		return common.NewError("xray instance binary not found:", err)
+	}
+	if !strings.HasPrefix(binaryPath, binFolder+string(filepath.Separator)) {
+		return common.NewErrorf("xray instance binary must be in %v", binFolder)
+	}
+	info, err := os.Stat(binaryPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return common.NewErrorf("xray instance binary is not a file: %v", binaryPath)
+	}
+	return nil
+}
+
+func (s *XrayInstanceService) SaveInstance(instance *XrayInstance) error {
+	if !instanceNameRegex.MatchString(instance.Name) {
+		return common.NewErrorf("invalid instance name: %v", instance.Name)
+	}
+	if err := checkBinaryPath(instance.BinaryPath); err != nil {
+		return err
+	}
+	xrayConfig := &xray.Config{}
+	err := json.Unmarshal([]byte(instance.Config), xrayConfig)
+	if err != nil {
+		return common.NewError("xray instance config invalid:", err)
+	}
+
+	instances, err := s.GetInstances()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range instances {
+		if instances[i].Name == instance.Name {
+			instances[i] = *instance
+			found = true
+			break
+		}
+	}
+	if !found {
+		instances = append(instances, *instance)
+	}
+	return s.saveInstances(instances)
+}
+
+func (s *XrayInstanceService) DelInstance(name string) error {
+	instances, err := s.GetInstances()
+	if err != nil {
+		return err
+	}
+	for i := range instances {
+		if instances[i].Name == name {
+			s.StopInstance(name)
+			instances = append(instances[:i], instances[i+1:]...)
+			return s.saveInstances(instances)
+		}
+	}
+	return common.NewErrorf("xray instance <%v> not found", name)
+}
+
+func (s *XrayInstanceService) StartInstance(name string) error {
+	instance, err := s.getInstance(name)
+	if err != nil {
+		return err
+	}
+	// instances saved before the binary check are checked again
+	err = checkBinaryPath(instance.BinaryPath)
+	if err != nil {
+		return err
+	}
+	xrayConfig := &xray.Config{}
+	err = json.Unmarshal([]byte(instance.Config), xrayConfig)
+	if err != nil {
+		return common.NewError("xray instance config invalid:", err)
+	}
+
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+	logger.Debug("start xray instance:", name)
+
+	process, ok := instanceProcesses[name]
+	if ok && process.IsRunning() {
+		return common.NewErrorf("xray instance <%v> is already running", name)
+	}
+
+	process = xray.NewInstanceProcess(name, instance.BinaryPath, xrayConfig)
+	instanceProcesses[name] = process
+	return process.Start()
+}
+
+func (s *XrayInstanceService) StopInstance(name string) error {
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+	logger.Debug("stop xray instance:", name)
+
+	process, ok := instanceProcesses[name]
+	if !ok || !process.IsRunning() {
+		return common.NewErrorf("xray instance <%v> is not running", name)
+	}
+	return process.Stop()
+}
+
+func (s *XrayInstanceService) isInstanceRunning(name string) bool {
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+	process, ok := instanceProcesses[name]
+	return ok && process.IsRunning()
+}
+
+func (s *XrayInstanceService) RestartInstance(name string) error {
+	if s.isInstanceRunning(name) {
+		err := s.StopInstance(name)
+		if err != nil {
+			return err
+		}
+	}
+	return s.StartInstance(name)
+}
+
+// StartAllInstances starts the configured instances, a failing one does not keep the
+// others from starting
+func (s *XrayInstanceService) StartAllInstances() {
+	instances, err := s.GetInstances()
+	if err != nil {
+		logger.Warning("get xray instances failed:", err)
+		return
+	}
+	for _, instance := range instances {
+		err = s.StartInstance(instance.Name)
+		if err != nil {
+			logger.Warning("start xray instance", instance.Name, "failed:", err)
+		}
+	}
+}
+
+func (s *XrayInstanceService) StopAllInstances() {
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+	for name, process := range instanceProcesses {
+		if process.IsRunning() {
+			err := process.Stop()
+			if err != nil {
+				logger.Warning("stop xray instance", name, "failed:", err)
+			}
+		}
+	}
+}
+
+func (s *XrayInstanceService) GetInstanceStatus(name string) XrayInstanceStatus {
+	instanceLock.Lock()
+	defer instanceLock.Unlock()
+
+	status := XrayInstanceStatus{
+		Name:    name,
+		State:   Stop,
+		Version: "Unknown",
+	}
+	process, ok := instanceProcesses[name]
+	if !ok {
+		return status
+	}
+	status.Version = process.GetVersion()
+	if process.IsRunning() {
+		status.State = Running
+		status.Uptime = process.GetUptime()
+	} else {
+		if process.GetErr() != nil {
+			status.State = Error
+		}
+		status.ErrorMsg = process.GetResult()
+	}
+	return status
+}
+
+func (s *XrayInstanceService) GetInstancesStatus() []XrayInstanceStatus {
+	statuses := make([]XrayInstanceStatus, 0)
+	instances, err := s.GetInstances()
+	if err != nil {
+		logger.Warning("get xray instances failed:", err)
+		return statuses
+	}
+	for _, instance := range instances {
+		statuses = append(statuses, s.GetInstanceStatus(instance.Name))
+	}
+	return statuses
+}
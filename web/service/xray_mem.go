@@ -0,0 +1,89 @@
+package service
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"x-ui/util/common"
+)
+
+var memLimitRegex = regexp.MustCompile(`^[0-9]+(B|KiB|MiB|GiB|TiB)?$`)
+
+// XrayMemTuning holds the GOGC and GOMEMLIMIT environment of xray, empty values keep the go defaults.
+// GOGC is a percentage or "off", 50 to 200 is a safe range, lower values use less memory but more cpu.
+// GOMEMLIMIT is a size like 200MiB, keep it at 70-80% of the memory available to xray.
+type XrayMemTuning struct {
+	GoGC       string `json:"goGC" form:"goGC"`
+	GoMemLimit string `json:"goMemLimit" form:"goMemLimit"`
+}
+
+func (t *XrayMemTuning) CheckValid() error {
+	if t.GoGC != "" && t.GoGC != "off" {
+		gogc, err := strconv.Atoi(t.GoGC)
+		if err != nil || gogc < 10 || gogc > 1000 {
+			return common.NewError("GOGC must be off or between 10 and 1000:", t.GoGC)
+		}
+	}
+	if t.GoMemLimit != "" && !memLimitRegex.MatchString(t.GoMemLimit) {
+		return common.NewError("GOMEMLIMIT must be a size like 256MiB:", t.GoMemLimit)
+	}
+	if t.GoGC == "off" && t.GoMemLimit == "" {
+		// only the memory limit triggers a collection when GOGC is off
+		return common.NewError("GOGC=off needs GOMEMLIMIT, or xray never frees memory")
+	}
+	return nil
+}
+
+func (t *XrayMemTuning) Env() []string {
+	var env []string
+	if t.GoGC != "" {
+		env = append(env, "GOGC="+t.GoGC)
+	}
+	if t.GoMemLimit != "" {
+		env = append(env, "GOMEMLIMIT="+t.GoMemLimit)
+	}
+	return env
+}
+
+func (s *SettingService) GetXrayMemTuning() (*XrayMemTuning, error) {
+	gogc, err := s.GetXrayGoGC()
+	if err != nil {
+		return nil, err
+	}
+	memLimit, err := s.GetXrayGoMemLimit()
+	if err != nil {
+		return nil, err
+	}
+	return &XrayMemTuning{GoGC: gogc, GoMemLimit: memLimit}, nil
+}
+
+func (s *SettingService) SaveXrayMemTuning(t *XrayMemTuning) error {
+	t.GoGC = strings.TrimSpace(t.GoGC)
+	t.GoMemLimit = strings.TrimSpace(t.GoMemLimit)
+	if err := t.CheckValid(); err != nil {
+		return err
+	}
+	if err := s.saveSetting("xrayGoGC", t.GoGC); err != nil {
+		return err
+	}
+	return s.saveSetting("xrayGoMemLimit", t.GoMemLimit)
+}
+
+// GetActiveXrayMemTuning returns the tuning the running xray was started with
+func GetActiveXrayMemTuning() XrayMemTuning {
+	tuning := XrayMemTuning{}
+	if p == nil {
+		return tuning
+	}
+	for _, env := range p.GetEnv() {
+		key, value, _ := strings.Cut(env, "=")
+		switch key {
+		case "GOGC":
+			tuning.GoGC = value
+		case "GOMEMLIMIT":
+			tuning.GoMemLimit = value
+		}
+	}
+	return tuning
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"x-ui/util/common"
+)
+
+// outbound tags the panel and the default template rely on
+var reservedOutboundTags = map[string]bool{
+	"direct":  true,
+	"blocked": true,
+	"api":     true,
+}
+
+// ProxyOutbound is an outbound egressing through an upstream socks or http proxy,
+// traffic matching Domains, IPs or InboundTags is routed to it.
+type ProxyOutbound struct {
+	Tag         string   `json:"tag"`
+	Protocol    string   `json:"protocol"`
+	Address     string   `json:"address"`
+	Port        int      `json:"port"`
+	User        string   `json:"user"`
+	Pass        string   `json:"pass"`
+	Domains     []string `json:"domains"`
+	IPs         []string `json:"ips"`
+	InboundTags []string `json:"inboundTags"`
+}
+
+func (o *ProxyOutbound) CheckValid() error {
+	if o.Tag == "" {
+		return common.NewError("outbound tag can not be empty")
+	}
+	if reservedOutboundTags[o.Tag] {
+		return common.NewError("outbound tag is reserved:", o.Tag)
+	}
+	if o.Protocol != "socks" && o.Protocol != "http" {
+		return common.NewError("proxy protocol must be socks or http:", o.Protocol)
+	}
+	if net.ParseIP(o.Address) == nil && !isValidDomain(o.Address) {
+		return common.NewError("invalid proxy address:", o.Address)
+	}
+	if o.Port <= 0 || o.Port > 65535 {
+		return common.NewError("invalid proxy port:", o.Port)
+	}
+	if o.Pass != "" && o.User == "" {
+		return common.NewError("proxy password is set without a user")
+	}
+	for _, ip := range o.IPs {
+		if net.ParseIP(ip) == nil {
+			if _, _, err := net.ParseCIDR(ip); err != nil {
+				return common.NewError("invalid ip in proxy routing:", ip)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckReachable dials the upstream proxy
+func (o *ProxyOutbound) CheckReachable() error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(o.Address, strconv.Itoa(o.Port)), 5*time.Second)
+	if err != nil {
+		return common.NewError("upstream proxy is not reachable:", err)
+	}
+	return conn.Close()
+}
+
+func (o *ProxyOutbound) outboundConfig() map[string]interface{} {
+	server := map[string]interface{}{
+		"address": o.Address,
+		"port":    o.Port,
+	}
+	if o.User != "" {
+		server["users"] = []map[string]interface{}{{
+			"user": o.User,
+			"pass": o.Pass,
+		}}
+	}
+	return map[string]interface{}{
+		"tag":      o.Tag,
+		"protocol": o.Protocol,
+		"settings": map[string]interface{}{
+			"servers": []interface{}{server},
+		},
+	}
+}
+
+func isProxyOutbound(outbound map[string]interface{}) bool {
+	return outbound["protocol"] == "socks" || outbound["protocol"] == "http"
+}
+
+// SaveProxyOutbound adds the outbound o to the xray template, or with update replaces the
+// proxy outbound with its tag. When o has routing conditions, they replace the rules routing
+// to this outbound.
+func (s *XraySettingService) SaveProxyOutbound(o *ProxyOutbound, verify bool, update bool) error {
+	if err := o.CheckValid(); err != nil {
+		return err
+	}
+	if verify {
+		if err := o.CheckReachable(); err != nil {
+			return err
+		}
+	}
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+
+	outbounds, _ := config["outbounds"].([]interface{})
+	replaced := false
+	for i, outbound := range outbounds {
+		if outboundMap, ok := outbound.(map[string]interface{}); ok && outboundMap["tag"] == o.Tag {
+			if !update {
+				return common.NewError("outbound tag already exists:", o.Tag)
+			}
+			if !isProxyOutbound(outboundMap) {
+				return common.NewError("outbound is not a socks or http proxy:", o.Tag)
+			}
+			outbounds[i] = o.outboundConfig()
+			replaced = true
+		}
+	}
+	if update && !replaced {
+		return common.NewError("outbound not found:", o.Tag)
+	}
+	if !replaced {
+		outbounds = append(outbounds, o.outboundConfig())
+	}
+	config["outbounds"] = outbounds
+
+	if len(o.Domains) > 0 || len(o.IPs) > 0 || len(o.InboundTags) > 0 {
+		rule := map[string]interface{}{
+			"type":        "field",
+			"outboundTag": o.Tag,
+		}
+		if len(o.Domains) > 0 {
+			rule["domain"] = o.Domains
+		}
+		if len(o.IPs) > 0 {
+			rule["ip"] = o.IPs
+		}
+		if len(o.InboundTags) > 0 {
+			rule["inboundTag"] = o.InboundTags
+		}
+		routing, _ := config["routing"].(map[string]interface{})
+		if routing == nil {
+			routing = map[string]interface{}{}
+		}
+		rules := removeOutboundRules(routing["rules"], o.Tag)
+		routing["rules"] = append(rules, rule)
+		config["routing"] = routing
+	}
+
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(newConfig))
+}
+
+// DelProxyOutbound removes the proxy outbound with tag and the rules routing to it from the
+// xray template. Reserved outbounds, other protocols and outbounds still needed by a balancer
+// or by clients preferring them are not removed.
+func (s *XraySettingService) DelProxyOutbound(tag string) error {
+	if reservedOutboundTags[tag] {
+		return common.NewError("outbound tag is reserved:", tag)
+	}
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+	outbounds, _ := config["outbounds"].([]interface{})
+	newOutbounds := make([]interface{}, 0, len(outbounds))
+	found := false
+	for _, outbound := range outbounds {
+		if outboundMap, ok := outbound.(map[string]interface{}); ok && outboundMap["tag"] == tag {
+			if !isProxyOutbound(outboundMap) {
+				return common.NewError("outbound is not a socks or http proxy:", tag)
+			}
+			found = true
+			continue
+		}
+		newOutbounds = append(newOutbounds, outbound)
+	}
+	if !found {
+		return common.NewError("outbound not found:", tag)
+	}
+
+	routing, _ := config["routing"].(map[string]interface{})
+	balancers, _ := routing["balancers"].([]interface{})
+	for _, balancer := range balancers {
+		balancer, _ := balancer.(map[string]interface{})
+		selector, _ := balancer["selector"].([]interface{})
+		if balancerNeedsOutbound(selector, tag, newOutbounds) {
+			return common.NewErrorf("outbound %v is the only one of balancer %v", tag, balancer["tag"])
+		}
+	}
+	inboundService := InboundService{}
+	inbounds, err := inboundService.GetAllInbounds()
+	if err != nil {
+		return err
+	}
+	for _, inbound := range inbounds {
+		clients, err := inboundService.GetClients(inbound)
+		if err != nil {
+			return err
+		}
+		for _, client := range clients {
+			if client.Outbound == tag {
+				return common.NewErrorf("outbound %v is preferred by client %v", tag, client.Email)
+			}
+		}
+	}
+
+	config["outbounds"] = newOutbounds
+	if routing != nil {
+		routing["rules"] = removeOutboundRules(routing["rules"], tag)
+	}
+
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(newConfig))
+}
+
+// balancerNeedsOutbound tells whether tag is matched by a selector no other outbound matches
+func balancerNeedsOutbound(selector []interface{}, tag string, otherOutbounds []interface{}) bool {
+	matched := false
+	for _, prefix := range selector {
+		prefix, _ := prefix.(string)
+		if prefix == "" || !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		matched = true
+		for _, outbound := range otherOutbounds {
+			outboundMap, _ := outbound.(map[string]interface{})
+			if other, _ := outboundMap["tag"].(string); strings.HasPrefix(other, prefix) {
+				return false
+			}
+		}
+	}
+	return matched
+}
+
+func removeOutboundRules(rules interface{}, tag string) []interface{} {
+	oldRules, _ := rules.([]interface{})
+	newRules := make([]interface{}, 0, len(oldRules))
+	for _, rule := range oldRules {
+		if ruleMap, ok := rule.(map[string]interface{}); ok && ruleMap["outboundTag"] == tag {
+			continue
+		}
+		newRules = append(newRules, rule)
+	}
+	return newRules
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"x-ui/util/common"
+)
+
+// routing rule fields holding a list of strings
+var ruleListFields = []string{"domain", "ip", "source", "user", "inboundTag", "protocol"}
+
+// routing rule fields matching the traffic, a rule needs at least one of them
+var ruleMatchFields = []string{"domain", "ip", "port", "sourcePort", "network", "source", "user", "inboundTag", "protocol", "attrs"}
+
+// RoutingStrategy is how the routing resolves domains, DomainStrategy decides when a domain is
+// resolved to match ip rules and DomainMatcher which algorithm matches domain rules
+type RoutingStrategy struct {
+	DomainStrategy string `json:"domainStrategy" form:"domainStrategy"`
+	DomainMatcher  string `json:"domainMatcher" form:"domainMatcher"`
+}
+
+// domain strategies and matchers of xray, the strategies are compared ignoring case
+var (
+	routingDomainStrategies = []string{"AsIs", "AlwaysIP", "IPIfNonMatch", "IPOnDemand"}
+	routingDomainMatchers   = []string{"hybrid", "linear", "mph"}
+)
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RoutingStrategy) CheckValid() error {
+	if r.DomainStrategy != "" && !containsFold(routingDomainStrategies, r.DomainStrategy) {
+		return common.NewError("invalid routing domain strategy:", r.DomainStrategy)
+	}
+	if r.DomainMatcher != "" && !slices.Contains(routingDomainMatchers, r.DomainMatcher) {
+		return common.NewError("invalid routing domain matcher:", r.DomainMatcher)
+	}
+	return nil
+}
+
+// GetRoutingStrategy returns the domain strategy and matcher of the xray template, with the
+// xray defaults for the ones not set
+func (s *XraySettingService) GetRoutingStrategy() (*RoutingStrategy, error) {
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return nil, err
+	}
+	routing, _ := config["routing"].(map[string]interface{})
+	strategy := &RoutingStrategy{DomainStrategy: "AsIs", DomainMatcher: "hybrid"}
+	if domainStrategy, _ := routing["domainStrategy"].(string); domainStrategy != "" {
+		strategy.DomainStrategy = domainStrategy
+	}
+	if domainMatcher, _ := routing["domainMatcher"].(string); domainMatcher != "" {
+		strategy.DomainMatcher = domainMatcher
+	}
+	return strategy, nil
+}
+
+// SaveRoutingStrategy sets the domain strategy and matcher of the xray template, an empty one
+// is removed so xray uses its default
+func (s *XraySettingService) SaveRoutingStrategy(strategy *RoutingStrategy) error {
+	if err := strategy.CheckValid(); err != nil {
+		return err
+	}
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+	routing, _ := config["routing"].(map[string]interface{})
+	if routing == nil {
+		routing = map[string]interface{}{}
+	}
+	for key, value := range map[string]string{
+		"domainStrategy": strategy.DomainStrategy,
+		"domainMatcher":  strategy.DomainMatcher,
+	} {
+		if value == "" {
+			delete(routing, key)
+		} else {
+			routing[key] = value
+		}
+	}
+	config["routing"] = routing
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(newConfig))
+}
+
+// GetRoutingRules returns the routing rules of the xray template.
+func (s *XraySettingService) GetRoutingRules() ([]interface{}, error) {
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return nil, err
+	}
+	routing, _ := config["routing"].(map[string]interface{})
+	rules, _ := routing["rules"].([]interface{})
+	if rules == nil {
+		rules = []interface{}{}
+	}
+	return rules, nil
+}
+
+// SaveRoutingRules replaces the routing rules of the xray template. All rules are
+// checked first, the current rules are kept when any of them is invalid.
+func (s *XraySettingService) SaveRoutingRules(rules []map[string]interface{}) error {
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+	routing, _ := config["routing"].(map[string]interface{})
+	if routing == nil {
+		routing = map[string]interface{}{}
+	}
+
+	outboundTags := map[string]bool{}
+	outbounds, _ := config["outbounds"].([]interface{})
+	for _, outbound := range outbounds {
+		if outbound, ok := outbound.(map[string]interface{}); ok {
+			if tag, ok := outbound["tag"].(string); ok {
+				outboundTags[tag] = true
+			}
+		}
+	}
+	balancerTags := map[string]bool{}
+	balancers, _ := routing["balancers"].([]interface{})
+	for _, balancer := range balancers {
+		if balancer, ok := balancer.(map[string]interface{}); ok {
+			if tag, ok := balancer["tag"].(string); ok {
+				balancerTags[tag] = true
+			}
+		}
+	}
+
+	for i, rule := range rules {
+		err = checkRoutingRule(rule, outboundTags, balancerTags)
+		if err != nil {
+			return common.NewErrorf("routing rule %d: %v", i+1, err)
+		}
+	}
+
+	routing["rules"] = rules
+	config["routing"] = routing
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(newConfig))
+}
+
+func checkRoutingRule(rule map[string]interface{}, outboundTags map[string]bool, balancerTags map[string]bool) error {
+	if rule == nil {
+		return fmt.Errorf("rule must be an object")
+	}
+	if ruleType, ok := rule["type"]; ok && ruleType != "field" {
+		return fmt.Errorf("type must be field")
+	}
+
+	outboundTag, hasOutbound := rule["outboundTag"].(string)
+	balancerTag, hasBalancer := rule["balancerTag"].(string)
+	switch {
+	case hasOutbound && hasBalancer:
+		return fmt.Errorf("outboundTag and balancerTag can not be both set")
+	case hasOutbound:
+		if !outboundTags[outboundTag] {
+			return fmt.Errorf("outbound %q does not exist", outboundTag)
+		}
+	case hasBalancer:
+		if !balancerTags[balancerTag] {
+			return fmt.Errorf("balancer %q does not exist", balancerTag)
+		}
+	default:
+		return fmt.Errorf("outboundTag or balancerTag is required")
+	}
+
+	hasMatch := false
+	for _, field := range ruleMatchFields {
+		if _, ok := rule[field]; ok {
+			hasMatch = true
+			break
+		}
+	}
+	if !hasMatch {
+		return fmt.Errorf("rule has no condition, one of %s is required", strings.Join(ruleMatchFields, ", "))
+	}
+
+	for _, field := range ruleListFields {
+		value, ok := rule[field]
+		if !ok {
+			continue
+		}
+		list, ok := value.([]interface{})
+		if !ok || len(list) == 0 {
+			return fmt.Errorf("%s must be a non-empty list", field)
+		}
+		for _, item := range list {
+			if item, ok := item.(string); !ok || item == "" {
+				return fmt.Errorf("%s must only contain non-empty strings", field)
+			}
+		}
+	}
+	for _, field := range []string{"port", "sourcePort"} {
+		switch value := rule[field].(type) {
+		case nil, float64:
+		case string:
+			if value == "" {
+				return fmt.Errorf("%s can not be empty", field)
+			}
+		default:
+			return fmt.Errorf("%s must be a number or a string", field)
+		}
+	}
+	if network, ok := rule["network"]; ok {
+		network, _ := network.(string)
+		for _, n := range strings.Split(network, ",") {
+			if n = strings.TrimSpace(n); n != "tcp" && n != "udp" {
+				return fmt.Errorf("network must be tcp, udp or tcp,udp")
+			}
+		}
+	}
+	if attrs, ok := rule["attrs"]; ok {
+		if _, ok := attrs.(map[string]interface{}); !ok {
+			return fmt.Errorf("attrs must be an object")
+		}
+	}
+	return nil
+}
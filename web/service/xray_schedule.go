@@ -0,0 +1,99 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/util/common"
+	"x-ui/web/global"
+
+	"github.com/robfig/cron/v3"
+)
+
+// onceSchedule fires a single time at the given time
+type onceSchedule struct {
+	at time.Time
+}
+
+func (s onceSchedule) Next(now time.Time) time.Time {
+	if now.Before(s.at) {
+		return s.at
+	}
+	return time.Time{}
+}
+
+var (
+	// the cron the restart was scheduled on, a panel restart creates a new one
+	scheduledRestartCron  *cron.Cron
+	scheduledRestartEntry cron.EntryID
+	scheduledRestartAt    time.Time
+	scheduledRestartLock  sync.Mutex
+)
+
+// scheduledRestartPending tells whether a restart is scheduled on c, forgetting one scheduled
+// on a previous cron. The caller holds scheduledRestartLock.
+func scheduledRestartPending(c *cron.Cron) bool {
+	if scheduledRestartCron != c {
+		scheduledRestartCron = nil
+		scheduledRestartAt = time.Time{}
+	}
+	return !scheduledRestartAt.IsZero()
+}
+
+// GetScheduledRestart returns the unix time of the pending scheduled xray restart, or 0.
+func GetScheduledRestart() int64 {
+	scheduledRestartLock.Lock()
+	defer scheduledRestartLock.Unlock()
+	if !scheduledRestartPending(global.GetWebServer().GetCron()) {
+		return 0
+	}
+	return scheduledRestartAt.Unix()
+}
+
+// ScheduleXrayRestart restarts xray once at the given time, replacing any restart scheduled before.
+func (s *ServerService) ScheduleXrayRestart(at time.Time) error {
+	if !at.After(time.Now()) {
+		return common.NewError("restart time is in the past:", at.Format(time.RFC3339))
+	}
+	c := global.GetWebServer().GetCron()
+
+	scheduledRestartLock.Lock()
+	defer scheduledRestartLock.Unlock()
+	if scheduledRestartPending(c) {
+		c.Remove(scheduledRestartEntry)
+	}
+	scheduledRestartCron = c
+	scheduledRestartAt = at
+	scheduledRestartEntry = ScheduleCronJob(c, "scheduled xray restart", "@at "+at.Format(time.RFC3339), onceSchedule{at: at}, cron.FuncJob(func() {
+		scheduledRestartLock.Lock()
+		if !scheduledRestartAt.Equal(at) {
+			scheduledRestartLock.Unlock()
+			return
+		}
+		c.Remove(scheduledRestartEntry)
+		scheduledRestartAt = time.Time{}
+		scheduledRestartLock.Unlock()
+
+		logger.Info("restarting xray as scheduled")
+		err := s.xrayService.RestartXray(true)
+		if err != nil {
+			logger.Error("scheduled xray restart failed:", err)
+		}
+	}))
+	logger.Info("xray restart scheduled at", at.Format(time.RFC3339))
+	return nil
+}
+
+// CancelScheduledXrayRestart cancels the pending scheduled restart and reports whether there was one.
+func (s *ServerService) CancelScheduledXrayRestart() bool {
+	scheduledRestartLock.Lock()
+	defer scheduledRestartLock.Unlock()
+	c := global.GetWebServer().GetCron()
+	if !scheduledRestartPending(c) {
+		return false
+	}
+	c.Remove(scheduledRestartEntry)
+	scheduledRestartAt = time.Time{}
+	return true
+}
@@ -5,8 +5,10 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"x-ui/util/common"
@@ -60,7 +62,7 @@ func (s *XraySettingService) GetWarpConfig() (string, error) {
 	}
 	req.Header.Set("Authorization", "Bearer "+warpData["access_token"])
 
-	client := &http.Client{}
+	client := newHTTPClient(0)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -91,7 +93,7 @@ func (s *XraySettingService) RegWarp(secretKey string, publicKey string) (string
 	req.Header.Add("CF-Client-Version", "a-7.21-0721")
 	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
+	client := newHTTPClient(0)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -148,7 +150,7 @@ func (s *XraySettingService) SetWarpLicence(license string) (string, error) {
 	}
 	req.Header.Set("Authorization", "Bearer "+warpData["access_token"])
 
-	client := &http.Client{}
+	client := newHTTPClient(0)
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
@@ -171,3 +173,136 @@ func (s *XraySettingService) SetWarpLicence(license string) (string, error) {
 
 	return string(newWarpData), nil
 }
+
+func isLocalPortFree(port int) bool {
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
+
+// findFreeAPIPort returns the first port from 62789 which is neither used by an inbound nor by another process
+func (s *XraySettingService) findFreeAPIPort(usedPorts map[int]bool) (int, error) {
+	for port := 62789; port <= 65535; port++ {
+		if !usedPorts[port] && isLocalPortFree(port) {
+			return port, nil
+		}
+	}
+	return 0, common.NewError("no free port found for xray api")
+}
+
+// SetStatsService turns the stats and the policy counters of the xray template config on or
+// off. The api inbound, its routing rule and the api block are kept either way, the panel
+// needs them for traffic, online clients and changing users at runtime. Enabling adds them
+// when the template has none.
+func (s *XraySettingService) SetStatsService(enable bool, inboundPorts []int) error {
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+
+	usedPorts := map[int]bool{}
+	for _, port := range inboundPorts {
+		usedPorts[port] = true
+	}
+
+	inbounds, _ := config["inbounds"].([]interface{})
+	hasAPIInbound := false
+	for _, inbound := range inbounds {
+		if inboundMap, ok := inbound.(map[string]interface{}); ok {
+			if inboundMap["tag"] == "api" {
+				hasAPIInbound = true
+			}
+			if port, ok := inboundMap["port"].(float64); ok {
+				usedPorts[int(port)] = true
+			}
+		}
+	}
+
+	routing, _ := config["routing"].(map[string]interface{})
+	if routing == nil {
+		routing = map[string]interface{}{}
+	}
+	rules, _ := routing["rules"].([]interface{})
+	hasAPIRule := false
+	for _, rule := range rules {
+		if ruleMap, ok := rule.(map[string]interface{}); ok && ruleMap["outboundTag"] == "api" {
+			hasAPIRule = true
+		}
+	}
+
+	policy, _ := config["policy"].(map[string]interface{})
+	if policy == nil {
+		policy = map[string]interface{}{}
+	}
+	levels, _ := policy["levels"].(map[string]interface{})
+	if levels == nil {
+		levels = map[string]interface{}{}
+	}
+	level0, _ := levels["0"].(map[string]interface{})
+	if level0 == nil {
+		level0 = map[string]interface{}{}
+	}
+	system, _ := policy["system"].(map[string]interface{})
+	if system == nil {
+		system = map[string]interface{}{}
+	}
+
+	if enable {
+		if !hasAPIInbound {
+			apiPort, err := s.findFreeAPIPort(usedPorts)
+			if err != nil {
+				return err
+			}
+			inbounds = append([]interface{}{map[string]interface{}{
+				"tag":      "api",
+				"listen":   "127.0.0.1",
+				"port":     apiPort,
+				"protocol": "dokodemo-door",
+				"settings": map[string]interface{}{
+					"address": "127.0.0.1",
+				},
+			}}, inbounds...)
+		}
+		if !hasAPIRule {
+			rules = append([]interface{}{map[string]interface{}{
+				"type":        "field",
+				"inboundTag":  []string{"api"},
+				"outboundTag": "api",
+			}}, rules...)
+		}
+		if _, ok := config["api"]; !ok {
+			config["api"] = map[string]interface{}{
+				"tag":      "api",
+				"services": []string{"HandlerService", "LoggerService", "StatsService"},
+			}
+		}
+		config["stats"] = map[string]interface{}{}
+		level0["statsUserDownlink"] = true
+		level0["statsUserUplink"] = true
+		system["statsInboundDownlink"] = true
+		system["statsInboundUplink"] = true
+	} else {
+		delete(config, "stats")
+		delete(level0, "statsUserDownlink")
+		delete(level0, "statsUserUplink")
+		delete(system, "statsInboundDownlink")
+		delete(system, "statsInboundUplink")
+	}
+
+	levels["0"] = level0
+	policy["levels"] = levels
+	policy["system"] = system
+	config["policy"] = policy
+	routing["rules"] = rules
+	config["routing"] = routing
+	config["inbounds"] = inbounds
+
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.SaveXraySetting(string(newConfig))
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"x-ui/logger"
+	"x-ui/xray"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	xrayStartupHistorySize = 10
+	xrayStartupTimeout     = 30 * time.Second
+	xrayStartupPollDelay   = 50 * time.Millisecond
+)
+
+type XrayStartup struct {
+	// unix time of the restart request
+	Time int64 `json:"time"`
+	// milliseconds until the xray api answered, 0 when it did not
+	Duration int64  `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+var (
+	xrayStartups    []XrayStartup
+	xrayStartupLock sync.Mutex
+)
+
+// GetXrayStartups returns the startup times of the last xray restarts, oldest first.
+func GetXrayStartups() []XrayStartup {
+	xrayStartupLock.Lock()
+	defer xrayStartupLock.Unlock()
+	return append([]XrayStartup(nil), xrayStartups...)
+}
+
+func recordXrayStartup(startup XrayStartup) {
+	xrayStartupLock.Lock()
+	defer xrayStartupLock.Unlock()
+	xrayStartups = append(xrayStartups, startup)
+	if len(xrayStartups) > xrayStartupHistorySize {
+		xrayStartups = xrayStartups[len(xrayStartups)-xrayStartupHistorySize:]
+	}
+}
+
+// isXrayApiAnswering reports whether the xray api of the running process responds.
+// Any answer but unavailable counts, the stats service may be disabled.
+func isXrayApiAnswering() bool {
+	if p == nil || !p.IsRunning() || p.GetAPIPort() == 0 {
+		return false
+	}
+	xrayApi := xray.XrayAPI{}
+	if err := xrayApi.Init(p.GetAPIPort()); err != nil {
+		return false
+	}
+	defer xrayApi.Close()
+	_, _, err := xrayApi.GetTraffic(false)
+	return err == nil || status.Code(err) != codes.Unavailable
+}
+
+// measureXrayStartup waits for the xray api to answer and records the time since start.
+func measureXrayStartup(start time.Time, startErr error) {
+	startup := XrayStartup{Time: start.Unix()}
+	if startErr != nil {
+		startup.Error = startErr.Error()
+		recordXrayStartup(startup)
+		return
+	}
+	for time.Since(start) < xrayStartupTimeout {
+		if isXrayApiAnswering() {
+			startup.Duration = time.Since(start).Milliseconds()
+			logger.Debug("xray started in", time.Since(start))
+			recordXrayStartup(startup)
+			return
+		}
+		time.Sleep(xrayStartupPollDelay)
+	}
+	startup.Error = "xray api did not answer within " + xrayStartupTimeout.String()
+	recordXrayStartup(startup)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"x-ui/logger"
+)
+
+const (
+	watchdogBaseDelay = 30 * time.Second
+	watchdogMaxDelay  = 30 * time.Minute
+	// attempts are forgotten once xray stays up this long
+	watchdogStableUptime = 10 * 60
+)
+
+type XrayWatchdogState struct {
+	Enabled     bool   `json:"enabled"`
+	Attempts    int    `json:"attempts"`
+	MaxAttempts int    `json:"maxAttempts"`
+	LastCrash   int64  `json:"lastCrash"`
+	LastError   string `json:"lastError"`
+	NextRestart int64  `json:"nextRestart"`
+	GaveUp      bool   `json:"gaveUp"`
+}
+
+var (
+	watchdogState XrayWatchdogState
+	watchdogLock  sync.Mutex
+)
+
+func GetXrayWatchdogState() XrayWatchdogState {
+	watchdogLock.Lock()
+	defer watchdogLock.Unlock()
+	return watchdogState
+}
+
+func notifyWatchdog(name string, params ...string) {
+	tgbot := Tgbot{}
+	msg := tgbot.I18nBot(name, params...)
+	tgbot.SendMsgToTgbotAdmins(msg)
+	emailService := EmailService{}
+	emailService.Notify("Xray watchdog", msg)
+}
+
+// RunXrayWatchdog restarts xray after it exited unexpectedly, waiting exponentially longer
+// between consecutive attempts and giving up after the configured max attempts.
+func (s *ServerService) RunXrayWatchdog() {
+	settingService := SettingService{}
+	enabled, err := settingService.GetXrayWatchdog()
+	if err != nil {
+		enabled = true
+	}
+	maxAttempts, err := settingService.GetXrayWatchdogMaxAttempts()
+	if err != nil {
+		maxAttempts = 5
+	}
+
+	attempt, lastError, restart := s.checkXrayWatchdog(enabled, maxAttempts)
+	if !restart {
+		return
+	}
+	// the lock is not held while restarting, the status reads the watchdog state meanwhile
+	logger.Warning("xray watchdog restarting xray, attempt", attempt)
+	err = s.xrayService.RestartXray(false)
+	if err != nil {
+		logger.Error("xray watchdog failed to restart xray:", err)
+	}
+	notifyWatchdog("tgbot.messages.xrayRestarted",
+		"Attempt=="+strconv.Itoa(attempt),
+		"Error=="+lastError)
+}
+
+// checkXrayWatchdog updates the watchdog state and tells whether xray is due for a restart
+func (s *ServerService) checkXrayWatchdog(enabled bool, maxAttempts int) (attempt int, lastError string, restart bool) {
+	running := s.xrayService.IsXrayRunning()
+	uptime := s.xrayService.GetXrayUptime()
+
+	watchdogLock.Lock()
+	defer watchdogLock.Unlock()
+	watchdogState.Enabled = enabled
+	watchdogState.MaxAttempts = maxAttempts
+
+	// a stop by hand is no crash, xray is left stopped until it is started again
+	if running || s.xrayService.IsXrayStopped() {
+		watchdogState.NextRestart = 0
+		watchdogState.GaveUp = false
+		if running && watchdogState.Attempts > 0 && uptime > watchdogStableUptime {
+			watchdogState.Attempts = 0
+		}
+		return 0, "", false
+	}
+	if !enabled || watchdogState.GaveUp {
+		return 0, "", false
+	}
+
+	now := time.Now()
+	if watchdogState.NextRestart == 0 {
+		watchdogState.LastCrash = now.Unix()
+		watchdogState.LastError = s.xrayService.GetXrayResult()
+		if maxAttempts > 0 && watchdogState.Attempts >= maxAttempts {
+			watchdogState.GaveUp = true
+			logger.Error("xray watchdog gave up after", watchdogState.Attempts, "restart attempts")
+			notifyWatchdog("tgbot.messages.xrayWatchdogGaveUp", "Attempts=="+strconv.Itoa(watchdogState.Attempts))
+			return 0, "", false
+		}
+		delay := watchdogBaseDelay << watchdogState.Attempts
+		if delay > watchdogMaxDelay || delay <= 0 {
+			delay = watchdogMaxDelay
+		}
+		watchdogState.NextRestart = now.Add(delay).Unix()
+		logger.Warning("xray is not running, watchdog restarts it in", delay)
+		return 0, "", false
+	}
+	if now.Unix() < watchdogState.NextRestart {
+		return 0, "", false
+	}
+
+	watchdogState.Attempts++
+	watchdogState.NextRestart = 0
+	return watchdogState.Attempts, watchdogState.LastError, true
+}
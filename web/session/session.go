@@ -2,6 +2,7 @@ package session
 
 import (
 	"encoding/gob"
+	"time"
 
 	"x-ui/database/model"
 
@@ -10,7 +11,11 @@ import (
 )
 
 const (
-	loginUser = "LOGIN_USER"
+	loginUser  = "LOGIN_USER"
+	expiresAt  = "EXPIRES_AT"
+	lastSeen   = "LAST_SEEN"
+	rememberMe = "REMEMBER_ME"
+	maxAge     = "MAX_AGE"
 )
 
 func init() {
@@ -23,12 +28,57 @@ func SetLoginUser(c *gin.Context, user *model.User) error {
 	return s.Save()
 }
 
-func SetMaxAge(c *gin.Context, maxAge int) error {
+// SetLoginExpiry starts the lifetime of a login, zero being no limit.
+// A remembered login lasts its lifetime regardless of the idle timeout.
+func SetLoginExpiry(c *gin.Context, lifetime time.Duration, remember bool) error {
 	s := sessions.Default(c)
-	s.Options(sessions.Options{
-		Path:   "/",
-		MaxAge: maxAge,
-	})
+	now := time.Now().Unix()
+	s.Set(lastSeen, now)
+	s.Set(rememberMe, remember)
+	if lifetime > 0 {
+		s.Set(expiresAt, now+int64(lifetime.Seconds()))
+	} else {
+		s.Delete(expiresAt)
+	}
+	return s.Save()
+}
+
+// CheckExpiry clears the login once it is past its lifetime or was idle for longer than
+// idleTimeout, zero disabling the idle check, and returns whether it did. The last activity
+// is saved at most once a minute so that not every request rewrites the cookie.
+func CheckExpiry(c *gin.Context, idleTimeout time.Duration) bool {
+	s := sessions.Default(c)
+	if s.Get(loginUser) == nil {
+		return false
+	}
+	now := time.Now().Unix()
+	if expires, ok := s.Get(expiresAt).(int64); ok && now >= expires {
+		ClearSession(c)
+		return true
+	}
+	last, _ := s.Get(lastSeen).(int64)
+	remembered, _ := s.Get(rememberMe).(bool)
+	if idleTimeout > 0 && !remembered && last > 0 && now-last >= int64(idleTimeout.Seconds()) {
+		ClearSession(c)
+		return true
+	}
+	if now-last >= 60 {
+		s.Set(lastSeen, now)
+		// the store defaults would turn a persistent cookie into a browser session one
+		if age, ok := s.Get(maxAge).(int); ok {
+			s.Options(cookieOptions(c, age))
+		}
+		s.Save()
+	}
+	return false
+}
+
+// SetMaxAge makes the session cookie persistent for age seconds, the age is kept in the
+// session so that later saves keep the cookie persistent
+func SetMaxAge(c *gin.Context, age int) error {
+	s := sessions.Default(c)
+	s.Set(maxAge, age)
+	s.Options(cookieOptions(c, age))
 	return s.Save()
 }
 
@@ -49,9 +99,22 @@ func IsLogin(c *gin.Context) bool {
 func ClearSession(c *gin.Context) {
 	s := sessions.Default(c)
 	s.Clear()
-	s.Options(sessions.Options{
-		Path:   "/",
-		MaxAge: -1,
-	})
+	s.Options(cookieOptions(c, -1))
 	s.Save()
 }
+
+func cookieOptions(c *gin.Context, maxAge int) sessions.Options {
+	return sessions.Options{
+		Path:     getCookiePath(c),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+	}
+}
+
+func getCookiePath(c *gin.Context) string {
+	basePath := c.GetString("base_path")
+	if basePath == "" {
+		return "/"
+	}
+	return basePath
+}
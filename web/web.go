@@ -10,6 +10,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -18,6 +19,7 @@ import (
 	"x-ui/logger"
 	"x-ui/util/common"
 	"x-ui/web/controller"
+	"x-ui/web/global"
 	"x-ui/web/job"
 	"x-ui/web/locale"
 	"x-ui/web/middleware"
@@ -82,14 +84,19 @@ type Server struct {
 	httpServer *http.Server
 	listener   net.Listener
 
-	index  *controller.IndexController
-	server *controller.ServerController
-	xui    *controller.XUIController
-	api    *controller.APIController
+	index   *controller.IndexController
+	server  *controller.ServerController
+	xui     *controller.XUIController
+	api     *controller.APIController
+	metrics *controller.MetricsController
 
-	xrayService    service.XrayService
-	settingService service.SettingService
-	tgbotService   service.Tgbot
+	clientStatus *controller.ClientStatusController
+
+	xrayService         service.XrayService
+	xrayInstanceService service.XrayInstanceService
+	settingService      service.SettingService
+	tgbotService        service.Tgbot
+	emailService        service.EmailService
 
 	cron *cron.Cron
 
@@ -158,6 +165,17 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 
 	engine := gin.Default()
 
+	// forwarded client IP headers are only honored from trusted proxies
+	trustedProxies, err := s.settingService.GetTrustedProxies()
+	if err != nil {
+		return nil, err
+	}
+	engine.RemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+	err = engine.SetTrustedProxies(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	webDomain, err := s.settingService.GetWebDomain()
 	if err != nil {
 		return nil, err
@@ -176,10 +194,21 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	if err != nil {
 		return nil, err
 	}
-	engine.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{basePath + "xui/API/"})))
+	engine.Use(middleware.AccessLogMiddleware())
+	engine.Use(middleware.ConcurrencyLimitMiddleware(s.settingService.GetMaxConcurrentRequests, func(c *gin.Context) bool {
+		// probes must keep working while the panel is busy, and a log stream stays open as
+		// long as it is watched, holding a slot the whole time
+		path := c.Request.URL.Path
+		return path == basePath+"server/ready" || path == basePath+"server/clientLogStream"
+	}))
+	engine.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{basePath + "xui/API/", basePath + "server/clientLogStream"})))
 	assetsBasePath := basePath + "assets/"
 
 	store := cookie.NewStore(secret)
+	store.Options(sessions.Options{
+		Path:     basePath,
+		HttpOnly: true,
+	})
 	engine.Use(sessions.Sessions("x-ui", store))
 	engine.Use(func(c *gin.Context) {
 		c.Set("base_path", basePath)
@@ -229,6 +258,8 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 	s.server = controller.NewServerController(g)
 	s.xui = controller.NewXUIController(g)
 	s.api = controller.NewAPIController(g)
+	s.metrics = controller.NewMetricsController(g)
+	s.clientStatus = controller.NewClientStatusController(g)
 
 	return engine, nil
 }
@@ -238,28 +269,63 @@ func (s *Server) startTask() {
 	if err != nil {
 		logger.Warning("start xray failed:", err)
 	}
+	s.xrayInstanceService.StartAllInstances()
 	// Check whether xray is running every 30 seconds
-	s.cron.AddJob("@every 30s", job.NewCheckXrayRunningJob())
+	service.AddCronJob(s.cron, "xray watchdog", "@every 30s", job.NewCheckXrayRunningJob())
+
+	// Probe the upstream servers of the outbounds every minute
+	service.AddCronJob(s.cron, "outbounds health", "@every 1m", job.NewCheckOutboundsJob())
+
+	// Notify the clients passing their traffic alert percent
+	service.AddCronJob(s.cron, "traffic alerts", "@every 1m", job.NewTrafficAlertJob())
+
+	// Enable the suspended clients whose suspension is over
+	service.AddCronJob(s.cron, "restore suspended clients", "@every 10s", job.NewRestoreSuspendedClientsJob())
+
+	// Clear login attempts older than the retention
+	service.AddCronJob(s.cron, "clear login attempts", "@daily", job.NewClearLoginAttemptsJob())
+	service.AddCronJob(s.cron, "clear traffic history", "@daily", job.NewClearTrafficHistoryJob())
+	service.AddCronJob(s.cron, "purge expired trials", "@hourly", job.NewPurgeTrialsJob())
+
+	// Update the geo files from the configured source
+	geoUpdateInterval, err := s.settingService.GetGeoUpdateInterval()
+	if err == nil && geoUpdateInterval > 0 {
+		service.AddCronJob(s.cron, "geo files update", "@every "+strconv.Itoa(geoUpdateInterval)+"h", job.NewUpdateGeoFilesJob())
+	} else {
+		service.AddDisabledCronJob("geo files update", "")
+	}
 
 	// Check if xray needs to be restarted
-	s.cron.AddFunc("@every 10s", func() {
+	service.AddCronJob(s.cron, "xray pending restart", "@every 10s", cron.FuncJob(func() {
 		if s.xrayService.IsNeedRestartAndSetFalse() {
 			err := s.xrayService.RestartXray(false)
 			if err != nil {
 				logger.Error("restart xray failed:", err)
 			}
 		}
-	})
+	}))
 
 	go func() {
 		time.Sleep(time.Second * 5)
 		// Statistics every 10 seconds, start the delay for 5 seconds for the first time, and staggered with the time to restart xray
-		s.cron.AddJob("@every 10s", job.NewXrayTrafficJob())
+		service.AddCronJob(s.cron, "xray traffic", "@every 10s", job.NewXrayTrafficJob())
 	}()
 
 	// Make a traffic condition every day, 8:30
 	var entry cron.EntryID
 	isTgbotenabled, err := s.settingService.GetTgbotenabled()
+	isEmailEnabled := s.emailService.IsEnabled()
+	if isEmailEnabled && (err != nil || !isTgbotenabled) {
+		// email reports share the telegram report schedule
+		runtime, err := s.settingService.GetTgbotRuntime()
+		if err != nil || runtime == "" {
+			runtime = "@daily"
+		}
+		_, err = service.AddCronJob(s.cron, "stats report", runtime, job.NewStatsNotifyJob())
+		if err != nil {
+			logger.Warning("Add NewStatsNotifyJob error", err)
+		}
+	}
 	if (err == nil) && (isTgbotenabled) {
 		runtime, err := s.settingService.GetTgbotRuntime()
 		if err != nil || runtime == "" {
@@ -267,7 +333,7 @@ func (s *Server) startTask() {
 			runtime = "@daily"
 		}
 		logger.Infof("Tg notify enabled,run at %s", runtime)
-		_, err = s.cron.AddJob(runtime, job.NewStatsNotifyJob())
+		_, err = service.AddCronJob(s.cron, "stats report", runtime, job.NewStatsNotifyJob())
 		if err != nil {
 			logger.Warning("Add NewStatsNotifyJob error", err)
 			return
@@ -276,10 +342,28 @@ func (s *Server) startTask() {
 		// Check CPU load and alarm to TgBot if threshold passes
 		cpuThreshold, err := s.settingService.GetTgCpu()
 		if (err == nil) && (cpuThreshold > 0) {
-			s.cron.AddJob("@every 10s", job.NewCheckCpuJob())
+			service.AddCronJob(s.cron, "cpu alarm", "@every 10s", job.NewCheckCpuJob())
+		} else {
+			service.AddDisabledCronJob("cpu alarm", "@every 10s")
 		}
 	} else {
 		s.cron.Remove(entry)
+		if !isEmailEnabled {
+			service.AddDisabledCronJob("stats report", "")
+		}
+		service.AddDisabledCronJob("cpu alarm", "@every 10s")
+	}
+}
+
+func (s *Server) initAccessLog() {
+	path := ""
+	if enable, err := s.settingService.GetAccessLogEnable(); err == nil && enable {
+		path = filepath.Join(config.GetLogFolderPath(), "x-ui-access.log")
+	}
+	retention, _ := s.settingService.GetAccessLogRetention()
+	err := logger.InitAccessLog(path, retention)
+	if err != nil {
+		logger.Warning("init panel access log failed:", err)
 	}
 }
 
@@ -296,8 +380,11 @@ func (s *Server) Start() (err error) {
 		return err
 	}
 	s.cron = cron.New(cron.WithLocation(loc), cron.WithSeconds())
+	service.ResetCronJobs()
 	s.cron.Start()
 
+	s.initAccessLog()
+
 	engine, err := s.initRouter()
 	if err != nil {
 		return err
@@ -324,6 +411,7 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
+	selfSigned, _ := s.settingService.GetWebSelfSigned()
 	if certFile != "" || keyFile != "" {
 		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 		if err == nil {
@@ -337,6 +425,20 @@ func (s *Server) Start() (err error) {
 			logger.Error("error in loading certificates: ", err)
 			logger.Info("web server run http on", listener.Addr())
 		}
+	} else if selfSigned {
+		// no certificate is set, serve a self-signed one instead of plain http
+		cert, err := s.settingService.GetSelfSignedCert()
+		if err == nil {
+			c := &tls.Config{
+				Certificates: []tls.Certificate{*cert},
+			}
+			listener = network.NewAutoHttpsListener(listener)
+			listener = tls.NewListener(listener, c)
+			logger.Info("web server run https with a self-signed certificate on", listener.Addr())
+		} else {
+			logger.Error("error in generating the self-signed certificate: ", err)
+			logger.Info("web server run http on", listener.Addr())
+		}
 	} else {
 		logger.Info("web server run http on", listener.Addr())
 	}
@@ -358,12 +460,16 @@ func (s *Server) Start() (err error) {
 		go tgBot.Start(i18nFS)
 	}
 
+	global.SetReady(true)
+
 	return nil
 }
 
 func (s *Server) Stop() error {
+	global.SetReady(false)
 	s.cancel()
 	s.xrayService.StopXray()
+	s.xrayInstanceService.StopAllInstances()
 	if s.cron != nil {
 		s.cron.Stop()
 	}
@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"x-ui/logger"
 	"x-ui/util/common"
 
+	observatoryService "github.com/xtls/xray-core/app/observatory/command"
 	"github.com/xtls/xray-core/app/proxyman/command"
 	statsService "github.com/xtls/xray-core/app/stats/command"
 	"github.com/xtls/xray-core/common/protocol"
@@ -21,6 +23,8 @@ import (
 	"github.com/xtls/xray-core/proxy/vless"
 	"github.com/xtls/xray-core/proxy/vmess"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type XrayAPI struct {
@@ -85,6 +89,50 @@ func (x *XrayAPI) DelInbound(tag string) error {
 	return err
 }
 
+// HasInbound reports whether xray runs an inbound with tag. The api can not list inbounds, so
+// the user of an unused email is removed from it, which only fails to find the handler when
+// there is no such inbound.
+func (x *XrayAPI) HasInbound(tag string) (bool, error) {
+	err := x.RemoveUser(tag, "x-ui-probe-"+time.Now().Format("150405.000000"))
+	if err == nil {
+		return true, nil
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return false, err
+	}
+	return !strings.Contains(err.Error(), "handler not found"), nil
+}
+
+func (x *XrayAPI) AddOutbound(outbound []byte) error {
+	client := *x.HandlerServiceClient
+
+	conf := new(conf.OutboundDetourConfig)
+	err := json.Unmarshal(outbound, conf)
+	if err != nil {
+		logger.Debug("Failed to unmarshal outbound:", err)
+		return err
+	}
+	config, err := conf.Build()
+	if err != nil {
+		logger.Debug("Failed to build outbound Detur:", err)
+		return err
+	}
+	outboundConfig := command.AddOutboundRequest{Outbound: config}
+
+	_, err = client.AddOutbound(context.Background(), &outboundConfig)
+
+	return err
+}
+
+func (x *XrayAPI) DelOutbound(tag string) error {
+	client := *x.HandlerServiceClient
+	_, err := client.RemoveOutbound(context.Background(), &command.RemoveOutboundRequest{
+		Tag: tag,
+	})
+	return err
+}
+
 func (x *XrayAPI) AddUser(Protocol string, inboundTag string, user map[string]interface{}) error {
 	var account *serial.TypedMessage
 	switch Protocol {
@@ -234,3 +282,29 @@ func (x *XrayAPI) GetTraffic(reset bool) ([]*Traffic, []*ClientTraffic, error) {
 
 	return traffics, clientTraffics, nil
 }
+
+// GetObservatoryStatus returns the last observation of every outbound watched by the
+// observatory, it needs ObservatoryService in the api services of the config
+func (x *XrayAPI) GetObservatoryStatus() ([]*OutboundStatus, error) {
+	if x.grpcClient == nil {
+		return nil, common.NewError("xray api is not initialized")
+	}
+	client := observatoryService.NewObservatoryServiceClient(x.grpcClient)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	resp, err := client.GetOutboundStatus(ctx, &observatoryService.GetOutboundStatusRequest{})
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*OutboundStatus, 0)
+	for _, status := range resp.GetStatus().GetStatus() {
+		statuses = append(statuses, &OutboundStatus{
+			Tag:         status.OutboundTag,
+			Alive:       status.Alive,
+			Delay:       status.Delay,
+			LastError:   status.LastErrorReason,
+			LastTryTime: status.LastTryTime,
+		})
+	}
+	return statuses, nil
+}
@@ -0,0 +1,76 @@
+package xray
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// blockedLogSize is how many blocked connections are kept, the oldest ones are dropped
+const blockedLogSize = 1000
+
+// access log: "[time ]from 1.2.3.4:5678 accepted tcp:example.com:443 [in >> out] email: user"
+var accessLineRegex = regexp.MustCompile(`^(?:\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)? )?(?:from )?\S+ (?:accepted|rejected) `)
+
+var (
+	blockedLock sync.Mutex
+	// route suffixes of the blackhole outbounds, none while blocked connections are not captured
+	blockedRoutes []string
+	// the other access log lines are dropped instead of going to the panel log
+	quietAccess  bool
+	blockedLines []string
+	blockedNext  int
+)
+
+// SetBlockedLog captures the access log lines routed to the outbounds tagged tags apart from the
+// panel log, no tags turning it off. With quiet the other access log lines are dropped, for an
+// access log only enabled for the capture.
+func SetBlockedLog(tags []string, quiet bool) {
+	blockedLock.Lock()
+	defer blockedLock.Unlock()
+	// the route is "[inbound >> outbound]", or "[inbound -> outbound]" in older versions
+	blockedRoutes = make([]string, 0, len(tags)*2)
+	for _, tag := range tags {
+		blockedRoutes = append(blockedRoutes, " >> "+tag+"]", " -> "+tag+"]")
+	}
+	quietAccess = quiet && len(tags) > 0
+	if len(tags) == 0 {
+		blockedLines = nil
+		blockedNext = 0
+	}
+}
+
+// captureAccessLine keeps line when it is an access log line routed to a blackhole outbound,
+// telling whether line is done with and should not go to the panel log
+func captureAccessLine(line string) bool {
+	blockedLock.Lock()
+	defer blockedLock.Unlock()
+	if len(blockedRoutes) == 0 || !accessLineRegex.MatchString(line) {
+		return false
+	}
+	for _, route := range blockedRoutes {
+		if strings.Contains(line, route) {
+			if len(blockedLines) < blockedLogSize {
+				blockedLines = append(blockedLines, line)
+			} else {
+				blockedLines[blockedNext] = line
+			}
+			blockedNext = (blockedNext + 1) % blockedLogSize
+			return true
+		}
+	}
+	return quietAccess
+}
+
+// GetBlockedLines returns the last count captured access log lines, newest first
+func GetBlockedLines(count int) []string {
+	blockedLock.Lock()
+	defer blockedLock.Unlock()
+	count = max(min(count, len(blockedLines)), 0)
+	lines := make([]string, 0, count)
+	for i := 1; i <= count; i++ {
+		index := (blockedNext - i + len(blockedLines)) % len(blockedLines)
+		lines = append(lines, blockedLines[index])
+	}
+	return lines
+}
@@ -10,4 +10,14 @@ type ClientTraffic struct {
 	ExpiryTime int64  `json:"expiryTime" form:"expiryTime"`
 	Total      int64  `json:"total" form:"total"`
 	Reset      int    `json:"reset" form:"reset" gorm:"default:0"`
+	ResetDay   int    `json:"resetDay" form:"resetDay" gorm:"default:0"`
+	LastReset  int64  `json:"lastReset" form:"lastReset" gorm:"default:0"`
+	Alerted    bool   `json:"alerted" form:"alerted" gorm:"default:false"`
+	// percent of Total usable beyond it before the client is disabled, 0 uses the global one
+	TrafficGrace  int  `json:"trafficGrace" form:"trafficGrace" gorm:"default:0"`
+	GraceNotified bool `json:"graceNotified" form:"graceNotified" gorm:"default:false"`
+	// unix milliseconds at which a suspended client is enabled again, 0 when not suspended
+	SuspendedUntil int64 `json:"suspendedUntil" form:"suspendedUntil" gorm:"default:0"`
+	// a trial client, purged by the trial purge job once it expired
+	Trial bool `json:"trial" form:"trial" gorm:"default:false"`
 }
@@ -31,6 +31,11 @@ func (c *Config) Equals(other *Config) bool {
 			return false
 		}
 	}
+	return c.EqualsExceptInbounds(other)
+}
+
+// EqualsExceptInbounds compares everything but the inbounds, which can be changed through the api
+func (c *Config) EqualsExceptInbounds(other *Config) bool {
 	if !bytes.Equal(c.LogConfig, other.LogConfig) {
 		return false
 	}
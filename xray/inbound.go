@@ -8,19 +8,20 @@ import (
 
 type InboundConfig struct {
 	Listen         json_util.RawMessage `json:"listen"` // listen cannot be an empty string
-	Port           int                  `json:"port"`
+	Port           json_util.RawMessage `json:"port"`
 	Protocol       string               `json:"protocol"`
 	Settings       json_util.RawMessage `json:"settings"`
 	StreamSettings json_util.RawMessage `json:"streamSettings"`
 	Tag            string               `json:"tag"`
 	Sniffing       json_util.RawMessage `json:"sniffing"`
+	Allocate       json_util.RawMessage `json:"allocate,omitempty"`
 }
 
 func (c *InboundConfig) Equals(other *InboundConfig) bool {
 	if !bytes.Equal(c.Listen, other.Listen) {
 		return false
 	}
-	if c.Port != other.Port {
+	if !bytes.Equal(c.Port, other.Port) {
 		return false
 	}
 	if c.Protocol != other.Protocol {
@@ -38,5 +39,8 @@ func (c *InboundConfig) Equals(other *InboundConfig) bool {
 	if !bytes.Equal(c.Sniffing, other.Sniffing) {
 		return false
 	}
+	if !bytes.Equal(c.Allocate, other.Allocate) {
+		return false
+	}
 	return true
 }
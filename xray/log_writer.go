@@ -25,6 +25,9 @@ func (lw *LogWriter) Write(m []byte) (n int, err error) {
 	lw.lastLine = messages[len(messages)-1]
 
 	for _, msg := range messages {
+		if captureAccessLine(msg) {
+			continue
+		}
 		matches := regex.FindStringSubmatch(msg)
 
 		if len(matches) > 3 {
@@ -46,7 +49,6 @@ func (lw *LogWriter) Write(m []byte) (n int, err error) {
 			}
 		} else if msg != "" {
 			logger.Debug("XRAY: " + msg)
-			return len(m), nil
 		}
 	}
 
@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -29,6 +30,10 @@ func GetConfigPath() string {
 	return config.GetBinFolderPath() + "/config.json"
 }
 
+func GetInstanceConfigPath(name string) string {
+	return config.GetBinFolderPath() + "/config-" + name + ".json"
+}
+
 func GetGeositePath() string {
 	return config.GetBinFolderPath() + "/geosite.dat"
 }
@@ -51,15 +56,31 @@ func NewProcess(xrayConfig *Config) *Process {
 	return p
 }
 
+// NewInstanceProcess creates a process for an additional named instance,
+// using its own binary and a separate config file
+func NewInstanceProcess(name string, binaryPath string, xrayConfig *Config) *Process {
+	p := &Process{newProcess(xrayConfig)}
+	if binaryPath != "" {
+		p.binaryPath = binaryPath
+	}
+	p.configPath = GetInstanceConfigPath(name)
+	runtime.SetFinalizer(p, stopProcess)
+	return p
+}
+
 type process struct {
 	cmd *exec.Cmd
 
+	binaryPath string
+	configPath string
+
 	version string
 	apiPort int
 
 	onlineClients []string
 
 	config    *Config
+	env       []string
 	logWriter *LogWriter
 	exitErr   error
 	startTime time.Time
@@ -67,10 +88,12 @@ type process struct {
 
 func newProcess(config *Config) *process {
 	return &process{
-		version:   "Unknown",
-		config:    config,
-		logWriter: NewLogWriter(),
-		startTime: time.Now(),
+		binaryPath: GetBinaryPath(),
+		configPath: GetConfigPath(),
+		version:    "Unknown",
+		config:     config,
+		logWriter:  NewLogWriter(),
+		startTime:  time.Now(),
 	}
 }
 
@@ -107,6 +130,29 @@ func (p *Process) GetConfig() *Config {
 	return p.config
 }
 
+// SetEnv sets environment variables of the form KEY=value added to the environment of xray
+func (p *Process) SetEnv(env []string) {
+	p.env = env
+}
+
+func (p *Process) GetEnv() []string {
+	return p.env
+}
+
+// SetConfig replaces the config of a running process, after its changes are applied through the api
+func (p *Process) SetConfig(config *Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return common.NewErrorf("Failed to generate XRAY configuration files: %v", err)
+	}
+	err = os.WriteFile(p.configPath, data, fs.ModePerm)
+	if err != nil {
+		return common.NewErrorf("Write the configuration file failed: %v", err)
+	}
+	p.config = config
+	return nil
+}
+
 func (p *Process) GetOnlineClients() []string {
 	return p.onlineClients
 }
@@ -122,14 +168,14 @@ func (p *Process) GetUptime() uint64 {
 func (p *process) refreshAPIPort() {
 	for _, inbound := range p.config.InboundConfigs {
 		if inbound.Tag == "api" {
-			p.apiPort = inbound.Port
+			p.apiPort, _ = strconv.Atoi(string(inbound.Port))
 			break
 		}
 	}
 }
 
 func (p *process) refreshVersion() {
-	cmd := exec.Command(GetBinaryPath(), "-version")
+	cmd := exec.Command(p.binaryPath, "-version")
 	data, err := cmd.Output()
 	if err != nil {
 		p.version = "Unknown"
@@ -159,13 +205,16 @@ func (p *process) Start() (err error) {
 	if err != nil {
 		return common.NewErrorf("Failed to generate XRAY configuration files: %v", err)
 	}
-	configPath := GetConfigPath()
+	configPath := p.configPath
 	err = os.WriteFile(configPath, data, fs.ModePerm)
 	if err != nil {
 		return common.NewErrorf("Write the configuration file failed: %v", err)
 	}
 
-	cmd := exec.Command(GetBinaryPath(), "-c", configPath)
+	cmd := exec.Command(p.binaryPath, "-c", configPath)
+	if len(p.env) > 0 {
+		cmd.Env = append(os.Environ(), p.env...)
+	}
 	p.cmd = cmd
 
 	cmd.Stdout = p.logWriter
@@ -191,3 +240,23 @@ func (p *process) Stop() error {
 	}
 	return p.cmd.Process.Signal(syscall.SIGTERM)
 }
+
+// TestConfig checks xrayConfig with the -test flag of the xray binary and returns its output.
+func TestConfig(xrayConfig *Config) (string, error) {
+	data, err := json.MarshalIndent(xrayConfig, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp("", "xray-test-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.Command(GetBinaryPath(), "-test", "-c", file.Name()).CombinedOutput()
+	return string(output), err
+}
@@ -6,3 +6,11 @@ type Traffic struct {
 	Up        int64
 	Down      int64
 }
+
+type OutboundStatus struct {
+	Tag         string
+	Alive       bool
+	Delay       int64
+	LastError   string
+	LastTryTime int64
+}